@@ -50,6 +50,7 @@ func main() {
 	shouldPrintTracking := getTrimmedEnv("TOIT_SHOULD_PRINT_TRACKING")
 	sdkVersion := getTrimmedEnv("TOIT_SDK_VERSION")
 	noAutosync := getTrimmedEnv("TOIT_NO_AUTO_SYNC")
+	messageFormat := getTrimmedEnv("TOIT_MESSAGE_FORMAT")
 
 	track := func(ctx context.Context, te *tracking.Event) error {
 		if shouldPrintTracking != "" {
@@ -81,6 +82,13 @@ func main() {
 			fmt.Fprintln(os.Stderr, e)
 		}
 	}
+	if messageFormat != "" {
+		// The environment variable only changes the default. The
+		// '--message-format' flag still takes precedence.
+		flag := pkgCmd.PersistentFlags().Lookup("message-format")
+		flag.DefValue = messageFormat
+		flag.Value.Set(messageFormat)
+	}
 	rootCmd.AddCommand(pkgCmd)
 	rootCmd.PersistentFlags().Bool("auto-sync", true, "automatically synchronize registries")
 	rootCmd.Execute()
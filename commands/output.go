@@ -0,0 +1,225 @@
+// Copyright (C) 2021 Toitware ApS.
+//
+// This library is free software; you can redistribute it and/or
+// modify it under the terms of the GNU Lesser General Public
+// License as published by the Free Software Foundation; version
+// 2.1 only.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Lesser General Public License for more details.
+//
+// The license can be found in the file `LICENSE` in the top level
+// directory of this repository.
+
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/toitlang/tpkg/pkg/tpkg"
+)
+
+// The JSON output of the commands.
+//
+// When a command is run with '--output json' it prints exactly one JSON
+// document (an object) to stdout. Messages (errors, warnings and infos) are
+// printed to stderr instead, so they don't interfere with the document.
+// If the command fails, no document is printed and the exit code is non-zero.
+//
+// The documents are described by the following types. Packages are always
+// described by the JSON encoding of tpkg.Desc, lock files by the JSON
+// encoding of tpkg.LockFile.
+
+// ListOutput is the output of 'pkg list'.
+type ListOutput struct {
+	Registries []RegistryPackagesOutput `json:"registries"`
+}
+
+// RegistryPackagesOutput describes one registry and its packages.
+type RegistryPackagesOutput struct {
+	// The name of the registry. Empty if the registry was given as argument.
+	Name string `json:"name"`
+	// A human readable description of the registry (usually its path or URL).
+	Description string       `json:"description"`
+	Packages    []*tpkg.Desc `json:"packages"`
+}
+
+// SearchOutput is the output of 'pkg search'.
+type SearchOutput struct {
+	// The packages that matched, with only the highest version of each package.
+	Packages []*tpkg.Desc `json:"packages"`
+}
+
+// DescribeOutput is the output of 'pkg describe'.
+type DescribeOutput struct {
+	Package *tpkg.Desc `json:"package"`
+	// The path of the written description file, if '--out-dir' was given.
+	Path string `json:"path,omitempty"`
+}
+
+// PublishOutput is the output of 'pkg publish'.
+type PublishOutput struct {
+	Package *tpkg.Desc `json:"package"`
+	// The path of the description file in the registry.
+	Path string `json:"path"`
+	// The hash of the registry commit, if the description was committed.
+	Commit string `json:"commit,omitempty"`
+	// The branch the registry checkout was switched to, if any.
+	Branch string `json:"branch,omitempty"`
+	// Whether the registry already contained the same description.
+	AlreadyPublished bool `json:"already_published"`
+}
+
+// VersionBumpOutput is the output of 'pkg version bump'.
+type VersionBumpOutput struct {
+	// The version of the latest tag. Empty if the package wasn't tagged yet.
+	Previous string `json:"previous,omitempty"`
+	Version  string `json:"version"`
+	Tag      string `json:"tag"`
+	// The hash of the tagged commit.
+	Commit string `json:"commit"`
+	// Whether the version in the package file was updated and committed.
+	UpdatedSpec bool `json:"updated_spec"`
+}
+
+// LicensesOutput is the output of 'pkg licenses'.
+type LicensesOutput struct {
+	Packages []PackageLicenseOutput `json:"packages"`
+}
+
+// PackageLicenseOutput is the license of a package of the lock file.
+type PackageLicenseOutput struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+	URL     string `json:"url,omitempty"`
+	// The path of a local package.
+	Path string `json:"path,omitempty"`
+	// The SPDX license ID. Empty if unknown.
+	License string `json:"license"`
+	// Why the license isn't allowed by the license policy, if it isn't.
+	Violation string `json:"violation,omitempty"`
+}
+
+// LintOutput is the output of 'pkg lint'.
+type LintOutput struct {
+	// The problems that were found, errors first.
+	Diagnostics []tpkg.LintDiagnostic `json:"diagnostics"`
+}
+
+// CheckImportsOutput is the output of 'pkg check-imports'.
+type CheckImportsOutput struct {
+	// The prefixes of dependencies that no source file imports.
+	Unused []string `json:"unused"`
+	// The imports that are neither of a dependency nor of an SDK library.
+	Missing []tpkg.ToitImport `json:"missing"`
+	// The unused dependencies that were removed with '--fix'.
+	Removed []string `json:"removed"`
+}
+
+// OutdatedOutput is the output of 'pkg outdated'.
+type OutdatedOutput struct {
+	// The packages that have a newer version, or that are yanked or deprecated.
+	Packages []tpkg.OutdatedPackage `json:"packages"`
+}
+
+// RegistryCheckOutput is the output of 'pkg registry check'.
+type RegistryCheckOutput struct {
+	// The problems that were found, errors first.
+	Diagnostics []tpkg.LintDiagnostic `json:"diagnostics"`
+}
+
+// RegistryListOutput is the output of 'pkg registry list'.
+type RegistryListOutput struct {
+	Registries []tpkg.RegistryConfig `json:"registries"`
+}
+
+// InstallOutput is the output of 'pkg install'.
+type InstallOutput struct {
+	// The packages that were explicitly installed. Empty if no package was
+	// given as argument.
+	Installed []InstalledPackageOutput `json:"installed"`
+	// The lock file after the installation.
+	LockFile *tpkg.LockFile `json:"lock_file"`
+}
+
+// InstalledPackageOutput describes a package that was installed.
+type InstalledPackageOutput struct {
+	// The URL and version of the package (url@version), or the path for
+	// local packages.
+	Package string `json:"package"`
+	// The prefix under which the package can be imported.
+	Prefix string `json:"prefix"`
+}
+
+// UpdateOutput is the output of 'pkg update'.
+type UpdateOutput struct {
+	// The lock file after the update.
+	LockFile *tpkg.LockFile `json:"lock_file"`
+}
+
+// UninstallOutput is the output of 'pkg uninstall'.
+type UninstallOutput struct {
+	// The prefix that was uninstalled.
+	Uninstalled string `json:"uninstalled"`
+	// The lock file after the package was uninstalled.
+	LockFile *tpkg.LockFile `json:"lock_file"`
+}
+
+// CacheListOutput is the output of 'pkg cache list'.
+type CacheListOutput struct {
+	// The cached packages, in search order.
+	Packages []tpkg.CachedPkg `json:"packages"`
+	// The cached registries.
+	Registries []tpkg.CachedRegistry `json:"registries"`
+}
+
+// CachePathOutput is the output of 'pkg cache path'.
+type CachePathOutput struct {
+	// The paths of the package, in search order. Only contains the
+	// first path unless '--all' was given.
+	Paths []string `json:"paths"`
+}
+
+type outputFormat string
+
+const (
+	outputText outputFormat = "text"
+	outputJSON outputFormat = "json"
+)
+
+func addOutputFlag(cmd *cobra.Command) {
+	cmd.Flags().StringP("output", "o", string(outputText), "Defines the output format (valid: 'text', 'json')")
+}
+
+func hasOutputFlag(cmd *cobra.Command) bool {
+	return cmd.Flags().Lookup("output") != nil
+}
+
+func getOutputFormat(cmd *cobra.Command) (outputFormat, error) {
+	output, err := cmd.Flags().GetString("output")
+	if err != nil {
+		return "", err
+	}
+	switch output {
+	case string(outputText), "list":
+		// 'list' was the original name of the text output of 'pkg list'.
+		return outputText, nil
+	case string(outputJSON):
+		return outputJSON, nil
+	}
+	return "", fmt.Errorf("Invalid output format '%s'. Valid formats: 'text', 'json'", output)
+}
+
+func printJSON(v interface{}) error {
+	encoded, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(encoded))
+	return nil
+}
@@ -18,7 +18,7 @@ package commands
 import (
 	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -26,10 +26,12 @@ import (
 	"strconv"
 	"strings"
 	"text/template"
+	"time"
 
 	"github.com/alessio/shellescape"
 	"github.com/hashicorp/go-version"
 	"github.com/spf13/cobra"
+	"github.com/toitlang/tpkg/config"
 	"github.com/toitlang/tpkg/pkg/tpkg"
 	"github.com/toitlang/tpkg/pkg/tracking"
 )
@@ -46,6 +48,7 @@ type Config struct {
 	PackageCachePaths  []string
 	RegistryCachePaths []string
 	PackageInstallPath *string
+	PackageStorePath   *string
 	SDKVersion         *version.Version
 
 	// The following entries must be `nil` if they are not set in the
@@ -99,6 +102,9 @@ func (h *pkgHandler) buildCache() (tpkg.Cache, error) {
 	if h.cfg.PackageInstallPath != nil {
 		options = append(options, tpkg.WithPkgInstallPath(*h.cfg.PackageInstallPath))
 	}
+	if h.cfg.PackageStorePath != nil {
+		options = append(options, tpkg.WithPkgStorePath(*h.cfg.PackageStorePath))
+	}
 
 	return tpkg.NewCache(registryPath, h.ui, options...), nil
 }
@@ -145,18 +151,24 @@ type pkgHandler struct {
 	cfgStore ConfigStore
 	ui       tpkg.UI
 	track    tracking.Track
+	// Whether the handler uses the default UI. If true, the UI can be changed
+	// with the '--message-format' flag, and prints to stderr when a command
+	// emits JSON.
+	hasDefaultUI bool
 }
 
 func Pkg(run Run, track tracking.Track, configStore ConfigStore, ui tpkg.UI) (*cobra.Command, error) {
 
-	if ui == nil {
+	hasDefaultUI := ui == nil
+	if hasDefaultUI {
 		ui = tpkgUI
 	}
 
 	handler := &pkgHandler{
-		cfgStore: configStore,
-		ui:       ui,
-		track:    track,
+		cfgStore:     configStore,
+		ui:           ui,
+		track:        track,
+		hasDefaultUI: hasDefaultUI,
 	}
 
 	// 1. Loads the config before invoking the command.
@@ -186,10 +198,42 @@ func Pkg(run Run, track tracking.Track, configStore ConfigStore, ui tpkg.UI) (*c
 				handler.cfg.SDKVersion = v
 			}
 
+			output := outputText
+			var outputErr error
+			if hasOutputFlag(cmd) {
+				output, outputErr = getOutputFormat(cmd)
+			}
+
+			if handler.hasDefaultUI {
+				messageFormat, err := cmd.Flags().GetString("message-format")
+				if err != nil {
+					return err
+				}
+				switch messageFormat {
+				case "text":
+					if output == outputJSON {
+						// Keep stdout free for the JSON document.
+						handler.ui = tpkg.NewFmtUI(os.Stderr)
+					} else {
+						handler.ui = tpkgUI
+					}
+				case "json":
+					// Messages go to stderr, so they don't interfere with the output of the command.
+					handler.ui = tpkg.NewJSONUI(os.Stderr)
+				default:
+					tpkgUI.ReportError("Invalid message format '%s'. Valid formats: 'text', 'json'", messageFormat)
+					return newExitError(1)
+				}
+			}
+			if outputErr != nil {
+				handler.ui.ReportError("%v", outputErr)
+				return newExitError(1)
+			}
+
 			err = f(cmd, args)
 
 			if tpkg.IsErrAlreadyReported(err) {
-				return newExitError(1)
+				return newExitError(exitCodeFor(err))
 			}
 			return err
 		})
@@ -198,10 +242,20 @@ func Pkg(run Run, track tracking.Track, configStore ConfigStore, ui tpkg.UI) (*c
 	cmd := &cobra.Command{
 		Use:   "pkg",
 		Short: "Manage packages",
+		Long: `Manage packages.
+
+The exit code of a failing command indicates the kind of failure:
+  1: generic error
+  2: package not found
+  3: ambiguous package (more than one package matches)
+  4: no solution for the package constraints
+  5: invalid package specification (package.yaml)
+  6: download failure`,
 	}
 	cmd.PersistentFlags().String("project-root", "", "specify the project root")
 	cmd.PersistentFlags().Bool("auto-sync", true, "automatically synchronize registries")
 	cmd.PersistentFlags().String("sdk-version", "", "specify the SDK version")
+	cmd.PersistentFlags().String("message-format", "text", "format of errors, warnings and infos (valid: 'text', 'json')")
 
 	initCmd := &cobra.Command{
 		Use:   "init",
@@ -227,6 +281,11 @@ yet, or if the lock-file has local path dependencies (which could have their own
 dependencies changed). Recomputation of the dependencies can also be forced by
 providing the '--recompute' flag.
 
+In a workspace, all members are installed together, using the lock file of the
+workspace root. This can be done from the root or from any member. When run in
+a member, a given 'package' is added to the package file of the member. Lock
+files of members are ignored.
+
 If a 'package' is given finds the package with the given name or URL and installs it.
 The given 'package' string must uniquely identify a package in the registry.
 It is matched against all package names, and URLs. For the names, a package is considered
@@ -236,6 +295,9 @@ the '/' + string is a suffix of the URL.
 The 'package' may be suffixed by a version with a '@' separating the package name and
 the version. The version doesn't need to be complete. For example 'foo@2' installs
 the package foo with the highest version satisfying '2.0.0 <= version < 3.0.0'.
+The version may also be a constraint, like 'foo@~2.1', 'foo@2.x' or 'foo@">=1.0, <3.0"'.
+Alternatives are separated by '||': 'foo@"^1.0.0 || ^2.0.0"'.
+Prereleases are only installed if the version mentions a prerelease, like 'foo@^2.0.0-beta'.
 Note: the version constraint in the package.yaml is set to accept semver compatible
 versions. If necessary, modify the constraint in that file.
 
@@ -287,9 +349,10 @@ contain local packages.
 	installCmd.Flags().Bool("recompute", false, "Recompute dependencies")
 	installCmd.Flags().String("name", "", "The name used for the 'import' clause. Deprecated: use '--prefix' instead")
 	installCmd.Flags().String("prefix", "", "The prefix used for the 'import' clause")
+	addOutputFlag(installCmd)
 	cmd.AddCommand(installCmd)
 
-	cmd.AddCommand(&cobra.Command{
+	uninstallCmd := &cobra.Command{
 		Use:   "uninstall <name>",
 		Short: "Uninstalls the package with the given name",
 		Long: `Uninstalls the package with the given name.
@@ -299,8 +362,11 @@ The downloaded code is not automatically deleted.
 `,
 		Run:  errorCfgRun(handler.pkgUninstall),
 		Args: cobra.ExactArgs(1),
-	})
-	cmd.AddCommand(&cobra.Command{
+	}
+	addOutputFlag(uninstallCmd)
+	cmd.AddCommand(uninstallCmd)
+
+	updateCmd := &cobra.Command{
 		Use:   "update",
 		Short: "Updates all packages to their newest versions",
 		Long: `Updates all packages to their newest compatible version.
@@ -308,10 +374,15 @@ The downloaded code is not automatically deleted.
 Uses semantic versioning to find the highest compatible version
 of each imported package (and their transitive dependencies).
 It then updates all packages to these versions.
+
+Dependencies with a git 'ref' are fetched again, and are locked
+to the commit the ref points to now.
 `,
 		Run:  errorCfgRun(handler.pkgUpdate),
 		Args: cobra.NoArgs,
-	})
+	}
+	addOutputFlag(updateCmd)
+	cmd.AddCommand(updateCmd)
 
 	cmd.AddCommand(&cobra.Command{
 		Use:   "clean",
@@ -354,20 +425,42 @@ only the packages from that registry are shown.`,
 		Args: cobra.MaximumNArgs(1),
 	}
 	listCmd.Flags().BoolP("verbose", "v", false, "Show more information")
-	listCmd.Flags().StringP("output", "o", "list", "Defines the output format (valid: 'list', 'json')")
+	addOutputFlag(listCmd)
 	cmd.AddCommand(listCmd)
 
 	searchCmd := &cobra.Command{
-		Use:   "search <name>",
-		Short: "Searches for the given name in all packages",
-		Long: `Searches for the given 'name'.
-
-Searches in the name, and description entries, as well as in the URLs of
-the packages.`,
+		Use:   "search <query>...",
+		Short: "Searches for the given query in all packages",
+		Long: `Searches for the given 'query'.
+
+Searches in the name, keywords and description entries, as well as in the
+URLs and the other metadata of the packages. Packages must match all terms
+of the query. Small typos in names and keywords are tolerated.
+
+Terms of the form 'field:value' restrict the search to the given field:
+  name:<name>         the name contains the given name.
+  license:<id>        the package has the given license.
+  keyword:<keyword>   the package has the given keyword (alias 'topic:').
+  sdk:<version>       the package works with the given SDK version.
+  target:<target>     the package supports the given target.
+  url:<url>           the URL contains the given string.
+
+The results are ranked: exact name matches come first, followed by
+name prefixes, keywords, and description matches.`,
+		Example: `  # Search for packages related to sensors.
+  toit pkg search sensor
+
+  # Search for MIT-licensed packages that work with SDK v2.0.0.
+  toit pkg search license:MIT sdk:2.0.0
+
+  # Only show the 5 most relevant packages.
+  toit pkg search --limit 5 keyword:display`,
 		Run:  errorCfgRun(handler.pkgSearch),
-		Args: cobra.ExactArgs(1),
+		Args: cobra.MinimumNArgs(1),
 	}
 	searchCmd.Flags().BoolP("verbose", "v", false, "Show more information")
+	searchCmd.Flags().Int("limit", 0, "Show at most this many packages (0 for no limit)")
+	addOutputFlag(searchCmd)
 	cmd.AddCommand(searchCmd)
 
 	registryCmd := &cobra.Command{
@@ -429,9 +522,34 @@ only that registry is synchronized.`,
 		Run:   errorCfgRun(handler.pkgRegistriesList),
 		Args:  cobra.NoArgs,
 	}
-
+	addOutputFlag(listRegistriesCmd)
 	registryCmd.AddCommand(listRegistriesCmd)
 
+	checkRegistryCmd := &cobra.Command{
+		Use:   "check <path>",
+		Short: "Checks the descriptions of a registry",
+		Long: `Checks the descriptions of a registry.
+
+The 'path' must point to a local registry checkout. Every description is
+validated, and must be at the location that corresponds to its URL and version.
+Fields that aren't known to this version of the package manager are reported
+as warnings. (Other commands only report them as infos.)
+Each URL and version may only be described once, and every dependency must be
+satisfiable by packages of the registry.
+
+If the '--solve' flag is used, also tries to find a solution for every package
+version (that hasn't been yanked), to detect versions that can't be installed.
+
+Exits with a non-zero exit code if any problem has severity 'error'.`,
+		Example: `  # Check the registry in the current directory, as done in CI.
+  toit pkg registry check --solve .`,
+		Run:  errorCfgRun(handler.pkgRegistryCheck),
+		Args: cobra.ExactArgs(1),
+	}
+	checkRegistryCmd.Flags().Bool("solve", false, "Solve the dependencies of every package version")
+	addOutputFlag(checkRegistryCmd)
+	registryCmd.AddCommand(checkRegistryCmd)
+
 	syncToplevelCmd := &cobra.Command{
 		Use:   "sync",
 		Short: "Synchronizes all registries",
@@ -468,8 +586,271 @@ directories to make the description path unique.`,
 	describeCmd.Flags().String("out-dir", "", "Output directory of description files")
 	describeCmd.Flags().Bool("allow-local-deps", false, "Allow local dependencies and don't report them")
 	describeCmd.Flags().Bool("disallow-local-deps", false, "Always disallow local dependencies and report them as error")
+	addOutputFlag(describeCmd)
 	cmd.AddCommand(describeCmd)
 
+	lintCmd := &cobra.Command{
+		Use:   "lint [<path>]",
+		Short: "Checks whether a package is ready to be published",
+		Long: `Checks whether a package is ready to be published.
+
+If no 'path' is given, defaults to the current working directory.
+
+Reports problems, like a missing description or license, a version that isn't a
+full semantic version, dependencies on local paths, a missing README, or
+unusually big files. The package name is compared against the packages of the
+registries to detect name conflicts.
+Use '--url' to declare the URL of the package, so that earlier versions of
+the package don't count as conflicts.
+
+Exits with a non-zero exit code if any problem has severity 'error'.`,
+		Run:  errorCfgRun(handler.pkgLint),
+		Args: cobra.MaximumNArgs(1),
+	}
+	lintCmd.Flags().String("url", "", "The URL of the package")
+	lintCmd.Flags().Int64("max-file-size", tpkg.DefaultLintMaxFileSize, "Report files bigger than this size (in bytes)")
+	addOutputFlag(lintCmd)
+	cmd.AddCommand(lintCmd)
+
+	publishCmd := &cobra.Command{
+		Use:   "publish <url> <version>",
+		Short: "Publishes a package version to a local registry checkout",
+		Long: `Publishes a package version to a local registry checkout.
+
+The repository at the given URL must have a tag for the version ('v<version>', or
+'<name>-v<version>' for packages that are nested in a repository). The description
+of the package is generated from the tagged version, and written into the registry
+given by '--registry'. If the registry is a git repository, the description is
+committed, ready to be pushed, or to be used for a pull request. Use '--branch' to
+commit to a different branch than the one that is checked out.
+
+Unless '--project-root' points elsewhere, the current directory must contain the
+package. Its package file must match the one of the tagged version. This catches
+changes that were made after the version was tagged.
+
+Publishing the same version again succeeds if the description didn't change, and
+fails otherwise.`,
+		Example: `  # Publish version 1.2.0 of the morse package into a clone of the registry.
+  toit pkg publish github.com/toitware/toit-morse 1.2.0 --registry=../registry
+
+  # Commit the description to a new branch of the registry.
+  toit pkg publish github.com/toitware/toit-morse 1.2.0 --registry=../registry --branch=morse-1.2.0`,
+		Run:  errorCfgRun(handler.pkgPublish),
+		Args: cobra.ExactArgs(2),
+	}
+	publishCmd.Flags().String("registry", "", "Path to the local registry checkout")
+	publishCmd.Flags().String("branch", "", "The registry branch the description is committed to. The registry checkout stays on this branch")
+	publishCmd.Flags().BoolP("verbose", "v", false, "Show more information")
+	addOutputFlag(publishCmd)
+	cmd.AddCommand(publishCmd)
+
+	licensesCmd := &cobra.Command{
+		Use:   "licenses",
+		Short: "Lists the licenses of all dependencies",
+		Long: `Lists the licenses of all packages in the lock file.
+
+The license of a package is taken from its registry description. If the
+package isn't in any registry, the license is taken from the package file, or
+detected from the license files (LICENSE, COPYING, ...) of the downloaded
+package.
+
+If the project has a license policy file ('license-policy.yaml' next to the
+package file), or if one is given with '--policy', the licenses are checked
+against it. The command then fails if any license isn't allowed. Local path
+packages are part of the project and aren't checked.
+
+The policy file has the following format:
+
+  # Only these licenses are allowed. If empty, all licenses that aren't
+  # denied are allowed.
+  allow: [MIT, Apache-2.0, BSD-3-Clause]
+  # These licenses are never allowed.
+  deny: [GPL-3.0]
+  # Whether packages with unknown licenses are allowed.
+  allow-unknown: false
+
+Entries are SPDX license IDs, optionally with an exception
+('GPL-2.0-only WITH Classpath-exception-2.0'). An entry like 'GPL-3.0' also
+matches the '-only' and '-or-later' variants. Licenses of packages may be SPDX
+expressions. A package is allowed if one of the choices of its license
+expression is allowed. For example, 'GPL-3.0-only OR MIT' is allowed if 'MIT' is.
+
+'toit pkg install' and 'toit pkg update' enforce the project's license policy.`,
+		Example: `  # List the licenses of the dependencies.
+  toit pkg licenses
+
+  # Check the dependencies against a policy in CI.
+  toit pkg licenses --policy=ci/license-policy.yaml`,
+		Run:  errorCfgRun(handler.pkgLicenses),
+		Args: cobra.NoArgs,
+	}
+	licensesCmd.Flags().String("policy", "", "Path to a license policy file")
+	addOutputFlag(licensesCmd)
+	cmd.AddCommand(licensesCmd)
+
+	sbomCmd := &cobra.Command{
+		Use:   "sbom",
+		Short: "Prints a software bill of materials of the project",
+		Long: `Prints a software bill of materials (SBOM) of the project.
+
+The bill of materials lists all packages of the lock file, with their version,
+URL, git hash, license, and dependencies. Local path packages are marked as
+such. The license of a package is taken from its registry description. If the
+package isn't in any registry, the license is taken from the package file, or
+detected from the license files (LICENSE, COPYING, ...) of the downloaded
+package.
+
+Supported formats are 'spdx-json' (SPDX 2.3) and 'cyclonedx-json' (CycloneDX 1.5).`,
+		Example: `  # Write an SPDX bill of materials.
+  toit pkg sbom > sbom.spdx.json
+
+  # Write a CycloneDX bill of materials.
+  toit pkg sbom --format=cyclonedx-json > sbom.cdx.json`,
+		Run:  errorCfgRun(handler.pkgSBOM),
+		Args: cobra.NoArgs,
+	}
+	sbomCmd.Flags().String("format", string(tpkg.SBOMFormatSPDX), "The format of the bill of materials: 'spdx-json' or 'cyclonedx-json'")
+	cmd.AddCommand(sbomCmd)
+
+	checkImportsCmd := &cobra.Command{
+		Use:   "check-imports",
+		Short: "Checks the imports of the project against its dependencies",
+		Long: `Checks the imports of the project against its dependencies.
+
+Scans the Toit files in the 'src' and 'tests' directories for 'import'
+statements, and reports:
+- dependencies of the package file that no file imports, and
+- imports that are neither of a dependency nor of an SDK library.
+
+Relative imports (starting with '.') are ignored. Dev dependencies may be
+imported, but aren't reported when they are unused. The package may import
+itself by its name.
+
+If the 'tests' directory has its own package file, the tests are checked
+against the dependencies of that file instead.
+
+SDK libraries are taken from the SDK library directory given with
+'--sdk-lib-path'. Without it, the library directory is found through the
+compiler in the TOITC environment variable, or through the 'toit' executable
+in the PATH. If neither works, a built-in list of SDK libraries is used.
+
+With '--fix', unused dependencies are removed from the package file, and the
+lock file is updated. Missing dependencies must be installed with
+'toit pkg install'.`,
+		Example: `  # Check the imports of the project.
+  toit pkg check-imports
+
+  # Remove dependencies that aren't imported.
+  toit pkg check-imports --fix`,
+		Run:  errorCfgRun(handler.pkgCheckImports),
+		Args: cobra.NoArgs,
+	}
+	checkImportsCmd.Flags().Bool("fix", false, "Remove unused dependencies from the package file")
+	checkImportsCmd.Flags().String("sdk-lib-path", "", "The library directory of the SDK")
+	addOutputFlag(checkImportsCmd)
+	cmd.AddCommand(checkImportsCmd)
+
+	outdatedCmd := &cobra.Command{
+		Use:   "outdated",
+		Short: "Lists the dependencies that have newer versions",
+		Long: `Lists the packages of the lock file that have newer versions.
+
+For each registry package of the lock file, the newest version in the
+registries is shown if it is newer than the locked one. Yanked versions and
+prereleases are ignored.
+
+Packages whose locked version was yanked, or that are deprecated, are listed
+too, and reported as warnings. Local and git packages aren't checked.`,
+		Example: `  # List the outdated dependencies.
+  toit pkg outdated`,
+		Run:  errorCfgRun(handler.pkgOutdated),
+		Args: cobra.NoArgs,
+	}
+	addOutputFlag(outdatedCmd)
+	cmd.AddCommand(outdatedCmd)
+
+	versionCmd := &cobra.Command{
+		Use:   "version",
+		Short: "Manages the version of a package",
+	}
+	cmd.AddCommand(versionCmd)
+
+	versionBumpCmd := &cobra.Command{
+		Use:   "bump <major|minor|patch|version>",
+		Short: "Tags the next version of a package",
+		Long: `Tags the next version of a package.
+
+The next version is computed from the highest 'v<version>' tag of the package
+repository. If the repository doesn't have any version tag yet, the version is
+bumped from 0.0.0. An explicit version must be higher than the latest one.
+
+If the package file has a 'version' entry, it is updated to the new version and
+the change is committed. Then an annotated tag 'v<version>' is created for the
+checked out commit. The tag is signed if '--sign-key' is given. The passphrase
+of an encrypted key is read from the TOIT_PKG_SIGN_KEY_PASSPHRASE environment
+variable.
+
+Unless '--project-root' points elsewhere, the current directory must be the root
+of the package repository. The working tree must be clean.
+
+Neither the commit nor the tag are pushed.`,
+		Example: `  # Tag the next minor version.
+  toit pkg version bump minor
+
+  # Tag version 2.0.0 and sign the tag.
+  toit pkg version bump 2.0.0 --sign-key=private.asc`,
+		Run:  errorCfgRun(handler.pkgVersionBump),
+		Args: cobra.ExactArgs(1),
+	}
+	versionBumpCmd.Flags().String("sign-key", "", "Path to an armored OpenPGP private key to sign the tag with")
+	addOutputFlag(versionBumpCmd)
+	versionCmd.AddCommand(versionBumpCmd)
+
+	cacheCmd := &cobra.Command{
+		Use:   "cache",
+		Short: "Inspects the package cache",
+	}
+	cmd.AddCommand(cacheCmd)
+
+	cacheListCmd := &cobra.Command{
+		Use:   "list",
+		Short: "Lists all cached packages and registries",
+		Long: `Lists all cached packages and registries.
+
+Packages are listed in search order: first the packages of the current project,
+followed by the packages in the package cache paths (as given by
+TOIT_PACKAGE_CACHE_PATHS). Each package is listed with its size on disk and,
+if known, its git hash. Registries are listed with the commit that is
+currently checked out.
+
+Use '--verbose' to also show the paths of the packages and registries.`,
+		Run:  errorCfgRun(handler.pkgCacheList),
+		Args: cobra.NoArgs,
+	}
+	cacheListCmd.Flags().BoolP("verbose", "v", false, "Show more information")
+	addOutputFlag(cacheListCmd)
+	cacheCmd.AddCommand(cacheListCmd)
+
+	cachePathCmd := &cobra.Command{
+		Use:   "path <url>@<version>",
+		Short: "Prints the path of a cached package",
+		Long: `Prints the path of the cached package with the given URL and version.
+
+Packages are first searched in the package directory of the current project,
+and then in the package cache paths (as given by TOIT_PACKAGE_CACHE_PATHS).
+The first match is the one that is used.
+
+If the '--all' flag is given, prints all copies of the package in search order.`,
+		Example: `  # Print the path of version 1.0.6 of the morse package.
+  toit pkg cache path github.com/toitware/toit-morse@1.0.6
+`,
+		Run:  errorCfgRun(handler.pkgCachePath),
+		Args: cobra.ExactArgs(1),
+	}
+	cachePathCmd.Flags().Bool("all", false, "Print all copies of the package")
+	addOutputFlag(cachePathCmd)
+	cacheCmd.AddCommand(cachePathCmd)
+
 	return cmd, nil
 }
 
@@ -495,6 +876,37 @@ func newExitError(code int) *exitError {
 	}
 }
 
+const (
+	exitCodeError           = 1
+	exitCodePackageNotFound = 2
+	exitCodeAmbiguous       = 3
+	exitCodeNoSolution      = 4
+	exitCodeInvalidSpec     = 5
+	exitCodeDownload        = 6
+)
+
+// exitCodeFor returns the exit code for the given (reported) error.
+func exitCodeFor(err error) int {
+	var notFoundErr *tpkg.PackageNotFoundError
+	var ambiguousErr *tpkg.AmbiguousPackageError
+	var noSolutionErr *tpkg.NoSolutionError
+	var invalidSpecErr *tpkg.InvalidSpecError
+	var downloadErr *tpkg.DownloadError
+	switch {
+	case errors.As(err, &notFoundErr):
+		return exitCodePackageNotFound
+	case errors.As(err, &ambiguousErr):
+		return exitCodeAmbiguous
+	case errors.As(err, &noSolutionErr):
+		return exitCodeNoSolution
+	case errors.As(err, &invalidSpecErr):
+		return exitCodeInvalidSpec
+	case errors.As(err, &downloadErr):
+		return exitCodeDownload
+	}
+	return exitCodeError
+}
+
 var tpkgUI = tpkg.FmtUI
 
 func (h *pkgHandler) pkgInstall(cmd *cobra.Command, args []string) error {
@@ -518,10 +930,16 @@ func (h *pkgHandler) pkgInstall(cmd *cobra.Command, args []string) error {
 		if err != nil {
 			return err
 		}
-		if cwd != m.Paths.ProjectRootPath {
+		// Workspace members are installed from their own directory.
+		inWorkspaceMember := cwd == m.Paths.WorkspaceMemberPath
+		if cwd != m.Paths.ProjectRootPath && !inWorkspaceMember {
+			projectRoot := m.Paths.ProjectRootPath
+			if m.Paths.WorkspaceMemberPath != "" {
+				projectRoot = m.Paths.WorkspaceMemberPath
+			}
 			// Add the project-root flag, and rebuild the command line.
 			args := os.Args
-			args = append(args, "--project-root="+m.Paths.ProjectRootPath)
+			args = append(args, "--project-root="+projectRoot)
 			quoted := []string{}
 			for _, arg := range args {
 				quoted = append(quoted, shellescape.Quote(arg))
@@ -557,6 +975,24 @@ func (h *pkgHandler) pkgInstall(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
+	output, err := getOutputFormat(cmd)
+	if err != nil {
+		return err
+	}
+	installed := []InstalledPackageOutput{}
+	printInstallOutput := func() error {
+		if output != outputJSON {
+			return nil
+		}
+		lf, err := tpkg.ReadLockFile(m.Paths.LockFile)
+		if err != nil {
+			return err
+		}
+		return printJSON(InstallOutput{
+			Installed: installed,
+			LockFile:  lf,
+		})
+	}
 
 	if len(args) == 0 {
 		if isLocal {
@@ -580,7 +1016,7 @@ func (h *pkgHandler) pkgInstall(cmd *cobra.Command, args []string) error {
 			return err
 
 		}
-		return nil
+		return printInstallOutput()
 	}
 
 	if forceRecompute {
@@ -590,7 +1026,14 @@ func (h *pkgHandler) pkgInstall(cmd *cobra.Command, args []string) error {
 	reportInstalledPkg := func(pkgString string, installedPrefix string) {
 		// TODO(florian): Change the output to 'with prefix'.
 		//  Delaying this change to avoid merge conflicts with other pull requests.
-		tpkgUI.ReportInfo("Package '%s' installed with name '%s'", pkgString, installedPrefix)
+		if output == outputJSON {
+			installed = append(installed, InstalledPackageOutput{
+				Package: pkgString,
+				Prefix:  installedPrefix,
+			})
+		} else {
+			h.ui.ReportInfo("Package '%s' installed with name '%s'", pkgString, installedPrefix)
+		}
 
 		h.track(ctx, &tracking.Event{
 			Name: "toit pkg install",
@@ -626,17 +1069,33 @@ func (h *pkgHandler) pkgInstall(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	return nil
+	return printInstallOutput()
 }
 
 func (h *pkgHandler) pkgUninstall(cmd *cobra.Command, args []string) error {
 	ctx := cmd.Context()
+	output, err := getOutputFormat(cmd)
+	if err != nil {
+		return err
+	}
 	m, err := h.buildProjectPkgManager(cmd, false)
 	if err != nil {
 		return err
 	}
-	return m.Uninstall(ctx, args[0])
-
+	if err := m.Uninstall(ctx, args[0]); err != nil {
+		return err
+	}
+	if output != outputJSON {
+		return nil
+	}
+	lf, err := tpkg.ReadLockFile(m.Paths.LockFile)
+	if err != nil {
+		return err
+	}
+	return printJSON(UninstallOutput{
+		Uninstalled: args[0],
+		LockFile:    lf,
+	})
 }
 
 func (h *pkgHandler) pkgUpdate(cmd *cobra.Command, args []string) error {
@@ -645,11 +1104,27 @@ func (h *pkgHandler) pkgUpdate(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
+	output, err := getOutputFormat(cmd)
+	if err != nil {
+		return err
+	}
 	m, err := h.buildProjectPkgManager(cmd, shouldAutoSync)
 	if err != nil {
 		return err
 	}
-	return m.Update(ctx)
+	if err := m.Update(ctx); err != nil {
+		return err
+	}
+	if output != outputJSON {
+		return nil
+	}
+	lf, err := tpkg.ReadLockFile(m.Paths.LockFile)
+	if err != nil {
+		return err
+	}
+	return printJSON(UpdateOutput{
+		LockFile: lf,
+	})
 }
 
 func (h *pkgHandler) pkgClean(cmd *cobra.Command, args []string) error {
@@ -690,7 +1165,7 @@ func (h *pkgHandler) pkgInit(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	err = tpkg.InitDirectory(projectRoot, name, description, tpkgUI)
+	err = tpkg.InitDirectory(projectRoot, name, description, h.ui)
 	if IsAlreadyExistsError(err) {
 		return h.ui.ReportError(ErrorMessage(err))
 	} else if err != nil {
@@ -706,27 +1181,37 @@ func (h *pkgHandler) loadUserRegistries(ctx context.Context, shouldAutoSync bool
 	return configs.Load(ctx, shouldAutoSync, cache, h.ui)
 }
 
-func printDesc(d *tpkg.Desc, indent string, isVerbose bool, isJson bool) {
-	if isJson {
-		md, err := json.Marshal(d)
-		if err != nil {
-			log.Fatal("Unexpected error marshaling description. %w", err)
+func printDesc(d *tpkg.Desc, indent string, isVerbose bool) {
+	if !isVerbose {
+		suffix := ""
+		if d.Yanked != "" {
+			suffix = " (yanked)"
+		} else if d.Deprecated != nil {
+			suffix = " (deprecated)"
 		}
-		fmt.Println(string(md))
+		fmt.Printf("%s%s - %s%s\n", indent, d.Name, d.Version, suffix)
 		return
 	}
-	if !isVerbose {
-		fmt.Printf("%s%s - %s\n", indent, d.Name, d.Version)
-		return
+	funcs := template.FuncMap{
+		"join": strings.Join,
 	}
-	tmpl := template.Must(template.New("description").Parse(`{{.Name}}:
+	tmpl := template.Must(template.New("description").Funcs(funcs).Parse(`{{.Name}}:
   description: {{.Description}}
   url: {{.URL}}
   version: {{.Version}}
-  {{if .Environment.SDK}}environment:
-    sdk: {{.Environment.SDK}}
+  {{if or .Environment.SDK .Environment.Targets}}environment:{{if .Environment.SDK}}
+    sdk: {{.Environment.SDK}}{{end}}{{if .Environment.Targets}}
+    targets: {{join .Environment.Targets ", "}}{{end}}
   {{end}}{{if .License}}license: {{.License}}
+  {{end}}{{if .Authors}}authors: {{join .Authors ", "}}
+  {{end}}{{if .Homepage}}homepage: {{.Homepage}}
+  {{end}}{{if .Repository}}repository: {{.Repository}}
+  {{end}}{{if .Documentation}}documentation: {{.Documentation}}
+  {{end}}{{if .Keywords}}keywords: {{join .Keywords ", "}}
+  {{end}}{{if .Readme}}readme: {{.Readme}}
   {{end}}{{if .Hash}}hash: {{.Hash}}
+  {{end}}{{if .Yanked}}yanked: {{.Yanked}}
+  {{end}}{{if .Deprecated}}deprecated: {{.Deprecated.Message}}{{if .Deprecated.Replacement}} (use {{.Deprecated.Replacement}}){{end}}
   {{end}}{{if .Deps }}Dependencies:{{ range $_, $d := .Deps }}
     {{$d.URL}} - {{$d.Version}}{{ end}}{{end}}`))
 	out := bytes.Buffer{}
@@ -759,11 +1244,10 @@ func (h *pkgHandler) pkgList(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
-	output, err := cmd.Flags().GetString("output")
+	output, err := getOutputFormat(cmd)
 	if err != nil {
 		return err
 	}
-	isJson := output == "json"
 
 	if len(args) == 1 {
 		registry := tpkg.NewLocalRegistry("", args[0])
@@ -778,17 +1262,46 @@ func (h *pkgHandler) pkgList(cmd *cobra.Command, args []string) error {
 			registry,
 		}
 	}
+	if output == outputJSON {
+		result := ListOutput{
+			Registries: []RegistryPackagesOutput{},
+		}
+		for _, registry := range registries {
+			entries := registry.Entries()
+			if entries == nil {
+				entries = []*tpkg.Desc{}
+			}
+			result.Registries = append(result.Registries, RegistryPackagesOutput{
+				Name:        registry.Name(),
+				Description: registry.Describe(),
+				Packages:    entries,
+			})
+		}
+		return printJSON(result)
+	}
 	for _, registry := range registries {
 		fmt.Printf("%s:\n", registry.Describe())
 		for _, desc := range registry.Entries() {
-			printDesc(desc, "  ", isVerbose, isJson)
+			printDesc(desc, "  ", isVerbose)
 		}
 	}
 	return nil
 }
 
 func (h *pkgHandler) pkgRegistriesList(cmd *cobra.Command, args []string) error {
+	output, err := getOutputFormat(cmd)
+	if err != nil {
+		return err
+	}
 	configs := h.getRegistryConfigsOrDefault()
+	if output == outputJSON {
+		if configs == nil {
+			configs = tpkg.RegistryConfigs{}
+		}
+		return printJSON(RegistryListOutput{
+			Registries: configs,
+		})
+	}
 	for _, config := range configs {
 		fmt.Printf("%s: %s (%s)\n", config.Name, config.Path, config.Kind)
 	}
@@ -957,11 +1470,12 @@ func (h *pkgHandler) pkgRegistrySync(cmd *cobra.Command, args []string) error {
 
 func (h *pkgHandler) pkgSearch(cmd *cobra.Command, args []string) error {
 	ctx := cmd.Context()
+	queryStr := strings.Join(args, " ")
 
 	h.track(ctx, &tracking.Event{
 		Name: "toit pkg search",
 		Properties: map[string]string{
-			"query": args[0],
+			"query": queryStr,
 		},
 	})
 
@@ -981,8 +1495,24 @@ func (h *pkgHandler) pkgSearch(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
+	output, err := getOutputFormat(cmd)
+	if err != nil {
+		return err
+	}
+	limit, err := cmd.Flags().GetInt("limit")
+	if err != nil {
+		return err
+	}
+	if limit < 0 {
+		h.ui.ReportError("The limit must not be negative: %d", limit)
+		return newExitError(1)
+	}
+	query, err := tpkg.ParseSearchQuery(queryStr, h.ui)
+	if err != nil {
+		return err
+	}
 
-	found, err := tpkg.Registries(registries).SearchAll(args[0])
+	found, err := tpkg.Registries(registries).SearchAll(queryStr)
 	if err != nil {
 		return err
 	}
@@ -990,8 +1520,22 @@ func (h *pkgHandler) pkgSearch(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
+	// Removing the lower versions sorted the packages by URL.
+	found.SortByRelevance(query)
+	if limit > 0 && len(found) > limit {
+		found = found[:limit]
+	}
+	if output == outputJSON {
+		result := SearchOutput{
+			Packages: []*tpkg.Desc{},
+		}
+		for _, descReg := range found {
+			result.Packages = append(result.Packages, descReg.Desc)
+		}
+		return printJSON(result)
+	}
 	for _, descReg := range found {
-		printDesc(descReg.Desc, "", isVerbose, false)
+		printDesc(descReg.Desc, "", isVerbose)
 	}
 	return nil
 }
@@ -1005,6 +1549,10 @@ func (h *pkgHandler) pkgDescribe(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
+	output, err := getOutputFormat(cmd)
+	if err != nil {
+		return err
+	}
 	var desc *tpkg.Desc
 	if len(args) < 2 && outDir != "" {
 		h.ui.ReportError("The --out-dir flag requires a URL and version")
@@ -1059,13 +1607,634 @@ func (h *pkgHandler) pkgDescribe(cmd *cobra.Command, args []string) error {
 		return err
 	}
 	if outDir == "" {
-		printDesc(desc, "", true, false)
+		if output == outputJSON {
+			return printJSON(DescribeOutput{
+				Package: desc,
+			})
+		}
+		printDesc(desc, "", true)
 		return nil
 	}
 	descPath, err := desc.WriteInDir(outDir)
 	if err != nil {
 		return err
 	}
+	if output == outputJSON {
+		return printJSON(DescribeOutput{
+			Package: desc,
+			Path:    descPath,
+		})
+	}
 	h.ui.ReportInfo("Wrote '%s'", descPath)
 	return nil
 }
+
+func (h *pkgHandler) pkgLint(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	url, err := cmd.Flags().GetString("url")
+	if err != nil {
+		return err
+	}
+	maxFileSize, err := cmd.Flags().GetInt64("max-file-size")
+	if err != nil {
+		return err
+	}
+	output, err := getOutputFormat(cmd)
+	if err != nil {
+		return err
+	}
+	path := "."
+	if len(args) == 1 {
+		path = args[0]
+	}
+	cache, err := h.buildCache()
+	if err != nil {
+		return err
+	}
+	shouldAutoSync, err := cmd.Flags().GetBool("auto-sync")
+	if err != nil {
+		return err
+	}
+	registries, err := h.loadUserRegistries(ctx, shouldAutoSync, cache)
+	if err != nil {
+		return err
+	}
+
+	diagnostics, err := tpkg.Lint(path, tpkg.LintOptions{
+		Registries:  registries,
+		URL:         url,
+		MaxFileSize: maxFileSize,
+	}, h.ui)
+	if err != nil {
+		return err
+	}
+
+	if output == outputJSON {
+		if err := printJSON(LintOutput{Diagnostics: diagnostics}); err != nil {
+			return err
+		}
+	} else {
+		h.printDiagnostics(diagnostics)
+	}
+	if hasLintErrors(diagnostics) {
+		return newExitError(exitCodeError)
+	}
+	return nil
+}
+
+func (h *pkgHandler) printDiagnostics(diagnostics []tpkg.LintDiagnostic) {
+	for _, diagnostic := range diagnostics {
+		location := ""
+		if diagnostic.Path != "" {
+			location = diagnostic.Path + ": "
+		}
+		fmt.Printf("%s%s: %s [%s]\n", location, diagnostic.Severity, diagnostic.Message, diagnostic.Check)
+	}
+	if len(diagnostics) == 0 {
+		h.ui.ReportInfo("No problems found")
+	}
+}
+
+func hasLintErrors(diagnostics []tpkg.LintDiagnostic) bool {
+	for _, diagnostic := range diagnostics {
+		if diagnostic.Severity == tpkg.LintError {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *pkgHandler) pkgRegistryCheck(cmd *cobra.Command, args []string) error {
+	solve, err := cmd.Flags().GetBool("solve")
+	if err != nil {
+		return err
+	}
+	output, err := getOutputFormat(cmd)
+	if err != nil {
+		return err
+	}
+	diagnostics, err := tpkg.CheckRegistry(args[0], tpkg.RegistryCheckOptions{
+		Solve: solve,
+	}, h.ui)
+	if err != nil {
+		return err
+	}
+	if output == outputJSON {
+		if err := printJSON(RegistryCheckOutput{Diagnostics: diagnostics}); err != nil {
+			return err
+		}
+	} else {
+		h.printDiagnostics(diagnostics)
+	}
+	if hasLintErrors(diagnostics) {
+		return newExitError(exitCodeError)
+	}
+	return nil
+}
+
+func (h *pkgHandler) pkgPublish(cmd *cobra.Command, args []string) error {
+	isVerbose, err := cmd.Flags().GetBool("verbose")
+	if err != nil {
+		return err
+	}
+	registryPath, err := cmd.Flags().GetString("registry")
+	if err != nil {
+		return err
+	}
+	if registryPath == "" {
+		h.ui.ReportError("Missing '--registry' flag")
+		return newExitError(1)
+	}
+	branch, err := cmd.Flags().GetString("branch")
+	if err != nil {
+		return err
+	}
+	projectRoot, err := cmd.Flags().GetString("project-root")
+	if err != nil {
+		return err
+	}
+	output, err := getOutputFormat(cmd)
+	if err != nil {
+		return err
+	}
+	if projectRoot == "" {
+		projectRoot, err = os.Getwd()
+		if err != nil {
+			return err
+		}
+	}
+
+	ctx := cmd.Context()
+	h.track(ctx, &tracking.Event{
+		Name: "toit pkg publish",
+		Properties: map[string]string{
+			"url":     args[0],
+			"version": args[1],
+		},
+	})
+	result, err := tpkg.Publish(ctx, tpkg.PublishOptions{
+		URL:          args[0],
+		Version:      args[1],
+		ProjectPath:  projectRoot,
+		RegistryPath: registryPath,
+		Branch:       branch,
+		IsVerbose:    isVerbose,
+	}, h.ui)
+	if err != nil {
+		return err
+	}
+	if output == outputJSON {
+		return printJSON(PublishOutput{
+			Package:          result.Desc,
+			Path:             result.Path,
+			Commit:           result.Commit,
+			Branch:           result.Branch,
+			AlreadyPublished: result.AlreadyPublished,
+		})
+	}
+	if result.AlreadyPublished {
+		h.ui.ReportInfo("Registry already contains '%s'", result.Path)
+	} else if result.Commit != "" && result.Branch != "" {
+		h.ui.ReportInfo("Committed '%s' (%s) to branch '%s'", result.Path, result.Commit, result.Branch)
+	} else if result.Commit != "" {
+		h.ui.ReportInfo("Committed '%s' (%s)", result.Path, result.Commit)
+	} else {
+		h.ui.ReportInfo("Wrote '%s'", result.Path)
+	}
+	return nil
+}
+
+func (h *pkgHandler) pkgLicenses(cmd *cobra.Command, args []string) error {
+	policyPath, err := cmd.Flags().GetString("policy")
+	if err != nil {
+		return err
+	}
+	output, err := getOutputFormat(cmd)
+	if err != nil {
+		return err
+	}
+	m, err := h.buildProjectPkgManager(cmd, false)
+	if err != nil {
+		return err
+	}
+	h.track(cmd.Context(), &tracking.Event{
+		Name: "toit pkg licenses",
+	})
+
+	var policy *tpkg.LicensePolicy
+	if policyPath != "" {
+		policy, err = tpkg.ReadLicensePolicy(policyPath, h.ui)
+	} else {
+		policy, err = m.LicensePolicy()
+	}
+	if err != nil {
+		return err
+	}
+	licenses, err := m.Licenses(policy)
+	if err != nil {
+		return err
+	}
+
+	hasViolations := false
+	for _, pl := range licenses {
+		if pl.Violation != "" {
+			hasViolations = true
+		}
+	}
+
+	if output == outputJSON {
+		packages := []PackageLicenseOutput{}
+		for _, pl := range licenses {
+			packages = append(packages, PackageLicenseOutput{
+				ID:        pl.ID,
+				Name:      pl.Name,
+				Version:   pl.Version,
+				URL:       pl.URL,
+				Path:      pl.LocalPath,
+				License:   pl.License,
+				Violation: pl.Violation,
+			})
+		}
+		if err := printJSON(LicensesOutput{Packages: packages}); err != nil {
+			return err
+		}
+	} else {
+		for _, pl := range licenses {
+			license := pl.License
+			if license == "" {
+				license = "unknown"
+			}
+			if pl.LocalPath != "" {
+				fmt.Printf("%s (local): %s\n", pl.LocalPath, license)
+			} else {
+				fmt.Printf("%s@%s: %s\n", pl.URL, pl.Version, license)
+			}
+		}
+	}
+	if hasViolations {
+		for _, pl := range licenses {
+			if pl.Violation != "" {
+				h.ui.ReportError("Package %s %s", pl, pl.Violation)
+			}
+		}
+		return newExitError(exitCodeError)
+	}
+	return nil
+}
+
+func (h *pkgHandler) pkgSBOM(cmd *cobra.Command, args []string) error {
+	format, err := cmd.Flags().GetString("format")
+	if err != nil {
+		return err
+	}
+	sbomFormat := tpkg.SBOMFormat(format)
+	if sbomFormat != tpkg.SBOMFormatSPDX && sbomFormat != tpkg.SBOMFormatCycloneDX {
+		h.ui.ReportError("Invalid format '%s'. Must be '%s' or '%s'", format, tpkg.SBOMFormatSPDX, tpkg.SBOMFormatCycloneDX)
+		return newExitError(exitCodeError)
+	}
+	m, err := h.buildProjectPkgManager(cmd, false)
+	if err != nil {
+		return err
+	}
+	h.track(cmd.Context(), &tracking.Event{
+		Name: "toit pkg sbom",
+		Properties: map[string]string{
+			"format": format,
+		},
+	})
+	sbom, err := m.BuildSBOM()
+	if err != nil {
+		return err
+	}
+	return sbom.Write(os.Stdout, sbomFormat, time.Now())
+}
+
+func (h *pkgHandler) pkgCheckImports(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	fix, err := cmd.Flags().GetBool("fix")
+	if err != nil {
+		return err
+	}
+	sdkLibPath, err := cmd.Flags().GetString("sdk-lib-path")
+	if err != nil {
+		return err
+	}
+	if sdkLibPath == "" {
+		if p, ok := config.SDKLibPath(); ok {
+			sdkLibPath = p
+		} else {
+			h.ui.ReportInfo("Couldn't find the SDK library directory. Using a built-in list of SDK libraries")
+		}
+	}
+	output, err := getOutputFormat(cmd)
+	if err != nil {
+		return err
+	}
+	m, err := h.buildProjectPkgManager(cmd, false)
+	if err != nil {
+		return err
+	}
+	h.track(ctx, &tracking.Event{
+		Name: "toit pkg check-imports",
+		Properties: map[string]string{
+			"fix": strconv.FormatBool(fix),
+		},
+	})
+	check, err := m.CheckImports(sdkLibPath)
+	if err != nil {
+		return err
+	}
+
+	removed := []string{}
+	unused := check.Unused
+	if fix && len(unused) > 0 {
+		if err := m.RemoveDeps(ctx, unused); err != nil {
+			return err
+		}
+		removed = unused
+		unused = []string{}
+	}
+
+	if output == outputJSON {
+		if err := printJSON(CheckImportsOutput{
+			Unused:  unused,
+			Missing: check.Missing,
+			Removed: removed,
+		}); err != nil {
+			return err
+		}
+	} else {
+		for _, prefix := range removed {
+			h.ui.ReportInfo("Removed unused dependency '%s'", prefix)
+		}
+		for _, prefix := range unused {
+			fmt.Printf("%s: unused dependency '%s'\n", tpkg.DefaultSpecName, prefix)
+		}
+		for _, imp := range check.Missing {
+			fmt.Printf("%s:%d: missing dependency '%s' for import '%s'\n", imp.File, imp.Line, imp.Prefix(), imp.Path)
+		}
+		if len(removed) == 0 && len(unused) == 0 && len(check.Missing) == 0 {
+			h.ui.ReportInfo("No problems found")
+		}
+	}
+	if len(unused) > 0 || len(check.Missing) > 0 {
+		return newExitError(exitCodeError)
+	}
+	return nil
+}
+
+func (h *pkgHandler) pkgOutdated(cmd *cobra.Command, args []string) error {
+	output, err := getOutputFormat(cmd)
+	if err != nil {
+		return err
+	}
+	m, err := h.buildProjectPkgManager(cmd, false)
+	if err != nil {
+		return err
+	}
+	h.track(cmd.Context(), &tracking.Event{
+		Name: "toit pkg outdated",
+	})
+	outdated, err := m.Outdated()
+	if err != nil {
+		return err
+	}
+
+	if output == outputJSON {
+		return printJSON(OutdatedOutput{
+			Packages: outdated,
+		})
+	}
+	for _, p := range outdated {
+		line := p.URL + " " + p.Version
+		if p.Latest != "" {
+			line += " -> " + p.Latest
+		}
+		if p.Yanked != "" {
+			line += " (yanked)"
+		}
+		if p.Deprecated != nil {
+			line += " (deprecated)"
+		}
+		fmt.Println(line)
+	}
+	if len(outdated) == 0 {
+		h.ui.ReportInfo("All packages are up to date")
+	}
+	return nil
+}
+
+func (h *pkgHandler) pkgVersionBump(cmd *cobra.Command, args []string) error {
+	signKey, err := cmd.Flags().GetString("sign-key")
+	if err != nil {
+		return err
+	}
+	projectRoot, err := cmd.Flags().GetString("project-root")
+	if err != nil {
+		return err
+	}
+	output, err := getOutputFormat(cmd)
+	if err != nil {
+		return err
+	}
+	if projectRoot == "" {
+		projectRoot, err = os.Getwd()
+		if err != nil {
+			return err
+		}
+	}
+
+	h.track(cmd.Context(), &tracking.Event{
+		Name: "toit pkg version bump",
+		Properties: map[string]string{
+			"bump": args[0],
+		},
+	})
+	result, err := tpkg.BumpVersion(tpkg.VersionBumpOptions{
+		Path:              projectRoot,
+		Bump:              args[0],
+		SignKeyPath:       signKey,
+		SignKeyPassphrase: os.Getenv("TOIT_PKG_SIGN_KEY_PASSPHRASE"),
+	}, h.ui)
+	if err != nil {
+		return err
+	}
+	if output == outputJSON {
+		return printJSON(VersionBumpOutput{
+			Previous:    result.Previous,
+			Version:     result.Version,
+			Tag:         result.Tag,
+			Commit:      result.Commit,
+			UpdatedSpec: result.UpdatedSpec,
+		})
+	}
+	if result.UpdatedSpec {
+		h.ui.ReportInfo("Updated the version in '%s' to %s", tpkg.DefaultSpecName, result.Version)
+	}
+	h.ui.ReportInfo("Created tag '%s' (%s)", result.Tag, result.Commit)
+	return nil
+}
+
+func (h *pkgHandler) pkgCacheList(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	isVerbose, err := cmd.Flags().GetBool("verbose")
+	if err != nil {
+		return err
+	}
+	output, err := getOutputFormat(cmd)
+	if err != nil {
+		return err
+	}
+	projectRoot, err := cmd.Flags().GetString("project-root")
+	if err != nil {
+		return err
+	}
+	paths, err := tpkg.NewProjectPaths(projectRoot, "", "")
+	if err != nil {
+		return err
+	}
+	cache, err := h.buildCache()
+	if err != nil {
+		return err
+	}
+	pkgs, err := cache.ListPkgs(paths.ProjectRootPath)
+	if err != nil {
+		return err
+	}
+	cachedRegistries, err := cache.ListRegistries()
+	if err != nil {
+		return err
+	}
+
+	hasMissingHash := false
+	for _, pkg := range pkgs {
+		if pkg.Hash == "" {
+			hasMissingHash = true
+		}
+	}
+	if hasMissingHash {
+		// Packages that are nested in a repository don't have their own git
+		// checkout. Use the registries to find their hashes.
+		shouldAutoSync, err := cmd.Flags().GetBool("auto-sync")
+		if err != nil {
+			return err
+		}
+		var registries tpkg.Registries
+		registries, err = h.loadUserRegistries(ctx, shouldAutoSync, cache)
+		if err != nil {
+			return err
+		}
+		for i := range pkgs {
+			if pkgs[i].Hash != "" {
+				continue
+			}
+			found, err := registries.SearchURLVersion(pkgs[i].URL, pkgs[i].Version)
+			if err != nil {
+				return err
+			}
+			if len(found) != 0 {
+				pkgs[i].Hash = found[0].Desc.Hash
+			}
+		}
+	}
+
+	if output == outputJSON {
+		if pkgs == nil {
+			pkgs = []tpkg.CachedPkg{}
+		}
+		if cachedRegistries == nil {
+			cachedRegistries = []tpkg.CachedRegistry{}
+		}
+		return printJSON(CacheListOutput{
+			Packages:   pkgs,
+			Registries: cachedRegistries,
+		})
+	}
+
+	lastCachePath := ""
+	for _, pkg := range pkgs {
+		if pkg.CachePath != lastCachePath {
+			fmt.Printf("%s:\n", pkg.CachePath)
+			lastCachePath = pkg.CachePath
+		}
+		details := tpkg.FormatSize(pkg.Size)
+		if pkg.Hash != "" {
+			details += ", " + pkg.Hash
+		}
+		fmt.Printf("  %s - %s (%s)\n", pkg.URL, pkg.Version, details)
+		if isVerbose {
+			fmt.Printf("    path: %s\n", pkg.Path)
+		}
+	}
+
+	lastCachePath = ""
+	for _, registry := range cachedRegistries {
+		if registry.CachePath != lastCachePath {
+			fmt.Printf("%s:\n", registry.CachePath)
+			lastCachePath = registry.CachePath
+		}
+		fmt.Printf("  %s - %s\n", registry.URL, registry.Commit)
+		if isVerbose {
+			fmt.Printf("    path: %s\n", registry.Path)
+		}
+	}
+	return nil
+}
+
+func (h *pkgHandler) pkgCachePath(cmd *cobra.Command, args []string) error {
+	all, err := cmd.Flags().GetBool("all")
+	if err != nil {
+		return err
+	}
+	output, err := getOutputFormat(cmd)
+	if err != nil {
+		return err
+	}
+	projectRoot, err := cmd.Flags().GetString("project-root")
+	if err != nil {
+		return err
+	}
+	paths, err := tpkg.NewProjectPaths(projectRoot, "", "")
+	if err != nil {
+		return err
+	}
+	cache, err := h.buildCache()
+	if err != nil {
+		return err
+	}
+
+	id := args[0]
+	atPos := strings.LastIndexByte(id, '@')
+	if atPos <= 0 || atPos == len(id)-1 {
+		return h.ui.ReportError("Package must be of form '<url>@<version>': '%s'", id)
+	}
+	url := id[:atPos]
+	v, err := version.NewVersion(id[atPos+1:])
+	if err != nil {
+		return h.ui.ReportError("Invalid version: '%s'", id[atPos+1:])
+	}
+
+	found, err := cache.FindAllPkgs(paths.ProjectRootPath, url, v.String())
+	if err != nil {
+		return err
+	}
+	if len(found) == 0 {
+		h.ui.ReportError("Package '%s' not found in cache", id)
+		return &tpkg.PackageNotFoundError{
+			Name:    url,
+			Version: v.String(),
+		}
+	}
+	if !all {
+		found = found[:1]
+	}
+	if output == outputJSON {
+		return printJSON(CachePathOutput{
+			Paths: found,
+		})
+	}
+	for _, p := range found {
+		fmt.Println(p)
+	}
+	return nil
+}
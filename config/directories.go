@@ -17,6 +17,7 @@ package config
 
 import (
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strings"
 )
@@ -24,6 +25,7 @@ import (
 const (
 	packageCacheSubDir  = "tpkg"
 	registryCacheSubDir = "tpkg-registries"
+	packageStoreSubDir  = "tpkg-store"
 	// ToitPackageCachePathsEnv contains the paths where the compiler is looking for cached packages.
 	// This constant must be kept in sync with the one in the compiler.
 	ToitPackageCachePathsEnv = "TOIT_PACKAGE_CACHE_PATHS"
@@ -31,8 +33,16 @@ const (
 	ToitRegistryCachePathsEnv = "TOIT_REGISTRY_CACHE_PATHS"
 	// ToitRegistryInstallPathEnv contains the paths where tpkg will install packages for the project.
 	ToitRegistryInstallPathEnv = "TOIT_PACKAGE_INSTALL_PATH"
+	// ToitPackageStorePathEnv contains the path of the content-addressed package store.
+	// The store is opt-in: setting this variable enables it. If set to the
+	// empty string, the package store is disabled, even if the configuration
+	// enables it. Git-ref dependencies are never taken from the store.
+	ToitPackageStorePathEnv = "TOIT_PACKAGE_STORE_PATH"
 	// UserConfigDirEnv if set, will be the directory the user config will be loaded from.
 	UserConfigDirEnv = "TOIT_USER_CONFIG_DIR"
+	// ToitcEnv contains the path of the Toit compiler. The libraries of its SDK
+	// are used to check imports.
+	ToitcEnv = "TOITC"
 )
 
 func EnsureDirectory(dir string, err error) (string, error) {
@@ -89,3 +99,47 @@ func RegistryCachePaths() ([]string, error) {
 func PackageInstallPath() (string, bool) {
 	return os.LookupEnv(ToitRegistryInstallPathEnv)
 }
+
+// PackageStorePath returns the path of the content-addressed package store,
+// as given by the TOIT_PACKAGE_STORE_PATH environment variable.
+// Returns false if the variable isn't set. An empty path disables the store.
+func PackageStorePath() (string, bool) {
+	return os.LookupEnv(ToitPackageStorePathEnv)
+}
+
+// DefaultPackageStorePath returns the path of the package store, when it is
+// enabled in the configuration, but no path is given.
+func DefaultPackageStorePath() (string, error) {
+	return cachePathFor(packageStoreSubDir)
+}
+
+// SDKLibPath returns the library directory of the Toit SDK.
+// The SDK is found through the compiler in the TOITC environment variable, or
+// through the 'toit' executable in the PATH.
+// Returns false if no library directory was found.
+func SDKLibPath() (string, bool) {
+	executables := []string{}
+	if toitc := strings.TrimSpace(os.Getenv(ToitcEnv)); toitc != "" {
+		executables = append(executables, toitc)
+	}
+	if toit, err := exec.LookPath("toit"); err == nil {
+		executables = append(executables, toit)
+	}
+	for _, executable := range executables {
+		if resolved, err := filepath.EvalSymlinks(executable); err == nil {
+			executable = resolved
+		}
+		// The executables are in a 'bin' directory next to the 'lib' directory.
+		// Newer SDKs have the libraries in 'lib/toit/lib'.
+		root := filepath.Dir(filepath.Dir(executable))
+		for _, libPath := range []string{
+			filepath.Join(root, "lib"),
+			filepath.Join(root, "lib", "toit", "lib"),
+		} {
+			if info, err := os.Stat(filepath.Join(libPath, "core")); err == nil && info.IsDir() {
+				return libPath, true
+			}
+		}
+	}
+	return "", false
+}
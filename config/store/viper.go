@@ -32,6 +32,10 @@ const packageInstallPathConfigEnv = "TOIT_PACKAGE_INSTALL_PATH"
 const configKeyRegistries = "pkg.registries"
 const configKeyAutosync = "pkg.autosync"
 
+// If true, packages are installed from the content-addressed package store.
+// Installed packages are then hard links into the store.
+const configKeyStore = "pkg.store"
+
 func (vc *Viper) Init(cfgFile string) error {
 	viper.SetConfigFile(cfgFile)
 	return viper.ReadInConfig()
@@ -54,6 +58,23 @@ func (vc *Viper) Load(ctx context.Context) (*commands.Config, error) {
 		result.PackageCachePaths = []string{filepath.Join(vc.cacheDir, "tpkg")}
 		result.RegistryCachePaths = []string{filepath.Join(vc.cacheDir, "tpkg-registries")}
 	}
+	// The package store is opt-in, as it changes the installed packages into
+	// read-only hard links.
+	if storePath, ok := config.PackageStorePath(); ok {
+		if storePath != "" {
+			result.PackageStorePath = &storePath
+		}
+	} else if viper.GetBool(configKeyStore) {
+		storePath := filepath.Join(vc.cacheDir, "tpkg-store")
+		if vc.cacheDir == "" {
+			var err error
+			storePath, err = config.DefaultPackageStorePath()
+			if err != nil {
+				return nil, err
+			}
+		}
+		result.PackageStorePath = &storePath
+	}
 	if p, ok := os.LookupEnv(packageInstallPathConfigEnv); ok {
 		result.PackageInstallPath = &p
 	}
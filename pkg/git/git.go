@@ -19,8 +19,10 @@ import (
 	"context"
 	"fmt"
 	"net/url"
+	"os"
 	"path/filepath"
 
+	"github.com/ProtonMail/go-crypto/openpgp"
 	gogit "github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/transport"
@@ -135,6 +137,49 @@ func Clone(ctx context.Context, dir string, options CloneOptions) (string, error
 	return head.Hash().String(), nil
 }
 
+// CloneRef clones the repository at [url] into [dir] and checks out the
+// given [ref]. The ref can be a branch, a tag, or a (potentially abbreviated)
+// commit hash.
+// Returns the checked out hash.
+func CloneRef(ctx context.Context, dir string, url string, ref string) (string, error) {
+	if !filepath.IsAbs(url) {
+		url = "https://" + url
+	}
+	// We don't know the kind of the ref, so we need the full repository.
+	repository, err := gogit.PlainCloneContext(ctx, dir, false, &gogit.CloneOptions{
+		URL:        url,
+		NoCheckout: true,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	// Branches other than the default branch are only available as
+	// remote branches.
+	var hash *plumbing.Hash
+	for _, candidate := range []string{ref, "origin/" + ref} {
+		hash, err = repository.ResolveRevision(plumbing.Revision(candidate))
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return "", fmt.Errorf("reference '%s' not found", ref)
+	}
+
+	w, err := repository.Worktree()
+	if err != nil {
+		return "", err
+	}
+	err = w.Checkout(&gogit.CheckoutOptions{
+		Hash: *hash,
+	})
+	if err != nil {
+		return "", err
+	}
+	return hash.String(), nil
+}
+
 type PullOptions struct {
 	SSHPath string
 }
@@ -183,3 +228,172 @@ func IsClean(path string) (bool, error) {
 	}
 	return status.IsClean(), nil
 }
+
+// Head returns the hash of the commit that is checked out in the repository at [path].
+func Head(path string) (string, error) {
+	repository, err := gogit.PlainOpen(path)
+	if err != nil {
+		return "", err
+	}
+	head, err := repository.Head()
+	if err != nil {
+		return "", err
+	}
+	return head.Hash().String(), nil
+}
+
+// IsRepository returns whether [path] is the root of a git repository.
+func IsRepository(path string) bool {
+	_, err := gogit.PlainOpen(path)
+	return err == nil
+}
+
+// CheckoutBranch checks out the branch [branch] in the repository at [path].
+// Creates the branch at the current HEAD if it doesn't exist yet.
+// Returns the branch that was checked out before. The result is empty if
+// the HEAD was detached.
+func CheckoutBranch(path string, branch string) (string, error) {
+	repository, err := gogit.PlainOpen(path)
+	if err != nil {
+		return "", err
+	}
+	previous := ""
+	head, err := repository.Head()
+	if err != nil {
+		return "", err
+	}
+	if head.Name().IsBranch() {
+		previous = head.Name().Short()
+	}
+	wt, err := repository.Worktree()
+	if err != nil {
+		return "", err
+	}
+	ref := plumbing.NewBranchReferenceName(branch)
+	_, err = repository.Reference(ref, false)
+	create := err == plumbing.ErrReferenceNotFound
+	if err != nil && !create {
+		return "", err
+	}
+	err = wt.Checkout(&gogit.CheckoutOptions{
+		Branch: ref,
+		Create: create,
+		Keep:   true,
+	})
+	return previous, err
+}
+
+// Commit commits the given [files] of the repository at [path].
+// The [files] are relative to [path].
+// The author is taken from the git configuration.
+// Returns the hash of the new commit.
+func Commit(path string, files []string, message string) (string, error) {
+	repository, err := gogit.PlainOpen(path)
+	if err != nil {
+		return "", err
+	}
+	wt, err := repository.Worktree()
+	if err != nil {
+		return "", err
+	}
+	for _, file := range files {
+		if _, err := wt.Add(filepath.ToSlash(file)); err != nil {
+			return "", err
+		}
+	}
+	hash, err := wt.Commit(message, &gogit.CommitOptions{})
+	if err != nil {
+		return "", err
+	}
+	return hash.String(), nil
+}
+
+// Tags returns the names of all tags of the repository at [path].
+func Tags(path string) ([]string, error) {
+	repository, err := gogit.PlainOpen(path)
+	if err != nil {
+		return nil, err
+	}
+	iter, err := repository.Tags()
+	if err != nil {
+		return nil, err
+	}
+	result := []string{}
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		result = append(result, ref.Name().Short())
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// TagOptions configures the tag that is created by [CreateTag].
+type TagOptions struct {
+	Message string
+	// The path to an armored OpenPGP private key. If given, the tag is signed.
+	SignKeyPath string
+	// The passphrase of the signing key, if it is encrypted.
+	SignKeyPassphrase string
+}
+
+// CreateTag creates an annotated tag [name] for the checked out commit of the
+// repository at [path].
+// The tagger is taken from the git configuration.
+// Returns the hash of the tagged commit.
+func CreateTag(path string, name string, options TagOptions) (string, error) {
+	repository, err := gogit.PlainOpen(path)
+	if err != nil {
+		return "", err
+	}
+	head, err := repository.Head()
+	if err != nil {
+		return "", err
+	}
+	tagOptions := &gogit.CreateTagOptions{
+		Message: options.Message,
+	}
+	if options.SignKeyPath != "" {
+		tagOptions.SignKey, err = readSignKey(options.SignKeyPath, options.SignKeyPassphrase)
+		if err != nil {
+			return "", err
+		}
+	}
+	if _, err := repository.CreateTag(name, head.Hash(), tagOptions); err != nil {
+		return "", err
+	}
+	return head.Hash().String(), nil
+}
+
+// CheckSignKey verifies that the armored OpenPGP private key at [path] can be
+// used to sign a tag with [CreateTag].
+func CheckSignKey(path string, passphrase string) error {
+	_, err := readSignKey(path, passphrase)
+	return err
+}
+
+func readSignKey(path string, passphrase string) (*openpgp.Entity, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	entities, err := openpgp.ReadArmoredKeyRing(file)
+	if err != nil {
+		return nil, err
+	}
+	if len(entities) == 0 || entities[0].PrivateKey == nil {
+		return nil, fmt.Errorf("no private key in '%s'", path)
+	}
+	entity := entities[0]
+	if entity.PrivateKey.Encrypted {
+		if passphrase == "" {
+			return nil, fmt.Errorf("private key in '%s' is encrypted, but no passphrase was given", path)
+		}
+		if err := entity.PrivateKey.Decrypt([]byte(passphrase)); err != nil {
+			return nil, err
+		}
+	}
+	return entity, nil
+}
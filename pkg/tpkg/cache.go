@@ -20,8 +20,12 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 
+	"github.com/Masterminds/semver/v3"
 	"github.com/toitlang/tpkg/pkg/compiler"
+	"github.com/toitlang/tpkg/pkg/git"
+	"github.com/toitlang/tpkg/pkg/set"
 )
 
 // Cache handles all package-Cache related functionality.
@@ -41,6 +45,10 @@ type cacheOptions struct {
 	// The locations where git registries can be found.
 	// The first path is used to install new git registries.
 	registryCachePaths []string
+	// If set, the location of the content-addressed package store.
+	// Packages are then downloaded into the store and linked into the
+	// install path.
+	pkgStorePath *string
 }
 
 func (o *cacheOptions) apply(options ...CacheOption) {
@@ -91,6 +99,21 @@ func (p pkgInstallPath) applyCacheOption(o *cacheOptions) {
 	o.installPkgPath = &path
 }
 
+// WithPkgStorePath sets the location of the content-addressed package store.
+// When set, packages are downloaded once into the store (keyed by their git-hash),
+// and then hard-linked (or copied, if linking isn't possible) into the install path.
+// Git-ref dependencies don't use the store.
+func WithPkgStorePath(path string) CacheOption {
+	return pkgStorePath(path)
+}
+
+type pkgStorePath string
+
+func (p pkgStorePath) applyCacheOption(o *cacheOptions) {
+	path := string(p)
+	o.pkgStorePath = &path
+}
+
 // NewCache creates a new package cache and uses the registryPath as the locations where git registries
 // will be installed can be found.
 func NewCache(registryPath string, ui UI, options ...CacheOption) Cache {
@@ -174,6 +197,28 @@ func (c Cache) PkgInstallPath(projectRootPath string) string {
 	return filepath.Join(projectRootPath, ProjectPackagesPath)
 }
 
+// HasPkgStore returns whether the cache uses a content-addressed package store.
+func (c Cache) HasPkgStore() bool {
+	return c.options.pkgStorePath != nil
+}
+
+// StorePkgPath returns the path of the package url in the package store,
+// where hash is the git-hash of the package's repository.
+// Packages that are nested inside a repository share the same hash as their
+// repository, and are thus stored in a subdirectory.
+// The cache must have a package store. See HasPkgStore.
+func (c Cache) StorePkgPath(url string, hash string) string {
+	hashDir := filepath.Join(*c.options.pkgStorePath, hash)
+	if strings.HasPrefix(url, TestGitPathHost+"/") {
+		return filepath.Join(hashDir, "root")
+	}
+	_, nested := decomposePkgURL(url)
+	if nested == "" {
+		return filepath.Join(hashDir, "root")
+	}
+	return filepath.Join(hashDir, "nested", compiler.ToURIPath(nested).FilePath())
+}
+
 // PreferredRegistryPath returns the preferred path for the given registry url.
 func (c Cache) PreferredRegistryPath(url string) string {
 	// The first cache path is the preferred location.
@@ -210,3 +255,179 @@ func (c Cache) CreatePackagesCacheDir(projectRootPath string, ui UI) error {
 	err = ioutil.WriteFile(readmePath, []byte(readmeContent), 0755)
 	return err
 }
+
+// CachedPkg describes a package that has been found in one of the package caches.
+type CachedPkg struct {
+	URL     string `json:"url"`
+	Version string `json:"version"`
+	// The path to the package.
+	Path string `json:"path"`
+	// The cache directory in which the package was found.
+	CachePath string `json:"cache_path"`
+	// The size of all files of the package in bytes.
+	Size int64 `json:"size"`
+	// The git-hash of the checked out package. Empty, if the package
+	// isn't a git checkout. (For example, when it is nested in a repository).
+	Hash string `json:"hash"`
+}
+
+// CachedRegistry describes a registry that has been cloned into one of the registry caches.
+type CachedRegistry struct {
+	URL  string `json:"url"`
+	Path string `json:"path"`
+	// The cache directory in which the registry was found.
+	CachePath string `json:"cache_path"`
+	// The commit that is currently checked out.
+	Commit string `json:"commit"`
+}
+
+// pkgSearchPaths returns the paths, in search order, in which packages for the
+// given project are searched.
+func (c Cache) pkgSearchPaths(rootPath string) []string {
+	result := []string{}
+	seen := set.String{}
+	paths := c.options.pkgCachePaths
+	if rootPath != "" {
+		paths = append([]string{filepath.Join(rootPath, ProjectPackagesPath)}, paths...)
+	}
+	for _, p := range paths {
+		cleaned := filepath.Clean(p)
+		if seen.Contains(cleaned) {
+			continue
+		}
+		seen.Add(cleaned)
+		result = append(result, p)
+	}
+	return result
+}
+
+// FindAllPkgs returns all paths of 'url'-'version' in the caches.
+// The paths are in search order. That is, the first entry is the one
+// that is returned by FindPkg.
+func (c Cache) FindAllPkgs(rootPath string, url string, version string) ([]string, error) {
+	packageRel := URLVersionToRelPath(url, version)
+	result := []string{}
+	for _, cachePath := range c.pkgSearchPaths(rootPath) {
+		p, err := c.find(packageRel, []string{cachePath})
+		if err != nil {
+			return nil, err
+		}
+		if p != "" {
+			result = append(result, p)
+		}
+	}
+	return result, nil
+}
+
+// ListPkgs returns all packages that are in the caches of the project at
+// rootPath. If rootPath is "", only returns the packages of the shared caches.
+// The packages are returned in search order.
+func (c Cache) ListPkgs(rootPath string) ([]CachedPkg, error) {
+	result := []CachedPkg{}
+	for _, cachePath := range c.pkgSearchPaths(rootPath) {
+		err := filepath.Walk(cachePath, func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			if !info.IsDir() || p == cachePath {
+				return nil
+			}
+			if strings.HasPrefix(info.Name(), ".") {
+				return filepath.SkipDir
+			}
+			// Packages are stored in '<escaped-url>/<version>'. Versions are
+			// full semantic versions, so that directories like 'v2' of a
+			// package URL aren't mistaken for versions.
+			if _, err := semver.StrictNewVersion(info.Name()); err != nil {
+				return nil
+			}
+			rel, err := filepath.Rel(cachePath, filepath.Dir(p))
+			if err != nil {
+				return err
+			}
+			if rel == "." {
+				return nil
+			}
+			size, err := dirSize(p)
+			if err != nil {
+				return err
+			}
+			// Packages that are nested in a repository don't have a '.git' directory.
+			hash, _ := git.Head(p)
+			result = append(result, CachedPkg{
+				URL:       compiler.FilePathToURIPath(rel).URL(),
+				Version:   info.Name(),
+				Path:      p,
+				CachePath: cachePath,
+				Size:      size,
+				Hash:      hash,
+			})
+			return filepath.SkipDir
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// ListRegistries returns all git registries that are cloned in the registry caches.
+func (c Cache) ListRegistries() ([]CachedRegistry, error) {
+	result := []CachedRegistry{}
+	for _, cachePath := range c.options.registryCachePaths {
+		err := filepath.Walk(cachePath, func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			if !info.IsDir() {
+				return nil
+			}
+			if p != cachePath && strings.HasPrefix(info.Name(), ".") {
+				return filepath.SkipDir
+			}
+			if !doesPathExist(filepath.Join(p, ".git")) {
+				return nil
+			}
+			rel, err := filepath.Rel(cachePath, p)
+			if err != nil {
+				return err
+			}
+			commit, err := git.Head(p)
+			if err != nil {
+				return err
+			}
+			result = append(result, CachedRegistry{
+				URL:       compiler.FilePathToURIPath(rel).URL(),
+				Path:      p,
+				CachePath: cachePath,
+				Commit:    commit,
+			})
+			return filepath.SkipDir
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// dirSize returns the accumulated size of all regular files in the given directory.
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.Walk(dir, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
@@ -0,0 +1,93 @@
+// Copyright (C) 2021 Toitware ApS.
+//
+// This library is free software; you can redistribute it and/or
+// modify it under the terms of the GNU Lesser General Public
+// License as published by the Free Software Foundation; version
+// 2.1 only.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Lesser General Public License for more details.
+//
+// The license can be found in the file `LICENSE` in the top level
+// directory of this repository.
+
+package tpkg
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func createCachedPkg(t *testing.T, cachePath string, url string, version string, content string) string {
+	p := filepath.Join(cachePath, URLVersionToRelPath(url, version))
+	require.NoError(t, os.MkdirAll(filepath.Join(p, "src"), 0755))
+	err := os.WriteFile(filepath.Join(p, "src", "foo.toit"), []byte(content), 0644)
+	require.NoError(t, err)
+	return p
+}
+
+func Test_CacheList(t *testing.T) {
+	t.Run("ListPkgs", func(t *testing.T) {
+		dir := t.TempDir()
+		projectRoot := filepath.Join(dir, "project")
+		sharedCache := filepath.Join(dir, "shared")
+		ui := &testUI{}
+		c := NewCache(filepath.Join(dir, "registries"), ui, WithPkgCachePath(sharedCache))
+
+		projectPath := createCachedPkg(t, filepath.Join(projectRoot, ProjectPackagesPath), "github.com/foo/bar", "1.0.0", "12345")
+		sharedPath := createCachedPkg(t, sharedCache, "github.com/foo/bar", "1.0.0", "1")
+		otherPath := createCachedPkg(t, sharedCache, "github.com/foo/gee.git/nested", "2.3.4", "123")
+		// 'v2' isn't a full semantic version, and thus not a version directory.
+		majorPath := createCachedPkg(t, sharedCache, "github.com/foo/v2/lib", "1.2.3", "12")
+
+		pkgs, err := c.ListPkgs(projectRoot)
+		require.NoError(t, err)
+		require.Len(t, pkgs, 4)
+		assert.Equal(t, "github.com/foo/bar", pkgs[0].URL)
+		assert.Equal(t, "1.0.0", pkgs[0].Version)
+		assert.Equal(t, projectPath, pkgs[0].Path)
+		assert.Equal(t, int64(5), pkgs[0].Size)
+		assert.Equal(t, "", pkgs[0].Hash)
+		assert.Equal(t, sharedPath, pkgs[1].Path)
+		assert.Equal(t, sharedCache, pkgs[1].CachePath)
+		assert.Equal(t, "github.com/foo/gee.git/nested", pkgs[2].URL)
+		assert.Equal(t, "2.3.4", pkgs[2].Version)
+		assert.Equal(t, otherPath, pkgs[2].Path)
+		assert.Equal(t, "github.com/foo/v2/lib", pkgs[3].URL)
+		assert.Equal(t, majorPath, pkgs[3].Path)
+
+		pkgs, err = c.ListPkgs("")
+		require.NoError(t, err)
+		assert.Len(t, pkgs, 3)
+
+		found, err := c.FindAllPkgs(projectRoot, "github.com/foo/bar", "1.0.0")
+		require.NoError(t, err)
+		assert.Equal(t, []string{projectPath, sharedPath}, found)
+
+		first, err := c.FindPkg(projectRoot, "github.com/foo/bar", "1.0.0")
+		require.NoError(t, err)
+		assert.Equal(t, found[0], first)
+
+		found, err = c.FindAllPkgs(projectRoot, "github.com/foo/bar", "2.0.0")
+		require.NoError(t, err)
+		assert.Empty(t, found)
+	})
+
+	t.Run("Missing caches", func(t *testing.T) {
+		dir := t.TempDir()
+		ui := &testUI{}
+		c := NewCache(filepath.Join(dir, "registries"), ui, WithPkgCachePath(filepath.Join(dir, "not-there")))
+		pkgs, err := c.ListPkgs(filepath.Join(dir, "project"))
+		require.NoError(t, err)
+		assert.Empty(t, pkgs)
+		registries, err := c.ListRegistries()
+		require.NoError(t, err)
+		assert.Empty(t, registries)
+	})
+}
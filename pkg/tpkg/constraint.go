@@ -22,6 +22,50 @@ import (
 	"github.com/hashicorp/go-version"
 )
 
+// Version constraints are used in package files (the 'version' of a
+// dependency), in descriptions, and when installing packages ('pkg install
+// foo@<constraint>').
+//
+// Grammar:
+//
+//	constraints := alternative ('||' alternative)*
+//	alternative := term (',' term)*
+//	term        := [operator] version | '^' version | '~' version | wildcard
+//	operator    := '=' | '!=' | '>' | '>=' | '<' | '<=' | '~>'
+//	wildcard    := '*' | 'x' | major '.' ('x' | '*') | major '.' minor '.' ('x' | '*')
+//
+// A version satisfies the constraints if it satisfies all terms of at least
+// one alternative. Versions may be partial ('1', '1.2').
+//   - '^1.2.3' accepts semver compatible versions: '>=1.2.3,<2.0.0'.
+//     For '^0.2.3' that's '>=0.2.3,<0.3.0'.
+//   - '~1.2.3' and '~1.2' accept patch updates: '>=1.2.3,<1.3.0'. '~1' is
+//     '>=1,<2.0.0'.
+//   - '~> 1.2' is the pessimistic operator: the last given segment may
+//     increase: '>=1.2,<2.0.0'.
+//   - '1.x' (or '1.*') is '>=1.0.0,<2.0.0', and '1.2.x' is '>=1.2.0,<1.3.0'.
+//     '*' accepts all versions.
+//   - A version without operator must match exactly.
+//
+// Prereleases (like '1.2.3-beta.1') are only accepted by an alternative if
+// one of its terms explicitly mentions a prerelease with the same major, minor
+// and patch version. For example, '^1.2.3-beta' accepts '1.2.3-beta.2', but
+// neither '1.3.0-beta' nor '2.0.0-beta'.
+
+// Constraints is a parsed version constraint.
+// The zero value accepts all versions that aren't prereleases.
+type Constraints struct {
+	// The alternatives. A version must satisfy all terms of one of them.
+	alternatives [][]constraintTerm
+}
+
+// constraintTerm is a single comparison of a constraint.
+type constraintTerm struct {
+	op      string
+	version *version.Version
+	// The version as it was written.
+	original string
+}
+
 type rangeKind int
 
 const (
@@ -31,53 +75,146 @@ const (
 	segmentRange rangeKind = iota
 	// A semver constraint accepts all versions that are semver compatible.
 	semverRange
+	// A tilde constraint accepts patch updates.
+	// For example, "1.2" accepts "1.2.9" but not "1.3.0".
+	tildeRange
+	// A pessimistic constraint accepts increments of the last given segment.
+	// For example, "1.2" accepts "1.9.0" but not "2.0.0".
+	pessimisticRange
 )
 
-func parseInstallConstraint(str string) (version.Constraints, error) {
-	return parseConstraintRange(str, segmentRange)
+// parseInstallConstraint parses the version of a 'pkg install foo@<version>'
+// request. A plain (partial) version accepts any value for the missing
+// segments. Everything else is parsed as constraint.
+func parseInstallConstraint(str string) (Constraints, error) {
+	str = strings.TrimSpace(str)
+	if _, err := version.NewVersion(str); err == nil {
+		return parseConstraintRange(str, segmentRange)
+	}
+	return parseConstraint(str)
 }
 
-func parseConstraint(str string) (version.Constraints, error) {
-	if !strings.Contains(str, "^") {
-		return version.NewConstraint(str)
+// parseConstraint parses the given constraint string.
+// See the grammar at the top of this file.
+func parseConstraint(str string) (Constraints, error) {
+	result := Constraints{}
+	if strings.TrimSpace(str) == "" {
+		return result, fmt.Errorf("empty version constraint")
 	}
-
-	// Toit supports constraints of the form '^version' which is equivalent to
-	// '>=version,<nextIncompatibleVersion'
-	// For example:
-	//    '^1.2.3' is equivalent to '>=1.2.3,<2.0.0' and
-	//    '^0.1.2' is equivalent to '>=0.1.2,<0.2.0'
-	parts := strings.Split(str, ",")
-	var result version.Constraints
-	for _, p := range parts {
-		p = strings.TrimSpace(p)
-		if strings.HasPrefix(p, "^") {
-			vStr := strings.TrimPrefix(p, "^")
-			cs, err := parseConstraintRange(vStr, semverRange)
+	for _, alternativeStr := range strings.Split(str, "||") {
+		alternative := []constraintTerm{}
+		for _, termStr := range strings.Split(alternativeStr, ",") {
+			terms, err := parseConstraintTerm(strings.TrimSpace(termStr))
 			if err != nil {
-				return nil, err
+				return Constraints{}, err
 			}
-			result = append(result, cs...)
+			alternative = append(alternative, terms...)
+		}
+		result.alternatives = append(result.alternatives, alternative)
+	}
+	return result, nil
+}
 
-		} else {
-			cs, err := version.NewConstraint(p)
-			if err != nil {
-				return nil, err
+// constraintOperators are the supported operators. Longer operators come
+// first, so that they are found before their prefixes.
+var constraintOperators = []string{"~>", ">=", "<=", "!=", "=", ">", "<", "^", "~"}
+
+func parseConstraintTerm(str string) ([]constraintTerm, error) {
+	if str == "" {
+		return nil, fmt.Errorf("empty term in version constraint")
+	}
+	op := ""
+	for _, candidate := range constraintOperators {
+		if strings.HasPrefix(str, candidate) {
+			op = candidate
+			break
+		}
+	}
+	vStr := strings.TrimSpace(strings.TrimPrefix(str, op))
+	if vStr == "" {
+		return nil, fmt.Errorf("missing version after '%s'", op)
+	}
+
+	if isWildcard(vStr) {
+		if op != "" && op != "=" {
+			return nil, fmt.Errorf("wildcard version '%s' can't be used with operator '%s'", vStr, op)
+		}
+		return parseWildcard(vStr)
+	}
+
+	switch op {
+	case "^":
+		return parseConstraintRangeTerms(vStr, semverRange)
+	case "~":
+		return parseConstraintRangeTerms(vStr, tildeRange)
+	case "~>":
+		return parseConstraintRangeTerms(vStr, pessimisticRange)
+	case "":
+		op = "="
+	}
+	v, err := version.NewVersion(vStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid version '%s'", vStr)
+	}
+	return []constraintTerm{{op: op, version: v, original: vStr}}, nil
+}
+
+// isWildcard returns whether the given version contains a wildcard segment.
+func isWildcard(vStr string) bool {
+	for _, segment := range strings.Split(vStr, ".") {
+		if segment == "*" || segment == "x" || segment == "X" {
+			return true
+		}
+	}
+	return false
+}
+
+// parseWildcard parses versions like '1.x' or '1.2.*'.
+// Only trailing segments may be wildcards.
+func parseWildcard(vStr string) ([]constraintTerm, error) {
+	segments := strings.Split(vStr, ".")
+	fixed := []string{}
+	for i, segment := range segments {
+		if segment == "*" || segment == "x" || segment == "X" {
+			for _, rest := range segments[i+1:] {
+				if rest != "*" && rest != "x" && rest != "X" {
+					return nil, fmt.Errorf("invalid wildcard version '%s'", vStr)
+				}
 			}
-			result = append(result, cs...)
+			break
 		}
+		fixed = append(fixed, segment)
 	}
-	return result, nil
+	if len(fixed) == 0 {
+		// Accepts everything.
+		return []constraintTerm{}, nil
+	}
+	prefix := strings.Join(fixed, ".")
+	if _, err := version.NewVersion(prefix); err != nil || strings.Contains(prefix, "-") {
+		return nil, fmt.Errorf("invalid wildcard version '%s'", vStr)
+	}
+	return parseConstraintRangeTerms(prefix, segmentRange)
 }
 
-func parseConstraintRange(vStr string, kind rangeKind) (version.Constraints, error) {
+// parseConstraintRange returns the constraints for the given version range.
+func parseConstraintRange(vStr string, kind rangeKind) (Constraints, error) {
+	terms, err := parseConstraintRangeTerms(vStr, kind)
+	if err != nil {
+		return Constraints{}, err
+	}
+	return Constraints{alternatives: [][]constraintTerm{terms}}, nil
+}
+
+func parseConstraintRangeTerms(vStr string, kind rangeKind) ([]constraintTerm, error) {
 	v, err := version.NewVersion(vStr)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("invalid version '%s'", vStr)
 	}
 	segments := v.Segments()
+	dots := strings.Count(strings.SplitN(strings.SplitN(vStr, "-", 2)[0], "+", 2)[0], ".")
 	upper := ""
-	if kind == semverRange {
+	switch kind {
+	case semverRange:
 		reset := false
 		for i, segment := range segments {
 			if reset {
@@ -92,17 +229,235 @@ func parseConstraintRange(vStr string, kind rangeKind) (version.Constraints, err
 			strs[i] = fmt.Sprint(segment)
 		}
 		upper = strings.Join(strs, ".")
-	} else {
-		dots := strings.Count(vStr, ".")
+	case tildeRange:
+		if dots == 0 {
+			upper = fmt.Sprintf("%d.0.0", segments[0]+1)
+		} else {
+			upper = fmt.Sprintf("%d.%d.0", segments[0], segments[1]+1)
+		}
+	case pessimisticRange:
+		if dots == 0 {
+			// Same as '>=vStr'.
+			return []constraintTerm{{op: ">=", version: v, original: vStr}}, nil
+		}
+		strs := []string{}
+		for i := 0; i < dots-1; i++ {
+			strs = append(strs, fmt.Sprint(segments[i]))
+		}
+		strs = append(strs, fmt.Sprint(segments[dots-1]+1))
+		for len(strs) < 3 {
+			strs = append(strs, "0")
+		}
+		upper = strings.Join(strs, ".")
+	default:
 		if dots == 0 {
 			upper = fmt.Sprintf("%d.0.0", segments[0]+1)
 		} else if dots == 1 {
 			upper = fmt.Sprintf("%d.%d.0", segments[0], segments[1]+1)
 		} else {
 			// Just use the version that was given as constraint.
-			return version.NewConstraint(vStr)
+			return []constraintTerm{{op: "=", version: v, original: vStr}}, nil
 		}
 	}
-	expandedConstraint := ">=" + vStr + ",<" + upper
-	return version.NewConstraint(expandedConstraint)
+	upperVersion, err := version.NewVersion(upper)
+	if err != nil {
+		return nil, err
+	}
+	return []constraintTerm{
+		{op: ">=", version: v, original: vStr},
+		{op: "<", version: upperVersion, original: upper},
+	}, nil
+}
+
+// Check returns whether the given version satisfies the constraints.
+func (c Constraints) Check(v *version.Version) bool {
+	if len(c.alternatives) == 0 {
+		return v.Prerelease() == ""
+	}
+	for _, alternative := range c.alternatives {
+		if checkAlternative(alternative, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func checkAlternative(terms []constraintTerm, v *version.Version) bool {
+	if v.Prerelease() != "" && !allowsPrerelease(terms, v) {
+		return false
+	}
+	for _, term := range terms {
+		if !term.check(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// allowsPrerelease returns whether one of the terms explicitly mentions a
+// prerelease of the same major, minor and patch version as the given version.
+func allowsPrerelease(terms []constraintTerm, v *version.Version) bool {
+	core := v.Segments64()
+	for _, term := range terms {
+		if term.version.Prerelease() == "" {
+			continue
+		}
+		termCore := term.version.Segments64()
+		if len(termCore) != len(core) {
+			continue
+		}
+		same := true
+		for i := range core {
+			if core[i] != termCore[i] {
+				same = false
+				break
+			}
+		}
+		if same {
+			return true
+		}
+	}
+	return false
+}
+
+func (t constraintTerm) check(v *version.Version) bool {
+	cmp := v.Compare(t.version)
+	switch t.op {
+	case "=":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	}
+	return false
+}
+
+// String returns the constraints in a normalized form that can be parsed
+// again.
+func (c Constraints) String() string {
+	alternatives := []string{}
+	for _, alternative := range c.alternatives {
+		terms := []string{}
+		for _, term := range alternative {
+			terms = append(terms, term.op+term.original)
+		}
+		if len(terms) == 0 {
+			terms = append(terms, "*")
+		}
+		alternatives = append(alternatives, strings.Join(terms, ","))
+	}
+	return strings.Join(alternatives, " || ")
+}
+
+// lowerBound returns the lowest version bound of the constraints. '!='
+// terms are ignored. Returns nil if one of the alternatives doesn't have a
+// lower bound.
+func (c Constraints) lowerBound() *version.Version {
+	var result *version.Version
+	for _, alternative := range c.alternatives {
+		var lower *version.Version
+		for _, term := range alternative {
+			switch term.op {
+			case "=", ">=", ">":
+				if lower == nil || term.version.GreaterThan(lower) {
+					lower = term.version
+				}
+			}
+		}
+		if lower == nil {
+			return nil
+		}
+		if result == nil || lower.LessThan(result) {
+			result = lower
+		}
+	}
+	return result
+}
+
+// sdkConstraint is the SDK requirement of a package ('environment.sdk').
+//
+// For compatibility with existing packages, '^version' only sets the minimal
+// SDK version: later major versions of the SDK are accepted as well. All
+// other constraints use the grammar at the top of this file. Unlike package
+// versions, prerelease SDKs don't need to be opted into.
+type sdkConstraint struct {
+	// The constraint as it was written.
+	original    string
+	constraints Constraints
+	// The lowest version bound of the constraint. Nil if there isn't any.
+	min *version.Version
+}
+
+// parseSDKConstraint parses the given SDK constraint.
+// Returns nil if the string is empty.
+func parseSDKConstraint(str string) (*sdkConstraint, error) {
+	str = strings.TrimSpace(str)
+	if str == "" {
+		return nil, nil
+	}
+	var constraints Constraints
+	if strings.HasPrefix(str, "^") && !strings.ContainsAny(str, ",|") {
+		vStr := strings.TrimSpace(str[1:])
+		v, err := version.NewVersion(vStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version '%s'", vStr)
+		}
+		constraints = Constraints{
+			alternatives: [][]constraintTerm{{{op: ">=", version: v, original: vStr}}},
+		}
+	} else {
+		var err error
+		constraints, err = parseConstraint(str)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &sdkConstraint{
+		original:    str,
+		constraints: constraints,
+		min:         constraints.lowerBound(),
+	}, nil
+}
+
+// check returns whether the given SDK version satisfies the constraint.
+// A nil constraint accepts all versions.
+func (c *sdkConstraint) check(v *version.Version) bool {
+	if c == nil {
+		return true
+	}
+	for _, alternative := range c.constraints.alternatives {
+		satisfied := true
+		for _, term := range alternative {
+			if !term.check(v) {
+				satisfied = false
+				break
+			}
+		}
+		if satisfied {
+			return true
+		}
+	}
+	return false
+}
+
+// minVersion returns the lowest version bound of the constraint, or nil.
+func (c *sdkConstraint) minVersion() *version.Version {
+	if c == nil {
+		return nil
+	}
+	return c.min
+}
+
+func (c *sdkConstraint) String() string {
+	if c == nil {
+		return ""
+	}
+	return c.original
 }
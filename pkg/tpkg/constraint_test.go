@@ -40,9 +40,137 @@ func Test_parseConstraintRange(t *testing.T) {
 			expectedIn := test[1]
 			actual, err := parseInstallConstraint(in)
 			require.NoError(t, err)
-			expected, err := version.NewConstraint(expectedIn)
+			expected, err := parseConstraint(expectedIn)
 			require.NoError(t, err)
 			assert.Equal(t, expected.String(), actual.String())
 		})
 	}
 }
+
+func Test_ConstraintGrammar(t *testing.T) {
+	check := func(t *testing.T, constraint string, accepted []string, rejected []string) {
+		c, err := parseConstraint(constraint)
+		require.NoError(t, err)
+		for _, vStr := range accepted {
+			assert.True(t, c.Check(version.Must(version.NewVersion(vStr))), "%s should accept %s", constraint, vStr)
+		}
+		for _, vStr := range rejected {
+			assert.False(t, c.Check(version.Must(version.NewVersion(vStr))), "%s should reject %s", constraint, vStr)
+		}
+	}
+
+	t.Run("Normalize", func(t *testing.T) {
+		tests := [][]string{
+			{"~1.2.3", ">=1.2.3,<1.3.0"},
+			{"~1.2", ">=1.2,<1.3.0"},
+			{"~1", ">=1,<2.0.0"},
+			{"~> 1.2", ">=1.2,<2.0.0"},
+			{"~>1.2.3", ">=1.2.3,<1.3.0"},
+			{"1.x", ">=1,<2.0.0"},
+			{"1.2.*", ">=1.2,<1.3.0"},
+			{"=1.X", ">=1,<2.0.0"},
+			{"*", "*"},
+			{"1.0.0", "=1.0.0"},
+			{">= 1.0.0, < 2.0.0", ">=1.0.0,<2.0.0"},
+			{"^1.0.0 || ^2.1.0", ">=1.0.0,<2.0.0 || >=2.1.0,<3.0.0"},
+			{"!=1.0.0", "!=1.0.0"},
+		}
+		for _, test := range tests {
+			actual, err := parseConstraint(test[0])
+			require.NoError(t, err)
+			assert.Equal(t, test[1], actual.String())
+			// The normalized form parses to the same constraint.
+			reparsed, err := parseConstraint(actual.String())
+			require.NoError(t, err)
+			assert.Equal(t, actual, reparsed)
+		}
+	})
+
+	t.Run("Check", func(t *testing.T) {
+		check(t, "~1.2.3", []string{"1.2.3", "1.2.9"}, []string{"1.2.2", "1.3.0"})
+		check(t, "^1.0.0 || ^3.0.0", []string{"1.0.0", "1.9.0", "3.1.0"}, []string{"2.0.0", "4.0.0"})
+		check(t, "1.x", []string{"1.0.0", "1.9.9"}, []string{"0.9.0", "2.0.0"})
+		check(t, "*", []string{"0.0.1", "99.0.0"}, nil)
+		check(t, ">=1.0.0, !=1.2.0", []string{"1.0.0", "1.3.0"}, []string{"0.9.0", "1.2.0"})
+	})
+
+	t.Run("Prerelease", func(t *testing.T) {
+		check(t, "^1.0.0", []string{"1.0.0"}, []string{"1.1.0-beta", "2.0.0-beta"})
+		check(t, "*", nil, []string{"1.0.0-alpha"})
+		check(t, "^1.2.3-beta", []string{"1.2.3-beta", "1.2.3-beta.2", "1.2.3", "1.5.0"}, []string{"1.2.3-alpha", "1.3.0-beta"})
+		check(t, "^1.0.0 || 2.0.0-rc.1", []string{"2.0.0-rc.1"}, []string{"2.0.0-rc.0", "1.5.0-rc.1"})
+		empty := Constraints{}
+		assert.True(t, empty.Check(version.Must(version.NewVersion("1.0.0"))))
+		assert.False(t, empty.Check(version.Must(version.NewVersion("1.0.0-beta"))))
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		tests := [][]string{
+			{"", "empty version constraint"},
+			{"^1.0.0 ||", "empty term in version constraint"},
+			{">=1.0.0,", "empty term in version constraint"},
+			{"^", "missing version after '^'"},
+			{">=1.x", "wildcard version '1.x' can't be used with operator '>='"},
+			{"1.x.3", "invalid wildcard version '1.x.3'"},
+			{"^foo", "invalid version 'foo'"},
+			{"=>1.0.0", "invalid version '>1.0.0'"},
+		}
+		for _, test := range tests {
+			_, err := parseConstraint(test[0])
+			require.Error(t, err, test[0])
+			assert.Equal(t, test[1], err.Error())
+		}
+	})
+}
+
+func Test_SDKConstraint(t *testing.T) {
+	check := func(t *testing.T, constraint string, min string, accepted []string, rejected []string) {
+		c, err := parseSDKConstraint(constraint)
+		require.NoError(t, err)
+		if min == "" {
+			assert.Nil(t, c.minVersion())
+		} else {
+			assert.Equal(t, min, c.minVersion().String())
+		}
+		for _, vStr := range accepted {
+			assert.True(t, c.check(version.Must(version.NewVersion(vStr))), "%s should accept %s", constraint, vStr)
+		}
+		for _, vStr := range rejected {
+			assert.False(t, c.check(version.Must(version.NewVersion(vStr))), "%s should reject %s", constraint, vStr)
+		}
+	}
+
+	t.Run("Caret", func(t *testing.T) {
+		// '^' only sets the minimal SDK version.
+		check(t, "^1.6.0", "1.6.0",
+			[]string{"1.6.0", "1.9.2", "2.0.0-alpha.120", "3.0.0"},
+			[]string{"1.5.9", "1.6.0-alpha.1"})
+	})
+
+	t.Run("Grammar", func(t *testing.T) {
+		// Prereleases are compared like other versions.
+		check(t, ">=1.6.0,<2.0.0", "1.6.0",
+			[]string{"1.6.0", "1.9.2", "2.0.0-alpha.120"},
+			[]string{"1.5.0", "2.0.0"})
+		check(t, "~1.6 || ^2.0.0-alpha.100", "1.6.0",
+			[]string{"1.6.3", "2.0.0-alpha.120", "2.3.0"},
+			[]string{"1.7.0", "2.0.0-alpha.99", "3.0.0"})
+		check(t, "<2.0.0", "",
+			[]string{"1.0.0"},
+			[]string{"2.0.0"})
+	})
+
+	t.Run("Empty", func(t *testing.T) {
+		c, err := parseSDKConstraint("")
+		require.NoError(t, err)
+		assert.Nil(t, c)
+		assert.True(t, c.check(version.Must(version.NewVersion("1.0.0"))))
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		for _, constraint := range []string{"^foo", ">=1.0,", "1.x.2"} {
+			_, err := parseSDKConstraint(constraint)
+			assert.Error(t, err, constraint)
+		}
+	})
+}
@@ -17,6 +17,7 @@ package tpkg
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
@@ -53,10 +54,31 @@ type Desc struct {
 	Hash string `yaml:"hash,omitempty" json:"hash"`
 
 	Deps []descPackage `yaml:"dependencies,omitempty" json:"dependencies"`
+
+	// The reason this version was yanked. Yanked versions aren't used for
+	// new resolutions, but lock files that already use them keep working.
+	Yanked string `yaml:"yanked,omitempty" json:"yanked,omitempty"`
+	// Set if the package is deprecated.
+	Deprecated *DescDeprecation `yaml:"deprecated,omitempty" json:"deprecated,omitempty"`
+
+	// Optional metadata, copied from the package specification.
+	Authors       []string `yaml:"authors,omitempty" json:"authors,omitempty"`
+	Homepage      string   `yaml:"homepage,omitempty" json:"homepage,omitempty"`
+	Repository    string   `yaml:"repository,omitempty" json:"repository,omitempty"`
+	Documentation string   `yaml:"documentation,omitempty" json:"documentation,omitempty"`
+	Keywords      []string `yaml:"keywords,omitempty" json:"keywords,omitempty"`
+	// The path to the README file, relative to the package.
+	Readme string `yaml:"readme,omitempty" json:"readme,omitempty"`
+
+	// Fields that aren't known to this version of the package manager.
+	// They are kept so that writing the description doesn't drop them.
+	Extra map[string]interface{} `yaml:",inline" json:"-"`
 }
 
 type DescEnvironment struct {
 	SDK string `yaml:"sdk,omitempty" json:"sdk,omitempty"`
+	// The targets the package supports. Empty if it supports all targets.
+	Targets []string `yaml:"targets,omitempty" json:"targets,omitempty"`
 }
 
 func NewDesc(name string, description string, url string, version string, sdk string, license string, hash string, deps []descPackage) *Desc {
@@ -74,9 +96,18 @@ func NewDesc(name string, description string, url string, version string, sdk st
 	}
 }
 
+// DescDeprecation describes why a package is deprecated.
+type DescDeprecation struct {
+	Message string `yaml:"message" json:"message"`
+	// The URL of a package that should be used instead, if any.
+	Replacement string `yaml:"replacement,omitempty" json:"replacement,omitempty"`
+}
+
 type descPackage struct {
 	URL     string `yaml:"url" json:"url"`
 	Version string `yaml:"version" json:"version"` // This is actually a constraint.
+	// Fields that aren't known to this version of the package manager.
+	Extra map[string]interface{} `yaml:",inline" json:"-"`
 }
 
 type AllowLocalDepsFlag int
@@ -87,22 +118,24 @@ const (
 	DisallowLocalDeps
 )
 
-// TODO (jesper): Parse and WriteTo should preserve comments.
 func (d *Desc) Parse(b []byte, ui UI) error {
 	fail := func(err error) error {
 		if IsErrAlreadyReported(err) {
 			return err
 		}
 		if d.path != "" {
-			return ui.ReportError("Failed to parse package description '%s': %w", d.path, err)
+			loc := Location{File: d.path, Line: yamlErrorLine(err)}
+			return reportErrorAt(ui, loc, "Failed to parse package description '%s': %v", d.path, err)
 		}
-		return ui.ReportError("Failed to parse package description: %w", err)
+		return ui.ReportError("Failed to parse package description: %v", err)
 	}
 
 	if err := yaml.Unmarshal(b, d); err != nil {
 		return fail(err)
 	}
 
+	d.reportUnknownFields(ui, false)
+
 	// Force the URL to be lower-case.
 	// This avoids issues with case-insensitive file systems, and with
 	// projects that have been registered with different casing.
@@ -130,15 +163,44 @@ func (d *Desc) Parse(b []byte, ui UI) error {
 		_, err := parseConstraint(constraint)
 		if err != nil {
 			if d.path != "" {
-				return ui.ReportError("Invalid constraint in '%s': %v", d.path, d.Version)
+				return ui.ReportError("Invalid constraint in '%s': %v: %v", d.path, constraint, err)
 			}
-			return ui.ReportError("Invalid constraint: %v", constraint)
+			return ui.ReportError("Invalid constraint: %v: %v", constraint, err)
 		}
 	}
 
 	return nil
 }
 
+// reportUnknownFields reports fields that aren't known. They are frequently
+// typos, like 'dependancies'.
+// Registries are parsed for most commands, and their maintainers are rarely
+// the ones running them. Parsing thus only reports the fields as infos. The
+// commands for registry maintainers (like 'pkg registry check') report them
+// as warnings.
+func (d *Desc) reportUnknownFields(ui UI, warn bool) {
+	location := ""
+	if d.path != "" {
+		location = fmt.Sprintf(" in '%s'", d.path)
+	}
+	loc := Location{File: d.path}
+	report := func(format string, a ...interface{}) {
+		if warn {
+			reportWarningAt(ui, loc, format, a...)
+		} else {
+			ui.ReportInfo(format, a...)
+		}
+	}
+	for _, key := range sortedKeys(d.Extra) {
+		report("Unknown field '%s'%s", key, location)
+	}
+	for _, dep := range d.Deps {
+		for _, key := range sortedKeys(dep.Extra) {
+			report("Unknown field '%s' for dependency '%s'%s", key, dep.URL, location)
+		}
+	}
+}
+
 func (d *Desc) ParseString(str string, ui UI) error {
 	return d.Parse([]byte(str), ui)
 }
@@ -158,16 +220,17 @@ func (d *Desc) Validate(ui UI) error {
 		return ui.ReportError("Specification '%s' has an empty URL", d.Name)
 	}
 
-	if d.Environment.SDK != "" {
-		sdk := d.Environment.SDK
-		if !strings.HasPrefix(sdk, "^") {
-			return ui.ReportError("SDK constraint must be of form '^version': '%s'", sdk)
-		}
-		_, err := parseConstraintRange(sdk[1:], semverRange)
-		if err != nil {
-			return ui.ReportError("Invalid SDK constraint '%s'", sdk)
+	if _, err := parseSDKConstraint(d.Environment.SDK); err != nil {
+		return ui.ReportError("Invalid SDK constraint '%s': %v", d.Environment.SDK, err)
+	}
+	for _, target := range d.Environment.Targets {
+		if !isValidTarget(target) {
+			return ui.ReportError("Invalid target in description '%s': '%s'", d.Name, target)
 		}
 	}
+	if d.Deprecated != nil && d.Deprecated.Message == "" {
+		return ui.ReportError("Deprecation of description '%s' is missing a message", d.Name)
+	}
 
 	// TODO(florian): enable this check.
 	/*
@@ -305,6 +368,13 @@ func scrapeDescriptionAt(path string, allowsLocalDeps AllowLocalDepsFlag, ui UI,
 					return nil, ui.ReportError("Dependency to local path: '%s'", dep.Path)
 				}
 			}
+			if dep.Ref != "" {
+				if allowsLocalDeps == ReportLocalDeps {
+					ui.ReportWarning("Dependency to git reference: '%s' - '%s'", dep.URL, dep.Ref)
+				} else {
+					return nil, ui.ReportError("Dependency to git reference: '%s' - '%s'", dep.URL, dep.Ref)
+				}
+			}
 		}
 	}
 	desc := NewDesc(spec.Name,
@@ -316,6 +386,13 @@ func scrapeDescriptionAt(path string, allowsLocalDeps AllowLocalDepsFlag, ui UI,
 		"<Not scraped for local paths>",
 		mapSpecDepsToDescDeps(spec.Deps),
 	)
+	desc.Environment.Targets = spec.Environment.Targets
+	desc.Authors = spec.Authors
+	desc.Homepage = spec.Homepage
+	desc.Repository = spec.Repository
+	desc.Documentation = spec.Documentation
+	desc.Keywords = spec.allKeywords()
+	desc.Readme = spec.Readme
 
 	// Packages must have a 'src' directory.
 	srcPath := filepath.Join(path, "src")
@@ -344,33 +421,46 @@ func scrapeDescriptionAt(path string, allowsLocalDeps AllowLocalDepsFlag, ui UI,
 		}
 	}
 
+	if desc.Readme != "" {
+		readmePath := filepath.Join(path, filepath.FromSlash(desc.Readme))
+		if exists, err := isFile(readmePath); err != nil {
+			return nil, err
+		} else if !exists {
+			ui.ReportWarning("Readme file '%s' not found", desc.Readme)
+		}
+	}
+
 	if desc.License != "" {
-		if !validateLicenseID(desc.License) {
+		expression, err := ParseLicenseExpression(desc.License)
+		if err != nil && strings.ContainsAny(desc.License, " ()") {
+			ui.ReportWarning("Invalid SPDX license expression '%s': %v", desc.License, err)
+		} else if err != nil {
 			ui.ReportWarning("Unknown SDIX license-ID: '%s'", desc.License)
+		} else {
+			desc.License = expression.String()
 		}
 	} else {
-		licensePath := filepath.Join(path, "LICENSE")
-		licenseStat, err := os.Stat(licensePath)
-		if os.IsNotExist(err) {
-			verbose("No 'LICENSE' file found")
-			ui.ReportWarning("Missing license")
-		} else if err != nil {
+		matches, err := detectLicenseFiles(path)
+		if err != nil {
 			return nil, err
-		} else if licenseStat.IsDir() {
-			verbose("'LICENSE' path is a directory")
+		}
+		if len(matches) == 0 {
+			verbose("No license file found")
 			ui.ReportWarning("Missing license")
-		} else {
-			content, err := ioutil.ReadFile(licensePath)
-			if err != nil {
-				return nil, err
+		}
+		for _, match := range matches {
+			if match.IsDetected() {
+				verbose("Using license '%s' from '%s' file (confidence %.0f%%)", match.License, match.File, match.Confidence*100)
+				continue
 			}
-			licenseID := guessLicense(content)
-			if licenseID == "" {
-				ui.ReportWarning("Unknown license in 'LICENSE' file")
-			} else {
-				verbose("Using license '%s' from 'LICENSE' file", licenseID)
-				desc.License = licenseID
+			if match.License != "" {
+				verbose("Closest license to '%s' file is '%s' (confidence %.0f%%)", match.File, match.License, match.Confidence*100)
 			}
+			ui.ReportWarning("Unknown license in '%s' file", match.File)
+		}
+		desc.License = combineLicenseMatches(matches)
+		if strings.Contains(desc.License, " "+LicenseAnd+" ") {
+			ui.ReportWarning("Found several licenses in the license files. Using '%s'", desc.License)
 		}
 	}
 
@@ -440,6 +530,10 @@ func ScrapeDescriptionGit(ctx context.Context, url string, v string, allowsLocal
 	if err != nil {
 		return nil, err
 	}
+	// The spec was already successfully read by the scraping.
+	if spec, err := ReadSpec(filepath.Join(dir, DefaultSpecName), nullUI{}); err == nil && spec.Version != "" && !isSameVersion(spec.Version, v) {
+		return nil, ui.ReportError("Version in '%s' is '%s', but the tag is for version '%s'", DefaultSpecName, spec.Version, v)
+	}
 	desc.URL = url
 	desc.Version = v
 	desc.Hash = downloadedHash
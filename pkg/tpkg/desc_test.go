@@ -16,6 +16,8 @@
 package tpkg
 
 import (
+	"bytes"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -75,3 +77,81 @@ func Test_CaretVersion(t *testing.T) {
 		}
 	})
 }
+
+func Test_DescUnknownFields(t *testing.T) {
+	ui := &testUI{}
+	desc := &Desc{}
+	err := desc.ParseString(`name: foo
+url: github.com/foo/foo
+version: 1.0.0
+dependancies:
+  - url: github.com/foo/bar
+    version: ^1.0.0
+custom:
+  key: value
+dependencies:
+  - url: github.com/foo/gee
+    version: ^2.0.0
+    mirror: github.com/other/gee
+`, ui)
+	require.NoError(t, err)
+	// Registries are parsed for most commands. Parsing only reports infos.
+	assert.Equal(t, []string{
+		"Info: Unknown field 'custom'",
+		"Info: Unknown field 'dependancies'",
+		"Info: Unknown field 'mirror' for dependency 'github.com/foo/gee'",
+	}, ui.messages)
+
+	ui = &testUI{}
+	desc.reportUnknownFields(ui, true)
+	assert.Equal(t, []string{
+		"Warning: Unknown field 'custom'",
+		"Warning: Unknown field 'dependancies'",
+		"Warning: Unknown field 'mirror' for dependency 'github.com/foo/gee'",
+	}, ui.messages)
+
+	var b bytes.Buffer
+	err = desc.WriteYAML(&b)
+	require.NoError(t, err)
+
+	reparsed := &Desc{}
+	err = reparsed.ParseString(b.String(), &testUI{})
+	require.NoError(t, err)
+	assert.Equal(t, desc.Extra, reparsed.Extra)
+	assert.Equal(t, "github.com/other/gee", reparsed.Deps[0].Extra["mirror"])
+	assert.Contains(t, b.String(), "dependancies:")
+}
+
+func Test_DescYankedDeprecated(t *testing.T) {
+	desc := &Desc{}
+	err := desc.ParseString(`name: foo
+url: github.com/foo/foo
+version: 1.0.0
+yanked: Broken on ESP32
+deprecated:
+  message: Use bar
+  replacement: github.com/foo/bar
+`, &testUI{})
+	require.NoError(t, err)
+	assert.Equal(t, "Broken on ESP32", desc.Yanked)
+	assert.Equal(t, &DescDeprecation{Message: "Use bar", Replacement: "github.com/foo/bar"}, desc.Deprecated)
+
+	ui := &testUI{}
+	err = (&Desc{}).ParseString(`name: foo
+url: github.com/foo/foo
+version: 1.0.0
+deprecated:
+  replacement: github.com/foo/bar
+`, ui)
+	assert.True(t, IsErrAlreadyReported(err))
+	assert.Equal(t, []string{"Error: Deprecation of description 'foo' is missing a message"}, ui.messages)
+}
+
+func Test_DescParseError(t *testing.T) {
+	ui := &testUI{}
+	err := (&Desc{}).ParseString("name: [foo\n", ui)
+	assert.True(t, IsErrAlreadyReported(err))
+	require.Len(t, ui.messages, 1)
+	assert.True(t, strings.HasPrefix(ui.messages[0], "Error: Failed to parse package description: yaml: "), ui.messages[0])
+	assert.NotContains(t, ui.messages[0], "%!w")
+}
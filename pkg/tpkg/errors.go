@@ -0,0 +1,137 @@
+// Copyright (C) 2021 Toitware ApS.
+//
+// This library is free software; you can redistribute it and/or
+// modify it under the terms of the GNU Lesser General Public
+// License as published by the Free Software Foundation; version
+// 2.1 only.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Lesser General Public License for more details.
+//
+// The license can be found in the file `LICENSE` in the top level
+// directory of this repository.
+
+package tpkg
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The errors in this file are returned for failures that callers might
+// want to handle differently.
+//
+// Like all errors of this package, they are reported to the UI before they
+// are returned. As such, they all satisfy `errors.Is(err, ErrAlreadyReported)`.
+// Use `errors.As` to find out which kind of failure happened.
+
+// alreadyReported is embedded in all typed errors of this package.
+type alreadyReported struct{}
+
+// Is makes `errors.Is(err, ErrAlreadyReported)` true for all typed errors.
+func (alreadyReported) Is(target error) bool {
+	return target == ErrAlreadyReported
+}
+
+// PackageNotFoundError is returned when no package matches a given name or URL.
+type PackageNotFoundError struct {
+	alreadyReported
+	// The name or (partial) URL that was searched for.
+	Name string
+	// The requested version. Empty if any version was acceptable.
+	Version string
+}
+
+func (e *PackageNotFoundError) Error() string {
+	if e.Version != "" {
+		return fmt.Sprintf("package '%s' with version %s not found", e.Name, e.Version)
+	}
+	return fmt.Sprintf("package '%s' not found", e.Name)
+}
+
+// AmbiguousPackageError is returned when a name or URL matches more than one package.
+type AmbiguousPackageError struct {
+	alreadyReported
+	// The name or (partial) URL that was searched for.
+	Name string
+	// The URLs of the matching packages.
+	Candidates []string
+}
+
+func (e *AmbiguousPackageError) Error() string {
+	return fmt.Sprintf("more than one matching package '%s' found: %s", e.Name, strings.Join(e.Candidates, ", "))
+}
+
+// NoSolutionError is returned when the solver can't find versions for all packages
+// that satisfy the constraints.
+type NoSolutionError struct {
+	alreadyReported
+	// The conflicts the solver encountered. For example, dependencies for which no
+	// version satisfied the constraint.
+	Conflicts []string
+}
+
+func (e *NoSolutionError) Error() string {
+	if len(e.Conflicts) == 0 {
+		return "no valid solution for the package constraints"
+	}
+	return "no valid solution for the package constraints: " + strings.Join(e.Conflicts, "; ")
+}
+
+// InvalidSpecError is returned when a package specification (package.yaml) is invalid.
+type InvalidSpecError struct {
+	alreadyReported
+	// The path to the specification. May be empty if the specification
+	// wasn't read from a file.
+	Path string
+	// Why the specification is invalid.
+	Reason string
+}
+
+func (e *InvalidSpecError) Error() string {
+	if e.Path != "" {
+		return fmt.Sprintf("invalid package specification '%s': %s", e.Path, e.Reason)
+	}
+	return "invalid package specification: " + e.Reason
+}
+
+// DownloadError is returned when a package couldn't be downloaded.
+type DownloadError struct {
+	alreadyReported
+	URL     string
+	Version string
+	// The underlying error.
+	Err error
+}
+
+func (e *DownloadError) Error() string {
+	return fmt.Sprintf("failed to download '%s' - '%s': %v", e.URL, e.Version, e.Err)
+}
+
+func (e *DownloadError) Unwrap() error {
+	return e.Err
+}
+
+// reportError reports the formatted message to the UI, and returns the given error.
+func reportError(ui UI, err error, format string, a ...interface{}) error {
+	ui.ReportError(format, a...)
+	return err
+}
+
+// reportSpecError reports the formatted message to the UI, and returns an
+// InvalidSpecError with the message as reason.
+func reportSpecError(ui UI, path string, format string, a ...interface{}) error {
+	return reportSpecErrorAt(ui, Location{File: path}, format, a...)
+}
+
+// reportSpecErrorAt is like reportSpecError, but also reports the line of
+// the problem if the UI supports it.
+func reportSpecErrorAt(ui UI, loc Location, format string, a ...interface{}) error {
+	reportErrorAt(ui, loc, format, a...)
+	return &InvalidSpecError{
+		Path:   loc.File,
+		Reason: fmt.Sprintf(format, a...),
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright (C) 2021 Toitware ApS.
+//
+// This library is free software; you can redistribute it and/or
+// modify it under the terms of the GNU Lesser General Public
+// License as published by the Free Software Foundation; version
+// 2.1 only.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Lesser General Public License for more details.
+//
+// The license can be found in the file `LICENSE` in the top level
+// directory of this repository.
+
+package tpkg
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_TypedErrors(t *testing.T) {
+	t.Run("Is/As", func(t *testing.T) {
+		gitErr := fmt.Errorf("repository not found")
+		errs := []error{
+			&PackageNotFoundError{Name: "foo"},
+			&AmbiguousPackageError{Name: "foo", Candidates: []string{"a/foo", "b/foo"}},
+			&NoSolutionError{Conflicts: []string{"Package 'foo' not found"}},
+			&InvalidSpecError{Path: "package.yaml", Reason: "Invalid name: 'bad name'"},
+			&DownloadError{URL: "github.com/foo/bar", Version: "1.0.0", Err: gitErr},
+		}
+		for _, err := range errs {
+			assert.True(t, errors.Is(err, ErrAlreadyReported), err.Error())
+			assert.True(t, IsErrAlreadyReported(err), err.Error())
+			wrapped := fmt.Errorf("wrapped: %w", err)
+			assert.True(t, IsErrAlreadyReported(wrapped), err.Error())
+		}
+
+		var notFound *PackageNotFoundError
+		assert.True(t, errors.As(fmt.Errorf("wrapped: %w", errs[0]), &notFound))
+		assert.Equal(t, "foo", notFound.Name)
+		assert.False(t, errors.As(errs[1], &notFound))
+
+		var downloadErr *DownloadError
+		require.True(t, errors.As(errs[4], &downloadErr))
+		assert.True(t, errors.Is(downloadErr, gitErr))
+		assert.Equal(t, "failed to download 'github.com/foo/bar' - '1.0.0': repository not found", downloadErr.Error())
+	})
+
+	t.Run("NoSolution", func(t *testing.T) {
+		a1 := mkPkg("a-1.7.0", "b ^1.0.0")
+		b234 := mkPkg("b-2.3.4")
+		registries := makeRegistries(a1, b234)
+
+		ui := &testUI{}
+		solver, err := NewSolver(registries, nil, ui)
+		require.NoError(t, err)
+		deps, err := convertDeps(a1.Deps)
+		require.NoError(t, err)
+		assert.Nil(t, solver.Solve(nil, deps))
+		assert.Equal(t, []string{"No version of 'b' satisfies constraint '>=1.0.0,<2.0.0'"}, solver.Conflicts())
+	})
+
+	t.Run("InvalidSpec", func(t *testing.T) {
+		dir := t.TempDir()
+		specPath := filepath.Join(dir, "package.yaml")
+		err := os.WriteFile(specPath, []byte(`
+dependencies:
+  "bad prefix":
+    url: github.com/foo/bar
+    version: ^1.0.0
+`), 0644)
+		require.NoError(t, err)
+
+		ui := &testUI{}
+		_, err = ReadSpec(specPath, ui)
+		var specErr *InvalidSpecError
+		require.True(t, errors.As(err, &specErr))
+		assert.Equal(t, specPath, specErr.Path)
+		assert.Equal(t, "Invalid prefix: 'bad prefix'", specErr.Reason)
+		assert.Equal(t, []string{"Error: Invalid prefix: 'bad prefix'"}, ui.messages)
+	})
+}
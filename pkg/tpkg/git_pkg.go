@@ -17,6 +17,7 @@ package tpkg
 
 import (
 	"context"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -144,7 +145,11 @@ func DownloadGit(ctx context.Context, o DownloadGitOptions) (string, error) {
 	})
 
 	if err != nil {
-		return "", o.UI.ReportError("Error while cloning '%s' with tag '%s': %v", o.URL, tag, err)
+		return "", reportError(o.UI, &DownloadError{
+			URL:     o.URL,
+			Version: o.Version,
+			Err:     err,
+		}, "Error while cloning '%s' with tag '%s': %v", o.URL, tag, err)
 	}
 
 	if checkoutDir == o.Directory {
@@ -159,7 +164,11 @@ func DownloadGit(ctx context.Context, o DownloadGitOptions) (string, error) {
 	nestedPath := filepath.Join(checkoutDir, filepath.FromSlash(path))
 	stat, err := os.Stat(nestedPath)
 	if os.IsNotExist(err) {
-		return "", o.UI.ReportError("Repository '%s' does not have path '%s'", o.URL, path)
+		return "", reportError(o.UI, &DownloadError{
+			URL:     o.URL,
+			Version: o.Version,
+			Err:     fmt.Errorf("repository does not have path '%s'", path),
+		}, "Repository '%s' does not have path '%s'", o.URL, path)
 	} else if err != nil {
 		return "", err
 	} else if !stat.IsDir() {
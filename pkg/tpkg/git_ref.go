@@ -0,0 +1,282 @@
+// Copyright (C) 2021 Toitware ApS.
+//
+// This library is free software; you can redistribute it and/or
+// modify it under the terms of the GNU Lesser General Public
+// License as published by the Free Software Foundation; version
+// 2.1 only.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Lesser General Public License for more details.
+//
+// The license can be found in the file `LICENSE` in the top level
+// directory of this repository.
+
+package tpkg
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/toitlang/tpkg/pkg/git"
+	"github.com/toitlang/tpkg/pkg/tracking"
+)
+
+// Git-ref dependencies point to a git URL and a ref (a branch, tag, or
+// commit) instead of a package in a registry. The dependencies of such a
+// package are read from the package file of the checked out repository.
+// Git-ref packages are locked by the hash of the commit. They don't have
+// a real version, so we give them a pseudo version that is derived from
+// the hash. All dependencies on the URL use that version.
+// Git-ref packages are always checked out into the packages directory of the
+// project. They don't use the package store, even if it is enabled.
+// Git references can't be used in overrides.
+
+// gitRefPackage is a resolved git-ref dependency.
+type gitRefPackage struct {
+	url string
+	ref string
+	// The hash of the checked out commit.
+	hash string
+	// The pseudo version, derived from the hash.
+	version string
+	deps    []SolverDep
+	sdk     *sdkConstraint
+	targets []string
+}
+
+// gitRefVersion returns the pseudo version of a git-ref package with the
+// given hash.
+func gitRefVersion(hash string) string {
+	short := hash
+	if len(short) > 12 {
+		short = short[:12]
+	}
+	return "0.0.0-git-" + short
+}
+
+// gitRefDeps returns the git-ref dependencies of the spec and of its local
+// dependencies.
+func (s *Spec) gitRefDeps(ui UI) ([]SpecPackage, error) {
+	result := []SpecPackage{}
+	memberDirs, err := s.workspaceMemberDirs()
+	if err != nil {
+		return nil, err
+	}
+	err = s.visitLocalDeps(ui, func(_ string, fullPath string, depSpec *Spec) error {
+		if depSpec == nil {
+			return nil
+		}
+		for _, dep := range s.resolvedDeps(depSpec, fullPath, memberDirs) {
+			if dep.Path == "" && dep.Ref != "" {
+				result = append(result, dep)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// gitRefsChanged returns whether the entry spec has git-ref dependencies that
+// aren't locked with the same ref in the given lock file.
+func gitRefsChanged(spec *Spec, lf *LockFile) bool {
+	for _, dep := range spec.allDeps() {
+		if dep.Path != "" || dep.Ref == "" {
+			continue
+		}
+		found := false
+		for _, pe := range lf.Packages {
+			if pe.URL.URL() == dep.URL && pe.Ref == dep.Ref && pe.Hash != "" {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveGitRefs finds the commits of all git-ref dependencies of the spec,
+// downloads them, and reads their dependencies. Git-ref dependencies of the
+// downloaded packages are resolved as well.
+// If the old lock file has a hash for a dependency with the same ref, then
+// that hash is used. Otherwise the ref is fetched again.
+func (m *ProjectPkgManager) resolveGitRefs(ctx context.Context, spec *Spec, oldLock *LockFile) (map[string]*gitRefPackage, error) {
+	queue, err := spec.gitRefDeps(m.ui)
+	if err != nil {
+		return nil, err
+	}
+	result := map[string]*gitRefPackage{}
+	for len(queue) > 0 {
+		dep := queue[0]
+		queue = queue[1:]
+		if existing, ok := result[dep.URL]; ok {
+			if existing.ref != dep.Ref {
+				return nil, m.ui.ReportError("Conflicting git references for '%s': '%s' and '%s'", dep.URL, existing.ref, dep.Ref)
+			}
+			continue
+		}
+
+		lockedHash := ""
+		if oldLock != nil {
+			for _, pe := range oldLock.Packages {
+				if pe.URL.URL() == dep.URL && pe.Ref == dep.Ref {
+					lockedHash = pe.Hash
+					break
+				}
+			}
+		}
+		hash, err := m.downloadGitRef(ctx, dep.URL, dep.Ref, lockedHash)
+		if err != nil {
+			return nil, err
+		}
+
+		pkg := &gitRefPackage{
+			url:     dep.URL,
+			ref:     dep.Ref,
+			hash:    hash,
+			version: gitRefVersion(hash),
+			deps:    []SolverDep{},
+		}
+		result[dep.URL] = pkg
+
+		specPath, err := m.cache.SpecPathFor(m.Paths.ProjectRootPath, pkg.url, pkg.version)
+		if err != nil {
+			return nil, err
+		}
+		pkgSpec, err := ReadSpec(specPath, m.ui)
+		if err != nil {
+			return nil, err
+		}
+		pkg.sdk, err = parseSDKConstraint(pkgSpec.Environment.SDK)
+		if err != nil {
+			return nil, err
+		}
+		pkg.targets = pkgSpec.Environment.Targets
+		for prefix, pkgDep := range pkgSpec.Deps {
+			if pkgDep.Path != "" {
+				return nil, m.ui.ReportError("Path dependency '%s: %s' not allowed in git reference '%s'", prefix, pkgDep.Path, dep.URL)
+			}
+			if pkgDep.Ref != "" {
+				queue = append(queue, pkgDep)
+			}
+			solverDep, err := NewSolverDep(pkgDep.URL, pkgDep.Version)
+			if err != nil {
+				return nil, err
+			}
+			pkg.deps = append(pkg.deps, solverDep)
+		}
+	}
+	return result, nil
+}
+
+// downloadGitRef downloads the git-ref package with the given url and ref.
+// If the hash is given, checks out that commit instead of the ref.
+// Does nothing if the package is already in the cache.
+// Returns the hash of the checked out commit.
+func (m *ProjectPkgManager) downloadGitRef(ctx context.Context, url string, ref string, hash string) (string, error) {
+	projectRoot := m.Paths.ProjectRootPath
+	if hash != "" {
+		packagePath, err := m.cache.FindPkg(projectRoot, url, gitRefVersion(hash))
+		if err != nil {
+			return "", err
+		}
+		if packagePath != "" {
+			return hash, nil
+		}
+	}
+	if err := m.cache.CreatePackagesCacheDir(projectRoot, m.ui); err != nil {
+		return "", err
+	}
+
+	checkout := ref
+	if hash != "" {
+		checkout = hash
+	}
+	event := &tracking.Event{
+		Name: "toit pkg download-git",
+		Properties: map[string]string{
+			"url":  url,
+			"ref":  ref,
+			"hash": hash,
+		},
+	}
+	downloadedHash, err := m.downloadGitRefToCache(ctx, url, checkout)
+	if err != nil {
+		event.Properties["error"] = err.Error()
+	}
+	m.track(ctx, event)
+	return downloadedHash, err
+}
+
+func (m *ProjectPkgManager) downloadGitRefToCache(ctx context.Context, url string, checkout string) (string, error) {
+	projectRoot := m.Paths.ProjectRootPath
+	cloneURL := ""
+	path := ""
+	if strings.HasPrefix(url, TestGitPathHost+"/") {
+		cloneURL = filepath.FromSlash(strings.TrimPrefix(url, TestGitPathHost+"/"))
+	} else {
+		cloneURL, path = decomposePkgURL(url)
+	}
+
+	// We don't know the final location until we know the hash. Check out into
+	// a temporary directory next to the packages. It must be on the same drive,
+	// as we are using a rename to move the package to its final position.
+	checkoutDir, err := ioutil.TempDir(m.cache.PkgInstallPath(projectRoot), "partial-toit-checkout")
+	if err != nil {
+		return "", m.ui.ReportError("Failed to create temporary directory to download '%s' - '%s': %v", url, checkout, err)
+	}
+	defer os.RemoveAll(checkoutDir)
+
+	hash, err := git.CloneRef(ctx, checkoutDir, cloneURL, checkout)
+	if err != nil {
+		return "", reportError(m.ui, &DownloadError{
+			URL:     url,
+			Version: checkout,
+			Err:     err,
+		}, "Error while cloning '%s' at '%s': %v", url, checkout, err)
+	}
+
+	version := gitRefVersion(hash)
+	packagePath, err := m.cache.FindPkg(projectRoot, url, version)
+	if err != nil {
+		return "", err
+	}
+	if packagePath != "" {
+		// A different ref pointed to the same commit.
+		return hash, nil
+	}
+
+	nestedPath := filepath.Join(checkoutDir, filepath.FromSlash(path))
+	stat, err := os.Stat(nestedPath)
+	if os.IsNotExist(err) {
+		return "", reportError(m.ui, &DownloadError{
+			URL:     url,
+			Version: checkout,
+			Err:     err,
+		}, "Repository '%s' does not have path '%s'", url, path)
+	} else if err != nil {
+		return "", err
+	} else if !stat.IsDir() {
+		return "", m.ui.ReportError("Path '%s' in repository '%s' is not a directory", path, url)
+	}
+
+	p := m.cache.PreferredPkgPath(projectRoot, url, version)
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return "", err
+	}
+	if err := os.Rename(nestedPath, p); err != nil {
+		return "", m.ui.ReportError("Failed to move package '%s' to its location '%s'", url, p)
+	}
+	makeContainedReadOnly(p, m.ui)
+	return hash, nil
+}
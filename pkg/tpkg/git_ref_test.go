@@ -0,0 +1,153 @@
+// Copyright (C) 2021 Toitware ApS.
+//
+// This library is free software; you can redistribute it and/or
+// modify it under the terms of the GNU Lesser General Public
+// License as published by the Free Software Foundation; version
+// 2.1 only.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Lesser General Public License for more details.
+//
+// The license can be found in the file `LICENSE` in the top level
+// directory of this repository.
+
+package tpkg
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/toitlang/tpkg/pkg/tracking"
+)
+
+// commitFile writes the file in the repository and commits it.
+// Returns the hash of the commit.
+func commitFile(t *testing.T, repository *git.Repository, dir string, name string, content string) string {
+	p := filepath.Join(dir, name)
+	require.NoError(t, os.MkdirAll(filepath.Dir(p), 0755))
+	require.NoError(t, os.WriteFile(p, []byte(content), 0644))
+	wt, err := repository.Worktree()
+	require.NoError(t, err)
+	_, err = wt.Add(name)
+	require.NoError(t, err)
+	hash, err := wt.Commit("Update "+name, &git.CommitOptions{
+		All: true,
+		Author: &object.Signature{
+			Name:  "Test Committer",
+			Email: "not_used@example.com",
+			When:  time.Now(),
+		},
+	})
+	require.NoError(t, err)
+	return hash.String()
+}
+
+func Test_GitRef(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	repoDir := filepath.Join(dir, "repo")
+	repository, err := git.PlainInit(repoDir, false)
+	require.NoError(t, err)
+	commitFile(t, repository, repoDir, DefaultSpecName, "name: fix\n")
+	firstHash := commitFile(t, repository, repoDir, "src/fix.toit", "main:\n")
+
+	projectDir := filepath.Join(dir, "project")
+	require.NoError(t, os.MkdirAll(projectDir, 0755))
+	url := TestGitPathHost + "/" + filepath.ToSlash(repoDir)
+	spec := newSpec(filepath.Join(projectDir, DefaultSpecName))
+	spec.Deps = DependencyMap{
+		"fix": {URL: url, Ref: "master"},
+	}
+	require.NoError(t, spec.WriteToFile())
+
+	ui := testUI{}
+	cache := NewCache("", &ui, WithPkgCachePath(filepath.Join(dir, "PKG_CACHE")))
+	manager := NewManager(Registries{}, cache, nil, &ui, tracking.NopTrack)
+	paths, err := NewProjectPaths(projectDir, "", "")
+	require.NoError(t, err)
+	m := NewProjectPkgManager(manager, paths)
+
+	readLock := func() PackageEntry {
+		lf, err := ReadLockFile(paths.LockFile)
+		require.NoError(t, err)
+		require.Contains(t, lf.Prefixes, "fix")
+		return lf.Packages[lf.Prefixes["fix"]]
+	}
+
+	require.NoError(t, m.Install(ctx, false))
+	entry := readLock()
+	assert.Equal(t, url, entry.URL.URL())
+	assert.Equal(t, "master", entry.Ref)
+	assert.Equal(t, firstHash, entry.Hash)
+	assert.Equal(t, "fix", entry.Name)
+	assert.Equal(t, gitRefVersion(firstHash), entry.Version)
+	pkgPath, err := cache.FindPkg(projectDir, url, entry.Version)
+	require.NoError(t, err)
+	assert.FileExists(t, filepath.Join(pkgPath, "src", "fix.toit"))
+
+	// New commits don't change the locked hash.
+	secondHash := commitFile(t, repository, repoDir, "src/fix.toit", "main:\n  print 1\n")
+	require.NoError(t, m.Install(ctx, true))
+	assert.Equal(t, firstHash, readLock().Hash)
+
+	// Updating fetches the ref again.
+	require.NoError(t, m.Update(ctx))
+	entry = readLock()
+	assert.Equal(t, secondHash, entry.Hash)
+	updatedSpec, err := ReadSpec(paths.SpecFile, &ui)
+	require.NoError(t, err)
+	assert.Equal(t, SpecPackage{URL: url, Ref: "master"}, updatedSpec.Deps["fix"])
+
+	// Refs can also be commits.
+	updatedSpec.Deps["fix"] = SpecPackage{URL: url, Ref: firstHash[:10]}
+	require.NoError(t, updatedSpec.WriteToFile())
+	require.NoError(t, m.Install(ctx, false))
+	entry = readLock()
+	assert.Equal(t, firstHash, entry.Hash)
+	assert.Equal(t, firstHash[:10], entry.Ref)
+	assert.Empty(t, ui.messages)
+}
+
+func Test_GitRefValidation(t *testing.T) {
+	tests := []struct {
+		yaml     string
+		expected string
+	}{
+		{
+			yaml: `
+dependencies:
+  fix:
+    ref: main
+    path: ../fix
+`,
+			expected: "Error: Package entry for prefix 'fix' has a git reference but no URL",
+		},
+		{
+			yaml: `
+dependencies:
+  fix:
+    url: github.com/foo/fix
+    version: ^1.0.0
+    ref: main
+`,
+			expected: "Error: Package entry for prefix 'fix' can't have both a version constraint and a git reference",
+		},
+	}
+	for _, test := range tests {
+		ui := testUI{}
+		spec := Spec{}
+		err := spec.ParseString(test.yaml, &ui)
+		assert.True(t, IsErrAlreadyReported(err))
+		assert.Equal(t, []string{test.expected}, ui.messages)
+	}
+}
@@ -0,0 +1,366 @@
+// Copyright (C) 2021 Toitware ApS.
+//
+// This library is free software; you can redistribute it and/or
+// modify it under the terms of the GNU Lesser General Public
+// License as published by the Free Software Foundation; version
+// 2.1 only.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Lesser General Public License for more details.
+//
+// The license can be found in the file `LICENSE` in the top level
+// directory of this repository.
+
+package tpkg
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	// The top-level libraries of the Toit SDK. Imports of these libraries
+	// don't need a dependency.
+	// Only used if the library directory of the SDK isn't known.
+	sdkLibraries = []string{
+		"ar",
+		"binary",
+		"bitmap",
+		"ble",
+		"bytes",
+		"core",
+		"crypto",
+		"device",
+		"encoding",
+		"esp32",
+		"expect",
+		"fixed_point",
+		"font",
+		"gpio",
+		"host",
+		"i2c",
+		"i2s",
+		"io",
+		"log",
+		"math",
+		"monitor",
+		"net",
+		"pulse_counter",
+		"reader",
+		"rmt",
+		"semver",
+		"serial",
+		"spi",
+		"system",
+		"tls",
+		"uart",
+		"uuid",
+		"writer",
+		"zlib",
+	}
+
+	// The directories of a package that are scanned for imports.
+	importSourceDirs = []string{"src", "tests"}
+
+	// Matches the path of an import statement. Relative imports (starting
+	// with '.') don't match.
+	importRegexp = regexp.MustCompile(`^import\s+([a-zA-Z_][a-zA-Z0-9_-]*(?:\.[a-zA-Z_][a-zA-Z0-9_-]*)*)`)
+)
+
+// ToitImport is an import statement in a Toit source file.
+type ToitImport struct {
+	// The imported path, like 'foo.bar'.
+	Path string `json:"path"`
+	// The file of the import, relative to the package, with '/' separators.
+	File string `json:"file"`
+	// The 1-based line of the import.
+	Line int `json:"line"`
+}
+
+// Prefix returns the first segment of the imported path. For imports of
+// packages, this is the prefix of the dependency.
+func (i ToitImport) Prefix() string {
+	return strings.SplitN(i.Path, ".", 2)[0]
+}
+
+// ImportCheck is the result of comparing the imports of a package with its
+// dependencies.
+type ImportCheck struct {
+	// The prefixes of dependencies that no source file imports. Sorted.
+	Unused []string
+	// The imports that are neither of a dependency nor of an SDK library.
+	// Sorted by file and line.
+	Missing []ToitImport
+}
+
+// scanToitImports returns the absolute imports of the given Toit source.
+// Imports in comments and multi-line strings are ignored.
+func scanToitImports(r io.Reader, file string) ([]ToitImport, error) {
+	result := []ToitImport{}
+	scanner := bufio.NewScanner(r)
+	inComment := false
+	inString := false
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := scanner.Text()
+		if !inComment && !inString {
+			if match := importRegexp.FindStringSubmatch(line); match != nil {
+				result = append(result, ToitImport{
+					Path: match[1],
+					File: file,
+					Line: lineNumber,
+				})
+			}
+		}
+		// Track block comments and multi-line strings, so that their content
+		// isn't mistaken for imports.
+		for i := 0; i < len(line); i++ {
+			rest := line[i:]
+			switch {
+			case inComment:
+				if strings.HasPrefix(rest, "*/") {
+					inComment = false
+					i++
+				}
+			case inString:
+				if strings.HasPrefix(rest, `"""`) {
+					inString = false
+					i += 2
+				}
+			case strings.HasPrefix(rest, "//"):
+				i = len(line)
+			case strings.HasPrefix(rest, "/*"):
+				inComment = true
+				i++
+			case strings.HasPrefix(rest, `"""`):
+				inString = true
+				i += 2
+			case rest[0] == '"' || rest[0] == '\'':
+				// Skip single-line strings and characters.
+				for i++; i < len(line) && line[i] != rest[0]; i++ {
+					if line[i] == '\\' {
+						i++
+					}
+				}
+			}
+		}
+	}
+	return result, scanner.Err()
+}
+
+// collectToitImports returns the imports of all Toit files in the source
+// directories of the package at the given path.
+func collectToitImports(path string) ([]ToitImport, error) {
+	result := []ToitImport{}
+	for _, dir := range importSourceDirs {
+		root := filepath.Join(path, dir)
+		stat, err := os.Stat(root)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		} else if !stat.IsDir() {
+			continue
+		}
+		err = filepath.WalkDir(root, func(p string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if entry.IsDir() {
+				if p != root && (entry.Name() == ProjectPackagesPath || strings.HasPrefix(entry.Name(), ".")) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if filepath.Ext(p) != ".toit" {
+				return nil
+			}
+			rel, err := filepath.Rel(path, p)
+			if err != nil {
+				return err
+			}
+			f, err := os.Open(p)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			imports, err := scanToitImports(f, filepath.ToSlash(rel))
+			if err != nil {
+				return err
+			}
+			result = append(result, imports...)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// readSDKLibraries returns the top-level libraries of the SDK library
+// directory at the given path. These are the directories and the '.toit'
+// files of the directory.
+// If the path is empty, returns the built-in list of SDK libraries.
+func readSDKLibraries(libPath string) ([]string, error) {
+	if libPath == "" {
+		return sdkLibraries, nil
+	}
+	entries, err := os.ReadDir(libPath)
+	if err != nil {
+		return nil, err
+	}
+	result := []string{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+		if entry.IsDir() {
+			result = append(result, name)
+		} else if filepath.Ext(name) == ".toit" {
+			result = append(result, strings.TrimSuffix(name, ".toit"))
+		}
+	}
+	return result, nil
+}
+
+// checkImports compares the imports of the package at the given path with
+// the dependencies of its spec.
+// Imports may use dependencies and dev dependencies, but only dependencies
+// are reported as unused. Dev dependencies are often only used by tools.
+// Imports of the package itself (by its name) and of the given SDK libraries
+// don't need a dependency.
+// If testsSpec is not nil, the files in the 'tests' directory are checked
+// against its dependencies instead. Its unused dependencies aren't reported.
+func checkImports(path string, spec *Spec, testsSpec *Spec, sdkLibs []string) (*ImportCheck, error) {
+	imports, err := collectToitImports(path)
+	if err != nil {
+		return nil, err
+	}
+	known := map[string]bool{}
+	for _, lib := range sdkLibs {
+		known[lib] = true
+	}
+	if spec.Name != "" {
+		known[spec.Name] = true
+	}
+	deps := spec.allDeps()
+	var testsDeps DependencyMap
+	if testsSpec != nil {
+		testsDeps = testsSpec.allDeps()
+	}
+	used := map[string]bool{}
+	result := &ImportCheck{
+		Unused:  []string{},
+		Missing: []ToitImport{},
+	}
+	for _, imp := range imports {
+		prefix := imp.Prefix()
+		if testsSpec != nil && strings.HasPrefix(imp.File, "tests/") {
+			if _, ok := testsDeps[prefix]; !ok && !known[prefix] {
+				result.Missing = append(result.Missing, imp)
+			}
+			continue
+		}
+		if _, ok := deps[prefix]; ok {
+			used[prefix] = true
+		} else if !known[prefix] {
+			result.Missing = append(result.Missing, imp)
+		}
+	}
+	for prefix := range spec.Deps {
+		if !used[prefix] {
+			result.Unused = append(result.Unused, prefix)
+		}
+	}
+	sort.Strings(result.Unused)
+	sort.SliceStable(result.Missing, func(i, j int) bool {
+		if result.Missing[i].File != result.Missing[j].File {
+			return result.Missing[i].File < result.Missing[j].File
+		}
+		return result.Missing[i].Line < result.Missing[j].Line
+	})
+	return result, nil
+}
+
+// CheckImports scans the Toit sources of the project ('src' and 'tests') for
+// imports, and compares them with the dependencies in the package file.
+// If the 'tests' directory has its own package file, the tests are checked
+// against that one.
+// In a workspace member, the sources of the member are checked against its
+// package file.
+// The sdkLibPath is the library directory of the SDK. If it is empty, a
+// built-in list of SDK libraries is used.
+func (m *ProjectPkgManager) CheckImports(sdkLibPath string) (*ImportCheck, error) {
+	projectSpec, _, err := m.readSpecAndLock()
+	if err != nil {
+		return nil, err
+	}
+	spec, err := m.readDepsSpec(projectSpec)
+	if err != nil {
+		return nil, err
+	}
+	sdkLibs, err := readSDKLibraries(sdkLibPath)
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Dir(spec.path)
+	var testsSpec *Spec
+	testsSpecPath := filepath.Join(path, "tests", DefaultSpecName)
+	if ok, err := isFile(testsSpecPath); err != nil {
+		return nil, err
+	} else if ok {
+		testsSpec, err = ReadSpec(testsSpecPath, m.ui)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return checkImports(path, spec, testsSpec, sdkLibs)
+}
+
+// RemoveDeps removes the dependencies with the given prefixes from the
+// package file, and updates the lock file.
+// In a workspace member, the dependencies are removed from the package file
+// of the member.
+// Fails if the license policy of the project doesn't allow the license of a
+// dependency.
+func (m *ProjectPkgManager) RemoveDeps(ctx context.Context, prefixes []string) error {
+	spec, lf, err := m.readSpecAndLock()
+	if err != nil {
+		return err
+	}
+	depsSpec, err := m.readDepsSpec(spec)
+	if err != nil {
+		return err
+	}
+	for _, prefix := range prefixes {
+		delete(depsSpec.Deps, prefix)
+	}
+
+	updatedLock, err := m.updateDeps(spec, depsSpec, func() (*LockFile, error) {
+		updatedLock, err := m.solveAndDownload(ctx, spec, lf)
+		if err != nil {
+			return nil, err
+		}
+		if err := m.enforceLicensePolicy(updatedLock); err != nil {
+			return nil, err
+		}
+		return updatedLock, nil
+	})
+	if err != nil {
+		return err
+	}
+	m.reportDeprecations(updatedLock)
+	return nil
+}
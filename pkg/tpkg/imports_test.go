@@ -0,0 +1,278 @@
+// Copyright (C) 2021 Toitware ApS.
+//
+// This library is free software; you can redistribute it and/or
+// modify it under the terms of the GNU Lesser General Public
+// License as published by the Free Software Foundation; version
+// 2.1 only.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Lesser General Public License for more details.
+//
+// The license can be found in the file `LICENSE` in the top level
+// directory of this repository.
+
+package tpkg
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_CheckImports(t *testing.T) {
+	t.Run("Scan", func(t *testing.T) {
+		source := `import foo
+import foo.bar.gee show *
+import kebab-case as kebab
+import .local
+import ..parent.lib
+// import commented
+/*
+import block_comment
+*/
+main:
+  print "/*"
+  print """
+import in_string
+"""
+  x := '"'
+import after
+ import indented
+`
+		imports, err := scanToitImports(strings.NewReader(source), "src/main.toit")
+		require.NoError(t, err)
+		assert.Equal(t, []ToitImport{
+			{Path: "foo", File: "src/main.toit", Line: 1},
+			{Path: "foo.bar.gee", File: "src/main.toit", Line: 2},
+			{Path: "kebab-case", File: "src/main.toit", Line: 3},
+			{Path: "after", File: "src/main.toit", Line: 16},
+		}, imports)
+		assert.Equal(t, "foo", imports[1].Prefix())
+	})
+
+	t.Run("Check", func(t *testing.T) {
+		dir := t.TempDir()
+		writeLintFiles(t, dir, map[string]string{
+			DefaultSpecName: `name: app
+dependencies:
+  used:
+    url: github.com/foo/used
+  tested:
+    url: github.com/foo/tested
+  unused:
+    url: github.com/foo/unused
+dev_dependencies:
+  helper:
+    path: ../helper
+  tool:
+    path: ../tool
+`,
+			"src/main.toit":            "import used.lib\nimport net\nimport missing.foo\n",
+			"src/nested/other.toit":    "import .main\nimport core show *\nimport encoding.json\nimport app.helpers\n",
+			"src/notes.txt":            "import ignored\n",
+			"src/.hidden/ignored.toit": "import ignored\n",
+			"tests/test.toit":          "import tested\nimport helper\nimport expect show *\nimport other\n",
+			"examples/example.toit":    "import ignored\n",
+		})
+		ui := testUI{}
+		m := ProjectPkgManager{
+			Manager: &Manager{ui: &ui},
+			Paths: &ProjectPaths{
+				ProjectRootPath: dir,
+				LockFile:        filepath.Join(dir, DefaultLockFileName),
+				SpecFile:        filepath.Join(dir, DefaultSpecName),
+			},
+		}
+		check, err := m.CheckImports("")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"unused"}, check.Unused)
+		assert.Equal(t, []ToitImport{
+			{Path: "missing.foo", File: "src/main.toit", Line: 3},
+			{Path: "other", File: "tests/test.toit", Line: 4},
+		}, check.Missing)
+		assert.Empty(t, ui.messages)
+	})
+
+	t.Run("Tests Spec", func(t *testing.T) {
+		dir := t.TempDir()
+		writeLintFiles(t, dir, map[string]string{
+			DefaultSpecName: `name: app
+dependencies:
+  used:
+    url: github.com/foo/used
+  tests_only:
+    url: github.com/foo/tests_only
+`,
+			"tests/" + DefaultSpecName: `name: tests
+dependencies:
+  app:
+    path: ..
+  tests_only:
+    url: github.com/foo/tests_only
+`,
+			"src/main.toit":   "import used\n",
+			"tests/test.toit": "import app\nimport tests_only\nimport used\nimport expect\n",
+		})
+		ui := testUI{}
+		m := ProjectPkgManager{
+			Manager: &Manager{ui: &ui},
+			Paths: &ProjectPaths{
+				ProjectRootPath: dir,
+				LockFile:        filepath.Join(dir, DefaultLockFileName),
+				SpecFile:        filepath.Join(dir, DefaultSpecName),
+			},
+		}
+		check, err := m.CheckImports("")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"tests_only"}, check.Unused)
+		assert.Equal(t, []ToitImport{
+			{Path: "used", File: "tests/test.toit", Line: 3},
+		}, check.Missing)
+		assert.Empty(t, ui.messages)
+	})
+
+	t.Run("SDK Lib Path", func(t *testing.T) {
+		dir := t.TempDir()
+		libDir := filepath.Join(dir, "lib")
+		projectDir := filepath.Join(dir, "project")
+		writeLintFiles(t, dir, map[string]string{
+			"lib/core/core.toit":         "",
+			"lib/new_lib/foo.toit":       "",
+			"lib/expect.toit":            "",
+			"lib/README.md":              "",
+			"project/" + DefaultSpecName: "name: app\n",
+			"project/src/main.toit":      "import new_lib.foo\nimport expect\nimport core\nimport net\n",
+		})
+		ui := testUI{}
+		m := ProjectPkgManager{
+			Manager: &Manager{ui: &ui},
+			Paths: &ProjectPaths{
+				ProjectRootPath: projectDir,
+				LockFile:        filepath.Join(projectDir, DefaultLockFileName),
+				SpecFile:        filepath.Join(projectDir, DefaultSpecName),
+			},
+		}
+		check, err := m.CheckImports(libDir)
+		require.NoError(t, err)
+		assert.Empty(t, check.Unused)
+		assert.Equal(t, []ToitImport{
+			{Path: "net", File: "src/main.toit", Line: 4},
+		}, check.Missing)
+
+		_, err = m.CheckImports(filepath.Join(dir, "missing"))
+		assert.Error(t, err)
+	})
+
+	t.Run("Fix", func(t *testing.T) {
+		dir := t.TempDir()
+		projectDir := filepath.Join(dir, "project")
+		writeLintFiles(t, dir, map[string]string{
+			"project/" + DefaultSpecName: `# The dependencies of the app.
+name: app
+dependencies:
+  used:
+    path: ../used
+  unused:
+    path: ../unused
+`,
+			"project/src/main.toit":     "import used\n",
+			"used/" + DefaultSpecName:   "name: used\n",
+			"unused/" + DefaultSpecName: "name: unused\n",
+		})
+		ui := testUI{}
+		m := ProjectPkgManager{
+			Manager: &Manager{
+				registries: makeRegistries(),
+				cache:      NewCache("", &ui),
+				ui:         &ui,
+			},
+			Paths: &ProjectPaths{
+				ProjectRootPath: projectDir,
+				LockFile:        filepath.Join(projectDir, DefaultLockFileName),
+				SpecFile:        filepath.Join(projectDir, DefaultSpecName),
+			},
+		}
+		check, err := m.CheckImports("")
+		require.NoError(t, err)
+		require.Equal(t, []string{"unused"}, check.Unused)
+		require.NoError(t, m.RemoveDeps(context.Background(), check.Unused))
+
+		spec, err := ReadSpec(m.Paths.SpecFile, &ui)
+		require.NoError(t, err)
+		assert.Contains(t, spec.Deps, "used")
+		assert.NotContains(t, spec.Deps, "unused")
+		lf, err := ReadLockFile(m.Paths.LockFile)
+		require.NoError(t, err)
+		assert.Len(t, lf.Prefixes, 1)
+		assert.Contains(t, lf.Prefixes, "used")
+		content, err := os.ReadFile(m.Paths.SpecFile)
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(string(content), "# The dependencies of the app.\n"))
+
+		check, err = m.CheckImports("")
+		require.NoError(t, err)
+		assert.Empty(t, check.Unused)
+		assert.Empty(t, check.Missing)
+	})
+
+	t.Run("Workspace Member", func(t *testing.T) {
+		dir := t.TempDir()
+		rootSpec := `name: root
+workspace:
+  members:
+    - app
+`
+		writeLintFiles(t, dir, map[string]string{
+			DefaultSpecName: rootSpec,
+			"app/" + DefaultSpecName: `name: app
+dependencies:
+  used:
+    path: ../used
+  unused:
+    path: ../unused
+`,
+			"app/src/main.toit":         "import used\n",
+			"used/" + DefaultSpecName:   "name: used\n",
+			"unused/" + DefaultSpecName: "name: unused\n",
+		})
+		paths, err := NewProjectPaths(filepath.Join(dir, "app"), "", "")
+		require.NoError(t, err)
+		require.NotEmpty(t, paths.WorkspaceMemberPath)
+		ui := testUI{}
+		m := ProjectPkgManager{
+			Manager: &Manager{
+				registries: makeRegistries(),
+				cache:      NewCache("", &ui),
+				ui:         &ui,
+			},
+			Paths: paths,
+		}
+		check, err := m.CheckImports("")
+		require.NoError(t, err)
+		require.Equal(t, []string{"unused"}, check.Unused)
+		assert.Empty(t, check.Missing)
+		require.NoError(t, m.RemoveDeps(context.Background(), check.Unused))
+
+		// The dependency is removed from the member, not from the root.
+		member, err := ReadSpec(filepath.Join(dir, "app", DefaultSpecName), &ui)
+		require.NoError(t, err)
+		assert.Contains(t, member.Deps, "used")
+		assert.NotContains(t, member.Deps, "unused")
+		content, err := os.ReadFile(filepath.Join(dir, DefaultSpecName))
+		require.NoError(t, err)
+		assert.Equal(t, rootSpec, string(content))
+		lf, err := ReadLockFile(paths.LockFile)
+		require.NoError(t, err)
+		assert.Equal(t, filepath.Join(dir, DefaultLockFileName), paths.LockFile)
+		for _, pkg := range lf.Packages {
+			assert.NotEqual(t, "../unused", string(pkg.Path))
+		}
+	})
+}
@@ -15,7 +15,16 @@
 
 package tpkg
 
-import "strings"
+import (
+	"embed"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
 
 var (
 	// 2021-07-08:
@@ -483,150 +492,369 @@ var (
 		"BSD-2-Clause-Views",
 		"LGPL-2.1",
 	}
+)
 
-	knownLicenses = map[string]string{
-		"MIT": `MIT License
-
-Copyright (c) <year> <copyright holders>
-
-Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"), to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
-
-The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
-
-THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.`,
-
-		"Apache-2.0": `Apache License
-		Version 2.0, January 2004
-		http://www.apache.org/licenses/
-
-		TERMS AND CONDITIONS FOR USE, REPRODUCTION, AND DISTRIBUTION
-
-		1. Definitions.
-
-		"License" shall mean the terms and conditions for use, reproduction, and distribution as defined by Sections 1 through 9 of this document.
-
-		"Licensor" shall mean the copyright owner or entity authorized by the copyright owner that is granting the License.
-
-		"Legal Entity" shall mean the union of the acting entity and all other entities that control, are controlled by, or are under common control with that entity. For the purposes of this definition, "control" means (i) the power, direct or indirect, to cause the direction or management of such entity, whether by contract or otherwise, or (ii) ownership of fifty percent (50%) or more of the outstanding shares, or (iii) beneficial ownership of such entity.
-
-		"You" (or "Your") shall mean an individual or Legal Entity exercising permissions granted by this License.
-
-		"Source" form shall mean the preferred form for making modifications, including but not limited to software source code, documentation source, and configuration files.
-
-		"Object" form shall mean any form resulting from mechanical transformation or translation of a Source form, including but not limited to compiled object code, generated documentation, and conversions to other media types.
-
-		"Work" shall mean the work of authorship, whether in Source or Object form, made available under the License, as indicated by a copyright notice that is included in or attached to the work (an example is provided in the Appendix below).
-
-		"Derivative Works" shall mean any work, whether in Source or Object form, that is based on (or derived from) the Work and for which the editorial revisions, annotations, elaborations, or other modifications represent, as a whole, an original work of authorship. For the purposes of this License, Derivative Works shall not include works that remain separable from, or merely link (or bind by name) to the interfaces of, the Work and Derivative Works thereof.
-
-		"Contribution" shall mean any work of authorship, including the original version of the Work and any modifications or additions to that Work or Derivative Works thereof, that is intentionally submitted to Licensor for inclusion in the Work by the copyright owner or by an individual or Legal Entity authorized to submit on behalf of the copyright owner. For the purposes of this definition, "submitted" means any form of electronic, verbal, or written communication sent to the Licensor or its representatives, including but not limited to communication on electronic mailing lists, source code control systems, and issue tracking systems that are managed by, or on behalf of, the Licensor for the purpose of discussing and improving the Work, but excluding communication that is conspicuously marked or otherwise designated in writing by the copyright owner as "Not a Contribution."
-
-		"Contributor" shall mean Licensor and any individual or Legal Entity on behalf of whom a Contribution has been received by Licensor and subsequently incorporated within the Work.
-
-		2. Grant of Copyright License. Subject to the terms and conditions of this License, each Contributor hereby grants to You a perpetual, worldwide, non-exclusive, no-charge, royalty-free, irrevocable copyright license to reproduce, prepare Derivative Works of, publicly display, publicly perform, sublicense, and distribute the Work and such Derivative Works in Source or Object form.
-
-		3. Grant of Patent License. Subject to the terms and conditions of this License, each Contributor hereby grants to You a perpetual, worldwide, non-exclusive, no-charge, royalty-free, irrevocable (except as stated in this section) patent license to make, have made, use, offer to sell, sell, import, and otherwise transfer the Work, where such license applies only to those patent claims licensable by such Contributor that are necessarily infringed by their Contribution(s) alone or by combination of their Contribution(s) with the Work to which such Contribution(s) was submitted. If You institute patent litigation against any entity (including a cross-claim or counterclaim in a lawsuit) alleging that the Work or a Contribution incorporated within the Work constitutes direct or contributory patent infringement, then any patent licenses granted to You under this License for that Work shall terminate as of the date such litigation is filed.
-
-		4. Redistribution. You may reproduce and distribute copies of the Work or Derivative Works thereof in any medium, with or without modifications, and in Source or Object form, provided that You meet the following conditions:
-
-				 (a) You must give any other recipients of the Work or Derivative Works a copy of this License; and
-
-				 (b) You must cause any modified files to carry prominent notices stating that You changed the files; and
-
-				 (c) You must retain, in the Source form of any Derivative Works that You distribute, all copyright, patent, trademark, and attribution notices from the Source form of the Work, excluding those notices that do not pertain to any part of the Derivative Works; and
-
-				 (d) If the Work includes a "NOTICE" text file as part of its distribution, then any Derivative Works that You distribute must include a readable copy of the attribution notices contained within such NOTICE file, excluding those notices that do not pertain to any part of the Derivative Works, in at least one of the following places: within a NOTICE text file distributed as part of the Derivative Works; within the Source form or documentation, if provided along with the Derivative Works; or, within a display generated by the Derivative Works, if and wherever such third-party notices normally appear. The contents of the NOTICE file are for informational purposes only and do not modify the License. You may add Your own attribution notices within Derivative Works that You distribute, alongside or as an addendum to the NOTICE text from the Work, provided that such additional attribution notices cannot be construed as modifying the License.
-
-				 You may add Your own copyright statement to Your modifications and may provide additional or different license terms and conditions for use, reproduction, or distribution of Your modifications, or for any such Derivative Works as a whole, provided Your use, reproduction, and distribution of the Work otherwise complies with the conditions stated in this License.
-
-		5. Submission of Contributions. Unless You explicitly state otherwise, any Contribution intentionally submitted for inclusion in the Work by You to the Licensor shall be under the terms and conditions of this License, without any additional terms or conditions. Notwithstanding the above, nothing herein shall supersede or modify the terms of any separate license agreement you may have executed with Licensor regarding such Contributions.
-
-		6. Trademarks. This License does not grant permission to use the trade names, trademarks, service marks, or product names of the Licensor, except as required for reasonable and customary use in describing the origin of the Work and reproducing the content of the NOTICE file.
-
-		7. Disclaimer of Warranty. Unless required by applicable law or agreed to in writing, Licensor provides the Work (and each Contributor provides its Contributions) on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied, including, without limitation, any warranties or conditions of TITLE, NON-INFRINGEMENT, MERCHANTABILITY, or FITNESS FOR A PARTICULAR PURPOSE. You are solely responsible for determining the appropriateness of using or redistributing the Work and assume any risks associated with Your exercise of permissions under this License.
-
-		8. Limitation of Liability. In no event and under no legal theory, whether in tort (including negligence), contract, or otherwise, unless required by applicable law (such as deliberate and grossly negligent acts) or agreed to in writing, shall any Contributor be liable to You for damages, including any direct, indirect, special, incidental, or consequential damages of any character arising as a result of this License or out of the use or inability to use the Work (including but not limited to damages for loss of goodwill, work stoppage, computer failure or malfunction, or any and all other commercial damages or losses), even if such Contributor has been advised of the possibility of such damages.
-
-		9. Accepting Warranty or Additional Liability. While redistributing the Work or Derivative Works thereof, You may choose to offer, and charge a fee for, acceptance of support, warranty, indemnity, or other liability obligations and/or rights consistent with this License. However, in accepting such obligations, You may act only on Your own behalf and on Your sole responsibility, not on behalf of any other Contributor, and only if You agree to indemnify, defend, and hold each Contributor harmless for any liability incurred by, or claims asserted against, such Contributor by reason of your accepting any such warranty or additional liability.
-
-		END OF TERMS AND CONDITIONS
-
-		APPENDIX: How to apply the Apache License to your work.
+// The texts of the licenses that can be detected from license files.
+// Each file is named after the SPDX license ID of its license. The texts of
+// the GNU licenses don't tell the '-only' and '-or-later' variants apart, so
+// their files use the base ID, like 'GPL-3.0'.
+//
+//go:embed licenses/*.txt
+var licenseTexts embed.FS
+
+// minLicenseConfidence is the minimal similarity a license file must have
+// with a known license text to be detected as that license.
+const minLicenseConfidence = 0.85
+
+// LicenseMatch is the license detected in a license file.
+type LicenseMatch struct {
+	// The SPDX license expression of the known licenses found in the file.
+	// Usually a single license ID. Several licenses in one file are combined
+	// with 'AND', or with 'OR' if the file offers them as alternatives.
+	License string
+	// The similarity of the file with the found license texts, between 0
+	// and 1.
+	Confidence float64
+	// The name of the license file.
+	File string
+}
 
-		To apply the Apache License to your work, attach the following boilerplate notice, with the fields enclosed by brackets "[]" replaced with your own identifying information. (Don't include the brackets!)  The text should be enclosed in the appropriate comment syntax for the file format. We also recommend that a file or class name and description of purpose be included on the same "printed page" as the copyright notice for easier identification within third-party archives.
+// IsDetected returns whether the match is close enough to be used as the
+// license of the file.
+func (lm LicenseMatch) IsDetected() bool {
+	return lm.License != "" && lm.Confidence >= minLicenseConfidence
+}
 
-		Copyright [yyyy] [name of copyright owner]
+// licenseTokens contains the word bigrams of a license text.
+type licenseTokens struct {
+	bigrams map[string]int
+	count   int
+}
 
-		Licensed under the Apache License, Version 2.0 (the "License");
-		you may not use this file except in compliance with the License.
-		You may obtain a copy of the License at
+type knownLicense struct {
+	id     string
+	tokens licenseTokens
+}
 
-		http://www.apache.org/licenses/LICENSE-2.0
+// licenseSegment is a range of words of a license file that matches a known
+// license.
+type licenseSegment struct {
+	license    *knownLicense
+	start      int
+	end        int
+	confidence float64
+}
 
-		Unless required by applicable law or agreed to in writing, software
-		distributed under the License is distributed on an "AS IS" BASIS,
-		WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
-		See the License for the specific language governing permissions and
-		limitations under the License.`,
+var (
+	knownLicensesOnce sync.Once
+	knownLicenses     []knownLicense
+)
 
-		"BSD-2-Clause": `Copyright (c) <year> <owner> All rights reserved.
+func loadKnownLicenses() []knownLicense {
+	knownLicensesOnce.Do(func() {
+		entries, err := licenseTexts.ReadDir("licenses")
+		if err != nil {
+			panic(err)
+		}
+		for _, entry := range entries {
+			content, err := licenseTexts.ReadFile(path.Join("licenses", entry.Name()))
+			if err != nil {
+				panic(err)
+			}
+			knownLicenses = append(knownLicenses, knownLicense{
+				id:     strings.TrimSuffix(entry.Name(), ".txt"),
+				tokens: tokenizeLicense(string(content)),
+			})
+		}
+	})
+	return knownLicenses
+}
 
-		Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+// knownLicenseText returns the bundled text of the license with the given ID.
+func knownLicenseText(id string) (string, error) {
+	content, err := licenseTexts.ReadFile(path.Join("licenses", id+".txt"))
+	return string(content), err
+}
 
-		1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+// licenseWords splits the license text into lower-case words.
+// Copyright lines differ for every package and are ignored. So is
+// punctuation and the layout of the text.
+func licenseWords(text string) []string {
+	words := []string{}
+	for _, line := range strings.Split(strings.ToLower(text), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "copyright") || strings.HasPrefix(line, "(c)") || strings.HasPrefix(line, "all rights reserved") {
+			continue
+		}
+		words = append(words, strings.FieldsFunc(line, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})...)
+	}
+	return words
+}
 
-		2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+// tokenizeLicense counts the bigrams of consecutive words of the license
+// text. See licenseWords.
+func tokenizeLicense(text string) licenseTokens {
+	words := licenseWords(text)
+	result := licenseTokens{bigrams: map[string]int{}}
+	for i := 1; i < len(words); i++ {
+		result.add(words[i-1] + " " + words[i])
+	}
+	return result
+}
 
-		THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.`,
+func (t *licenseTokens) add(bigram string) {
+	t.bigrams[bigram]++
+	t.count++
+}
 
-		"BSD-3-Clause": `Copyright (c) <year> <owner>. All rights reserved.
+// similarity returns the Sørensen–Dice coefficient of the bigrams of the two
+// texts.
+func (t licenseTokens) similarity(other licenseTokens) float64 {
+	if t.count == 0 || other.count == 0 {
+		return 0
+	}
+	common := 0
+	for bigram, count := range t.bigrams {
+		otherCount := other.bigrams[bigram]
+		if otherCount < count {
+			count = otherCount
+		}
+		common += count
+	}
+	return 2 * float64(common) / float64(t.count+other.count)
+}
 
-		Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+// findLicenseSegment slides a window of the size of the known license over
+// the words of a license file, and returns the window that is most similar
+// to the license.
+// Windows that overlap the covered words by more than a tenth of their size
+// are skipped.
+func findLicenseSegment(words []string, covered []bool, known *knownLicense) licenseSegment {
+	size := known.tokens.count + 1
+	if size > len(words) {
+		size = len(words)
+	}
+	result := licenseSegment{}
+	if size < 2 {
+		return result
+	}
+	coveredBefore := make([]int, len(words)+1)
+	for i, isCovered := range covered {
+		coveredBefore[i+1] = coveredBefore[i]
+		if isCovered {
+			coveredBefore[i+1]++
+		}
+	}
+	bigram := func(i int) string {
+		return words[i] + " " + words[i+1]
+	}
+	// The bigrams of the window, and how many of them are shared with the
+	// known license.
+	window := map[string]int{}
+	common := 0
+	add := func(b string) {
+		if window[b] < known.tokens.bigrams[b] {
+			common++
+		}
+		window[b]++
+	}
+	remove := func(b string) {
+		if window[b] <= known.tokens.bigrams[b] {
+			common--
+		}
+		window[b]--
+	}
+	for i := 0; i < size-1; i++ {
+		add(bigram(i))
+	}
+	for start := 0; ; start++ {
+		end := start + size
+		if coveredBefore[end]-coveredBefore[start] <= size/10 {
+			confidence := 2 * float64(common) / float64(size-1+known.tokens.count)
+			if confidence > result.confidence {
+				result = licenseSegment{
+					license:    known,
+					start:      start,
+					end:        end,
+					confidence: confidence,
+				}
+			}
+		}
+		if end >= len(words) {
+			break
+		}
+		remove(bigram(start))
+		add(bigram(end - 1))
+	}
+	return result
+}
 
-		1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+// isDualLicenseText returns whether the given words (the text around the
+// license texts of a file) explicitly offer the licenses as alternatives, like
+// "Dual licensed under ..." or "Licensed under either of ... at your option".
+// Other uses of "either" or "option", like in the notice of the GPL ("either
+// version 3 of the License, or (at your option) any later version"), don't
+// make the licenses alternatives.
+func isDualLicenseText(words []string) bool {
+	text := " " + strings.Join(words, " ") + " "
+	if strings.Contains(text, " dual licensed ") {
+		return true
+	}
+	return strings.Contains(text, " licensed under either ") && strings.Contains(text, " at your option ")
+}
 
-		2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+// detectLicense returns the known licenses that are found in the given
+// content.
+// The content is split into segments that each match a known license, so
+// that files with several license texts, or with appended third-party
+// notices, are detected.
+// If no segment matches, returns the known license that is closest to the
+// whole content.
+// The match might not be close enough to be used. See LicenseMatch.IsDetected.
+func detectLicense(content []byte) LicenseMatch {
+	words := licenseWords(string(content))
+	tokens := tokenizeLicense(string(content))
+	known := loadKnownLicenses()
+
+	covered := make([]bool, len(words))
+	segments := []licenseSegment{}
+	for {
+		best := licenseSegment{}
+		for i := range known {
+			segment := findLicenseSegment(words, covered, &known[i])
+			if segment.confidence > best.confidence {
+				best = segment
+			}
+		}
+		if best.confidence < minLicenseConfidence {
+			break
+		}
+		for i := best.start; i < best.end; i++ {
+			covered[i] = true
+		}
+		segments = append(segments, best)
+	}
 
-		3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+	if len(segments) == 0 {
+		result := LicenseMatch{}
+		for _, known := range known {
+			confidence := tokens.similarity(known.tokens)
+			if confidence > result.Confidence {
+				result = LicenseMatch{
+					License:    known.id,
+					Confidence: confidence,
+				}
+			}
+		}
+		return result
+	}
 
-		THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.`,
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i].start < segments[j].start
+	})
+	ids := []string{}
+	seen := map[string]bool{}
+	// The bigrams of all found license texts, to compute how much of the file
+	// they explain.
+	combined := licenseTokens{bigrams: map[string]int{}}
+	for _, segment := range segments {
+		for bigram, count := range segment.license.tokens.bigrams {
+			combined.bigrams[bigram] += count
+		}
+		combined.count += segment.license.tokens.count
+		if !seen[segment.license.id] {
+			seen[segment.license.id] = true
+			ids = append(ids, segment.license.id)
+		}
 	}
-)
+	operator := LicenseAnd
+	uncovered := []string{}
+	for i, word := range words {
+		if !covered[i] {
+			uncovered = append(uncovered, word)
+		}
+	}
+	if len(ids) > 1 && isDualLicenseText(uncovered) {
+		operator = LicenseOr
+	}
+	return LicenseMatch{
+		License:    strings.Join(ids, " "+operator+" "),
+		Confidence: tokens.similarity(combined),
+	}
+}
 
-func validateLicenseID(id string) bool {
-	for _, validID := range licenseIDs {
-		if id == validID {
+// isLicenseFileName returns whether the given file name is the name of a
+// license file, like 'LICENSE', 'LICENSE.md', 'LICENSE-MIT' or 'COPYING'.
+func isLicenseFileName(name string) bool {
+	upper := strings.ToUpper(name)
+	for _, base := range []string{"LICENSE", "LICENCE", "COPYING"} {
+		if upper == base {
+			return true
+		}
+		if strings.HasPrefix(upper, base) && strings.ContainsRune(".-_", rune(upper[len(base)])) {
 			return true
 		}
 	}
 	return false
 }
 
-func canonicalizeLicense(str string) string {
-	lines := strings.Split(str, "\n")
-	cleanedLines := []string{}
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if strings.HasPrefix(line, "Copyright") {
+// detectLicenseFiles detects the licenses of all license files in the given
+// directory.
+// Returns one match per license file, sorted by file name. Returns an empty
+// list if the directory doesn't exist.
+func detectLicenseFiles(dir string) ([]LicenseMatch, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	result := []LicenseMatch{}
+	for _, entry := range entries {
+		if entry.IsDir() || !isLicenseFileName(entry.Name()) {
 			continue
 		}
-		line = strings.ReplaceAll(line, " ", "")
-		cleanedLines = append(cleanedLines, line)
+		content, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		match := detectLicense(content)
+		match.File = entry.Name()
+		result = append(result, match)
 	}
-	return strings.Join(cleanedLines, "")
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].File < result[j].File
+	})
+	return result, nil
 }
 
-func guessLicense(content []byte) string {
-	str := string(content)
-	canonicalized := canonicalizeLicense(str)
-	for id, licenseText := range knownLicenses {
-		canonicalizedKnown := canonicalizeLicense(licenseText)
-		if strings.HasPrefix(canonicalized, canonicalizedKnown) {
-			return id
+// combineLicenseMatches returns the license expression of the given license
+// files.
+// Different licenses are combined with 'AND', as all of them might apply.
+// Returns "" if there are no files, or if the license of one of them wasn't
+// detected.
+func combineLicenseMatches(matches []LicenseMatch) string {
+	licenses := []string{}
+	seen := map[string]bool{}
+	for _, match := range matches {
+		if !match.IsDetected() {
+			return ""
 		}
-		if strings.HasSuffix(canonicalized, canonicalizedKnown) {
-			return id
+		for _, license := range strings.Split(match.License, " "+LicenseAnd+" ") {
+			if strings.Contains(license, " "+LicenseOr+" ") {
+				license = "(" + license + ")"
+			}
+			if !seen[license] {
+				seen[license] = true
+				licenses = append(licenses, license)
+			}
 		}
 	}
-	return ""
+	if len(licenses) == 1 {
+		return strings.TrimSuffix(strings.TrimPrefix(licenses[0], "("), ")")
+	}
+	return strings.Join(licenses, " "+LicenseAnd+" ")
 }
@@ -0,0 +1,390 @@
+// Copyright (C) 2021 Toitware ApS.
+//
+// This library is free software; you can redistribute it and/or
+// modify it under the terms of the GNU Lesser General Public
+// License as published by the Free Software Foundation; version
+// 2.1 only.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Lesser General Public License for more details.
+//
+// The license can be found in the file `LICENSE` in the top level
+// directory of this repository.
+
+package tpkg
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SPDX license expressions, as described in Annex D of the SPDX
+// specification:
+//
+//	expression := and-expression ("OR" and-expression)*
+//	and-expression := with-expression ("AND" with-expression)*
+//	with-expression := simple ("WITH" exception-id)?
+//	simple := license-id ["+"] | license-ref | "(" expression ")"
+//	license-ref := ["DocumentRef-" idstring ":"] "LicenseRef-" idstring
+//
+// "AND" binds tighter than "OR". Operators may be written in upper or lower
+// case. License and exception IDs are matched case-insensitively, and are
+// normalized to their canonical spelling.
+
+const (
+	LicenseAnd = "AND"
+	LicenseOr  = "OR"
+)
+
+var (
+	// 2021-07-08:
+	// Extracted from: https://raw.githubusercontent.com/spdx/license-list-data/master/json/exceptions.json
+	licenseExceptionIDs = []string{
+		"389-exception",
+		"Autoconf-exception-2.0",
+		"Autoconf-exception-3.0",
+		"Bison-exception-2.2",
+		"Bootloader-exception",
+		"Classpath-exception-2.0",
+		"CLISP-exception-2.0",
+		"DigiRule-FOSS-exception",
+		"eCos-exception-2.0",
+		"Fawkes-Runtime-exception",
+		"FLTK-exception",
+		"Font-exception-2.0",
+		"freertos-exception-2.0",
+		"GCC-exception-2.0",
+		"GCC-exception-3.1",
+		"gnu-javamail-exception",
+		"GPL-3.0-linking-exception",
+		"GPL-3.0-linking-source-exception",
+		"GPL-CC-1.0",
+		"GStreamer-exception-2005",
+		"GStreamer-exception-2008",
+		"i2p-gpl-java-exception",
+		"KiCad-libraries-exception",
+		"LGPL-3.0-linking-exception",
+		"Libtool-exception",
+		"Linux-syscall-note",
+		"LLVM-exception",
+		"LZMA-exception",
+		"mif-exception",
+		"Nokia-Qt-exception-1.1",
+		"OCaml-LGPL-linking-exception",
+		"OCCT-exception-1.0",
+		"OpenJDK-assembly-exception-1.0",
+		"openvpn-openssl-exception",
+		"PS-or-PDF-font-exception-20170817",
+		"Qt-GPL-exception-1.0",
+		"Qt-LGPL-exception-1.1",
+		"Qwt-exception-1.0",
+		"SHL-2.0",
+		"SHL-2.1",
+		"Swift-exception",
+		"u-boot-exception-2.0",
+		"Universal-FOSS-exception-1.0",
+		"WxWindows-exception-3.1",
+	}
+
+	// Maps lower-case IDs to their canonical spelling.
+	canonicalLicenseIDs          = canonicalIDs(licenseIDs)
+	canonicalLicenseExceptionIDs = canonicalIDs(licenseExceptionIDs)
+)
+
+func canonicalIDs(ids []string) map[string]string {
+	result := map[string]string{}
+	for _, id := range ids {
+		result[strings.ToLower(id)] = id
+	}
+	return result
+}
+
+// LicenseExpression is a parsed SPDX license expression.
+// An expression is either a compound expression, combining its operands
+// with an operator, or a single license.
+type LicenseExpression struct {
+	// LicenseAnd or LicenseOr for compound expressions. Empty for a single
+	// license.
+	Operator string
+	// The operands of a compound expression. Operands never have the same
+	// operator as their parent.
+	Operands []*LicenseExpression
+
+	// The license ID or license reference of a single license.
+	License string
+	// Whether the license was followed by '+'.
+	OrLater bool
+	// The exception ID, if the license was used with 'WITH'.
+	Exception string
+}
+
+// ParseLicenseExpression parses the given SPDX license expression.
+func ParseLicenseExpression(str string) (*LicenseExpression, error) {
+	p := licenseParser{tokens: tokenizeLicenseExpression(str)}
+	if len(p.tokens) == 0 {
+		return nil, fmt.Errorf("empty license expression")
+	}
+	result, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if !p.atEnd() {
+		return nil, fmt.Errorf("unexpected '%s'", p.peek())
+	}
+	return result, nil
+}
+
+func tokenizeLicenseExpression(str string) []string {
+	result := []string{}
+	current := strings.Builder{}
+	flush := func() {
+		if current.Len() > 0 {
+			result = append(result, current.String())
+			current.Reset()
+		}
+	}
+	for _, r := range str {
+		switch {
+		case r == '(' || r == ')':
+			flush()
+			result = append(result, string(r))
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			flush()
+		default:
+			current.WriteRune(r)
+		}
+	}
+	flush()
+	return result
+}
+
+type licenseParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *licenseParser) atEnd() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *licenseParser) peek() string {
+	if p.atEnd() {
+		return ""
+	}
+	return p.tokens[p.pos]
+}
+
+// isOperator returns whether the next token is the given operator.
+func (p *licenseParser) isOperator(operator string) bool {
+	token := p.peek()
+	return token == operator || token == strings.ToLower(operator)
+}
+
+func (p *licenseParser) parseOr() (*LicenseExpression, error) {
+	return p.parseCompound(LicenseOr, p.parseAnd)
+}
+
+func (p *licenseParser) parseAnd() (*LicenseExpression, error) {
+	return p.parseCompound(LicenseAnd, p.parseWith)
+}
+
+func (p *licenseParser) parseCompound(operator string, parseOperand func() (*LicenseExpression, error)) (*LicenseExpression, error) {
+	first, err := parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	if !p.isOperator(operator) {
+		return first, nil
+	}
+	result := &LicenseExpression{Operator: operator}
+	add := func(operand *LicenseExpression) {
+		if operand.Operator == operator {
+			// Flatten '(a OR b) OR c'.
+			result.Operands = append(result.Operands, operand.Operands...)
+		} else {
+			result.Operands = append(result.Operands, operand)
+		}
+	}
+	add(first)
+	for p.isOperator(operator) {
+		p.pos++
+		operand, err := parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		add(operand)
+	}
+	return result, nil
+}
+
+func (p *licenseParser) parseWith() (*LicenseExpression, error) {
+	result, err := p.parseSimple()
+	if err != nil {
+		return nil, err
+	}
+	if !p.isOperator("WITH") {
+		return result, nil
+	}
+	p.pos++
+	if result.Operator != "" || result.Exception != "" {
+		return nil, fmt.Errorf("'WITH' must follow a single license")
+	}
+	if p.atEnd() {
+		return nil, fmt.Errorf("missing exception after 'WITH'")
+	}
+	token := p.tokens[p.pos]
+	exception, ok := canonicalLicenseExceptionIDs[strings.ToLower(token)]
+	if !ok {
+		return nil, fmt.Errorf("unknown license exception '%s'", token)
+	}
+	p.pos++
+	result.Exception = exception
+	return result, nil
+}
+
+func (p *licenseParser) parseSimple() (*LicenseExpression, error) {
+	if p.atEnd() {
+		if p.pos == 0 {
+			return nil, fmt.Errorf("empty license expression")
+		}
+		return nil, fmt.Errorf("missing license after '%s'", p.tokens[p.pos-1])
+	}
+	token := p.tokens[p.pos]
+	p.pos++
+	if token == "(" {
+		result, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, fmt.Errorf("missing ')'")
+		}
+		p.pos++
+		return result, nil
+	}
+	if token == ")" || isLicenseOperator(token) {
+		return nil, fmt.Errorf("unexpected '%s'", token)
+	}
+	if isLicenseRef(token) {
+		if !isValidLicenseRef(token) {
+			return nil, fmt.Errorf("invalid license reference '%s'", token)
+		}
+		return &LicenseExpression{License: token}, nil
+	}
+	if id, ok := canonicalLicenseIDs[strings.ToLower(token)]; ok {
+		return &LicenseExpression{License: id}, nil
+	}
+	if strings.HasSuffix(token, "+") {
+		if id, ok := canonicalLicenseIDs[strings.ToLower(strings.TrimSuffix(token, "+"))]; ok {
+			return &LicenseExpression{License: id, OrLater: true}, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown license ID '%s'", token)
+}
+
+func isLicenseOperator(token string) bool {
+	for _, operator := range []string{LicenseAnd, LicenseOr, "WITH"} {
+		if token == operator || token == strings.ToLower(operator) {
+			return true
+		}
+	}
+	return false
+}
+
+func isLicenseRef(token string) bool {
+	return strings.HasPrefix(token, "LicenseRef-") || strings.HasPrefix(token, "DocumentRef-")
+}
+
+func isValidLicenseRef(token string) bool {
+	isIDString := func(str string) bool {
+		if str == "" {
+			return false
+		}
+		for _, r := range str {
+			if !('0' <= r && r <= '9') && !('a' <= r && r <= 'z') && !('A' <= r && r <= 'Z') && r != '.' && r != '-' {
+				return false
+			}
+		}
+		return true
+	}
+	if strings.HasPrefix(token, "DocumentRef-") {
+		colon := strings.Index(token, ":")
+		if colon < 0 || !isIDString(strings.TrimPrefix(token[:colon], "DocumentRef-")) {
+			return false
+		}
+		token = token[colon+1:]
+	}
+	return strings.HasPrefix(token, "LicenseRef-") && isIDString(strings.TrimPrefix(token, "LicenseRef-"))
+}
+
+// IsSingleLicense returns whether the expression is a single license ID
+// without '+' or exception.
+func (e *LicenseExpression) IsSingleLicense() bool {
+	return e.Operator == "" && !e.OrLater && e.Exception == "" && !isLicenseRef(e.License)
+}
+
+// String returns the normalized form of the expression.
+func (e *LicenseExpression) String() string {
+	if e.Operator == "" {
+		result := e.License
+		if e.OrLater {
+			result += "+"
+		}
+		if e.Exception != "" {
+			result += " WITH " + e.Exception
+		}
+		return result
+	}
+	parts := make([]string, len(e.Operands))
+	for i, operand := range e.Operands {
+		parts[i] = operand.String()
+		if operand.Operator == LicenseOr && e.Operator == LicenseAnd {
+			parts[i] = "(" + parts[i] + ")"
+		}
+	}
+	return strings.Join(parts, " "+e.Operator+" ")
+}
+
+// Choices returns the alternative sets of licenses of the expression.
+// Using the licensed package requires accepting all licenses of one of the
+// choices. For example, 'MIT AND (Apache-2.0 OR BSD-3-Clause)' has the choices
+// [MIT, Apache-2.0] and [MIT, BSD-3-Clause].
+func (e *LicenseExpression) Choices() [][]*LicenseExpression {
+	switch e.Operator {
+	case LicenseOr:
+		result := [][]*LicenseExpression{}
+		for _, operand := range e.Operands {
+			result = append(result, operand.Choices()...)
+		}
+		return result
+	case LicenseAnd:
+		result := [][]*LicenseExpression{{}}
+		for _, operand := range e.Operands {
+			combined := [][]*LicenseExpression{}
+			for _, choice := range result {
+				for _, operandChoice := range operand.Choices() {
+					merged := append(append([]*LicenseExpression{}, choice...), operandChoice...)
+					combined = append(combined, merged)
+				}
+			}
+			result = combined
+		}
+		return result
+	default:
+		return [][]*LicenseExpression{{e}}
+	}
+}
+
+// Licenses returns all single licenses of the expression, in order.
+func (e *LicenseExpression) Licenses() []*LicenseExpression {
+	if e.Operator == "" {
+		return []*LicenseExpression{e}
+	}
+	result := []*LicenseExpression{}
+	for _, operand := range e.Operands {
+		result = append(result, operand.Licenses()...)
+	}
+	return result
+}
@@ -0,0 +1,120 @@
+// Copyright (C) 2021 Toitware ApS.
+//
+// This library is free software; you can redistribute it and/or
+// modify it under the terms of the GNU Lesser General Public
+// License as published by the Free Software Foundation; version
+// 2.1 only.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Lesser General Public License for more details.
+//
+// The license can be found in the file `LICENSE` in the top level
+// directory of this repository.
+
+package tpkg
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_LicenseExpression(t *testing.T) {
+	t.Run("Normalize", func(t *testing.T) {
+		tests := []struct {
+			expression string
+			expected   string
+		}{
+			{"MIT", "MIT"},
+			{"mit", "MIT"},
+			{"apache-2.0 or mit", "Apache-2.0 OR MIT"},
+			{"GPL-2.0-only WITH Classpath-exception-2.0", "GPL-2.0-only WITH Classpath-exception-2.0"},
+			{"gpl-2.0-only with classpath-exception-2.0", "GPL-2.0-only WITH Classpath-exception-2.0"},
+			{"LGPL-2.1+", "LGPL-2.1+"},
+			{"LicenseRef-Toitware-1.0", "LicenseRef-Toitware-1.0"},
+			{"DocumentRef-spdx-tool-1.2:LicenseRef-MIT-Style-2", "DocumentRef-spdx-tool-1.2:LicenseRef-MIT-Style-2"},
+			{"MIT AND (Apache-2.0 OR BSD-3-Clause)", "MIT AND (Apache-2.0 OR BSD-3-Clause)"},
+			{"(MIT AND Apache-2.0) OR BSD-3-Clause", "MIT AND Apache-2.0 OR BSD-3-Clause"},
+			{"((MIT OR ISC)) OR (Zlib OR BSD-2-Clause)", "MIT OR ISC OR Zlib OR BSD-2-Clause"},
+			{"  MIT\tAND  (ISC)  ", "MIT AND ISC"},
+		}
+		for _, test := range tests {
+			expression, err := ParseLicenseExpression(test.expression)
+			require.NoError(t, err, test.expression)
+			assert.Equal(t, test.expected, expression.String(), test.expression)
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		tests := []struct {
+			expression string
+			expected   string
+		}{
+			{"", "empty license expression"},
+			{"  ", "empty license expression"},
+			{"Foo", "unknown license ID 'Foo'"},
+			{"MIT OR", "missing license after 'OR'"},
+			{"OR MIT", "unexpected 'OR'"},
+			{"MIT Apache-2.0", "unexpected 'Apache-2.0'"},
+			{"(MIT OR ISC", "missing ')'"},
+			{"MIT)", "unexpected ')'"},
+			{"GPL-2.0-only WITH", "missing exception after 'WITH'"},
+			{"GPL-2.0-only WITH MIT", "unknown license exception 'MIT'"},
+			{"(MIT OR ISC) WITH LLVM-exception", "'WITH' must follow a single license"},
+			{"LicenseRef-", "invalid license reference 'LicenseRef-'"},
+			{"LicenseRef-a_b", "invalid license reference 'LicenseRef-a_b'"},
+			{"DocumentRef-x", "invalid license reference 'DocumentRef-x'"},
+			{"MIT Or ISC", "unexpected 'Or'"},
+		}
+		for _, test := range tests {
+			_, err := ParseLicenseExpression(test.expression)
+			require.Error(t, err, test.expression)
+			assert.Equal(t, test.expected, err.Error(), test.expression)
+		}
+	})
+
+	t.Run("Choices", func(t *testing.T) {
+		choiceStrings := func(expression string) [][]string {
+			parsed, err := ParseLicenseExpression(expression)
+			require.NoError(t, err)
+			result := [][]string{}
+			for _, choice := range parsed.Choices() {
+				licenses := []string{}
+				for _, single := range choice {
+					licenses = append(licenses, single.String())
+				}
+				result = append(result, licenses)
+			}
+			return result
+		}
+		assert.Equal(t, [][]string{{"MIT"}}, choiceStrings("MIT"))
+		assert.Equal(t, [][]string{{"MIT"}, {"Apache-2.0"}}, choiceStrings("MIT OR Apache-2.0"))
+		assert.Equal(t, [][]string{
+			{"MIT", "Apache-2.0"},
+			{"MIT", "BSD-3-Clause WITH LLVM-exception"},
+		}, choiceStrings("MIT AND (Apache-2.0 OR BSD-3-Clause WITH LLVM-exception)"))
+		assert.Equal(t, [][]string{
+			{"MIT", "ISC"},
+			{"MIT", "Zlib"},
+			{"Apache-2.0", "ISC"},
+			{"Apache-2.0", "Zlib"},
+		}, choiceStrings("(MIT OR Apache-2.0) AND (ISC OR Zlib)"))
+	})
+
+	t.Run("Single", func(t *testing.T) {
+		for expression, expected := range map[string]bool{
+			"MIT":                                 true,
+			"MIT OR ISC":                          false,
+			"Apache-2.0+":                         false,
+			"GPL-2.0-only WITH GCC-exception-2.0": false,
+			"LicenseRef-Toitware":                 false,
+		} {
+			parsed, err := ParseLicenseExpression(expression)
+			require.NoError(t, err)
+			assert.Equal(t, expected, parsed.IsSingleLicense(), expression)
+		}
+	})
+}
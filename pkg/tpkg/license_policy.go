@@ -0,0 +1,281 @@
+// Copyright (C) 2021 Toitware ApS.
+//
+// This library is free software; you can redistribute it and/or
+// modify it under the terms of the GNU Lesser General Public
+// License as published by the Free Software Foundation; version
+// 2.1 only.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Lesser General Public License for more details.
+//
+// The license can be found in the file `LICENSE` in the top level
+// directory of this repository.
+
+package tpkg
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// DefaultLicensePolicyName is the name of the license policy file of a
+// project. If the file exists next to the package file, installing
+// packages enforces it.
+const DefaultLicensePolicyName = "license-policy.yaml"
+
+// LicensePolicy restricts the licenses of the packages a project may depend
+// on.
+//
+// A license policy file looks as follows:
+//
+//	# Only these licenses are allowed. If empty, all licenses that aren't
+//	# denied are allowed.
+//	allow:
+//	  - MIT
+//	  - Apache-2.0
+//	# These licenses are never allowed.
+//	deny:
+//	  - GPL-3.0
+//	# Whether packages with unknown licenses are allowed.
+//	allow-unknown: false
+//
+// Entries are SPDX license IDs or license references, optionally with an
+// exception ('GPL-2.0-only WITH Classpath-exception-2.0'). An entry without
+// exception matches the license with any exception. An entry without
+// '-only' or '-or-later' suffix also matches the suffixed variants. For
+// example, 'GPL-3.0' matches 'GPL-3.0-only', 'GPL-3.0-or-later' and 'GPL-3.0+'.
+//
+// Licenses of packages may be SPDX expressions. A license is allowed if
+// one of its choices is allowed. For example, 'GPL-3.0-only OR MIT' is allowed
+// if 'MIT' is.
+type LicensePolicy struct {
+	path string
+
+	Allow        []string `yaml:"allow,omitempty"`
+	Deny         []string `yaml:"deny,omitempty"`
+	AllowUnknown bool     `yaml:"allow-unknown,omitempty"`
+}
+
+// ReadLicensePolicy reads the license policy at the given path.
+func ReadLicensePolicy(path string, ui UI) (*LicensePolicy, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	policy := LicensePolicy{}
+	if err := yaml.UnmarshalStrict(b, &policy); err != nil {
+		return nil, ui.ReportError("Invalid license policy '%s': %v", path, err)
+	}
+	policy.path = path
+	if err := policy.validate(ui); err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+func (p *LicensePolicy) validate(ui UI) error {
+	for _, entry := range append(append([]string{}, p.Allow...), p.Deny...) {
+		expression, err := ParseLicenseExpression(entry)
+		if err != nil {
+			return ui.ReportError("Invalid license policy '%s': %v", p.path, err)
+		}
+		if expression.Operator != "" {
+			return ui.ReportError("Invalid license policy '%s': '%s' is not a single license", p.path, entry)
+		}
+	}
+	for _, allowed := range p.Allow {
+		for _, denied := range p.Deny {
+			if strings.EqualFold(allowed, denied) {
+				return ui.ReportError("Invalid license policy '%s': license '%s' is both allowed and denied", p.path, allowed)
+			}
+		}
+	}
+	return nil
+}
+
+// licenseMatches returns whether the single license matches the policy entry.
+func licenseMatches(entry string, license *LicenseExpression) bool {
+	parsed, err := ParseLicenseExpression(entry)
+	if err != nil || parsed.Operator != "" {
+		return false
+	}
+	if parsed.Exception != "" && !strings.EqualFold(parsed.Exception, license.Exception) {
+		return false
+	}
+	id := license.License
+	if license.OrLater {
+		id += "+"
+	}
+	entryID := parsed.License
+	if parsed.OrLater {
+		entryID += "+"
+	}
+	if strings.EqualFold(entryID, id) {
+		return true
+	}
+	base := id
+	for _, suffix := range []string{"-only", "-or-later", "+"} {
+		base = strings.TrimSuffix(base, suffix)
+	}
+	return strings.EqualFold(entryID, base)
+}
+
+func licenseMatchesAny(entries []string, license *LicenseExpression) bool {
+	for _, entry := range entries {
+		if licenseMatches(entry, license) {
+			return true
+		}
+	}
+	return false
+}
+
+// Violation returns why the given license isn't allowed by the policy.
+// Returns "" if the license is allowed.
+// The license may be an SPDX expression. Empty and invalid licenses are
+// unknown licenses.
+func (p *LicensePolicy) Violation(license string) string {
+	expression, err := ParseLicenseExpression(license)
+	if err != nil {
+		if p.AllowUnknown {
+			return ""
+		}
+		if license == "" {
+			return "has an unknown license"
+		}
+		return fmt.Sprintf("has an unknown license '%s'", license)
+	}
+	// The license is denied if every choice contains a denied license.
+	isDenied := true
+	for _, choice := range expression.Choices() {
+		isAllowed := true
+		hasDenied := false
+		for _, single := range choice {
+			if licenseMatchesAny(p.Deny, single) {
+				hasDenied = true
+				isAllowed = false
+			} else if len(p.Allow) != 0 && !licenseMatchesAny(p.Allow, single) {
+				isAllowed = false
+			}
+		}
+		if isAllowed {
+			return ""
+		}
+		if !hasDenied {
+			isDenied = false
+		}
+	}
+	if isDenied {
+		return fmt.Sprintf("has license '%s', which is denied by the license policy", expression)
+	}
+	return fmt.Sprintf("has license '%s', which isn't allowed by the license policy", expression)
+}
+
+// PackageLicense is the license of a package of the lock file.
+type PackageLicense struct {
+	// The package ID in the lock file.
+	ID      string
+	Name    string
+	Version string
+	URL     string
+	// The path of a local package, as given in the lock file.
+	LocalPath string
+	// The SPDX license ID. Empty if unknown.
+	License string
+	// Why the license isn't allowed by the license policy. Empty if there is
+	// no policy, or if the license is allowed.
+	Violation string
+}
+
+// String returns a description of the package, suitable for messages.
+func (pl PackageLicense) String() string {
+	if pl.LocalPath != "" {
+		return fmt.Sprintf("'%s'", filepath.ToSlash(pl.LocalPath))
+	}
+	return fmt.Sprintf("'%s' version %s", pl.URL, pl.Version)
+}
+
+// Licenses returns the licenses of all packages in the lock file, sorted by
+// package ID.
+// If a policy is given, sets the violations of the licenses. Local packages
+// are part of the project and are not checked against the policy.
+func (m *ProjectPkgManager) Licenses(policy *LicensePolicy) ([]PackageLicense, error) {
+	_, lf, err := m.readSpecAndLock()
+	if err != nil {
+		return nil, err
+	}
+	if lf == nil {
+		return nil, m.ui.ReportError("Missing lock file '%s'. Run 'toit pkg install' first", m.Paths.LockFile)
+	}
+	return m.lockedLicenses(lf, policy)
+}
+
+func (m *ProjectPkgManager) lockedLicenses(lf *LockFile, policy *LicensePolicy) ([]PackageLicense, error) {
+	ids := make([]string, 0, len(lf.Packages))
+	for id := range lf.Packages {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	result := make([]PackageLicense, 0, len(ids))
+	for _, id := range ids {
+		component, err := m.sbomComponent(id, lf.Packages[id])
+		if err != nil {
+			return nil, err
+		}
+		pl := PackageLicense{
+			ID:        id,
+			Name:      component.Name,
+			Version:   component.Version,
+			URL:       component.URL,
+			LocalPath: component.LocalPath,
+			License:   component.License,
+		}
+		if policy != nil && !component.IsLocal() {
+			pl.Violation = policy.Violation(pl.License)
+		}
+		result = append(result, pl)
+	}
+	return result, nil
+}
+
+// LicensePolicy returns the license policy of the project.
+// Returns nil if the project doesn't have a policy file.
+func (m *ProjectPkgManager) LicensePolicy() (*LicensePolicy, error) {
+	path := filepath.Join(m.Paths.ProjectRootPath, DefaultLicensePolicyName)
+	exists, err := isFile(path)
+	if err != nil || !exists {
+		return nil, err
+	}
+	return ReadLicensePolicy(path, m.ui)
+}
+
+// enforceLicensePolicy reports an error for every package of the lock file
+// whose license isn't allowed by the project's license policy.
+// Does nothing if the project doesn't have a policy.
+func (m *ProjectPkgManager) enforceLicensePolicy(lf *LockFile) error {
+	policy, err := m.LicensePolicy()
+	if err != nil || policy == nil {
+		return err
+	}
+	licenses, err := m.lockedLicenses(lf, policy)
+	if err != nil {
+		return err
+	}
+	encounteredError := false
+	for _, pl := range licenses {
+		if pl.Violation != "" {
+			m.ui.ReportError("Package %s %s", pl, pl.Violation)
+			encounteredError = true
+		}
+	}
+	if encounteredError {
+		return ErrAlreadyReported
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+// Copyright (C) 2021 Toitware ApS.
+//
+// This library is free software; you can redistribute it and/or
+// modify it under the terms of the GNU Lesser General Public
+// License as published by the Free Software Foundation; version
+// 2.1 only.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Lesser General Public License for more details.
+//
+// The license can be found in the file `LICENSE` in the top level
+// directory of this repository.
+
+package tpkg
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_LicensePolicy(t *testing.T) {
+	t.Run("Violation", func(t *testing.T) {
+		policy := LicensePolicy{
+			Allow: []string{"MIT", "Apache-2.0", "LGPL-2.1"},
+			Deny:  []string{"GPL-3.0"},
+		}
+		tests := []struct {
+			license  string
+			expected string
+		}{
+			{"MIT", ""},
+			{"mit", ""},
+			{"LGPL-2.1-only", ""},
+			{"LGPL-2.1-or-later", ""},
+			{"GPL-3.0-only", "has license 'GPL-3.0-only', which is denied by the license policy"},
+			{"GPL-3.0+", "has license 'GPL-3.0+', which is denied by the license policy"},
+			{"BSD-3-Clause", "has license 'BSD-3-Clause', which isn't allowed by the license policy"},
+			{"", "has an unknown license"},
+		}
+		for _, test := range tests {
+			assert.Equal(t, test.expected, policy.Violation(test.license), test.license)
+		}
+
+		expressions := LicensePolicy{
+			Allow: []string{"MIT", "Apache-2.0", "GPL-2.0-only WITH Classpath-exception-2.0", "LicenseRef-Toitware"},
+			Deny:  []string{"GPL-3.0"},
+		}
+		expressionTests := []struct {
+			license  string
+			expected string
+		}{
+			{"MIT OR GPL-3.0-only", ""},
+			{"(gpl-3.0-only or mit) and apache-2.0", ""},
+			{"GPL-2.0-only WITH Classpath-exception-2.0", ""},
+			{"LicenseRef-Toitware AND MIT", ""},
+			{"GPL-2.0-only", "has license 'GPL-2.0-only', which isn't allowed by the license policy"},
+			{"GPL-3.0-only OR GPL-3.0-or-later WITH GCC-exception-3.1", "has license 'GPL-3.0-only OR GPL-3.0-or-later WITH GCC-exception-3.1', which is denied by the license policy"},
+			{"GPL-3.0-only OR BSD-3-Clause", "has license 'GPL-3.0-only OR BSD-3-Clause', which isn't allowed by the license policy"},
+			{"MIT AND GPL-3.0-only", "has license 'MIT AND GPL-3.0-only', which is denied by the license policy"},
+			{"MIT OR", "has an unknown license 'MIT OR'"},
+		}
+		for _, test := range expressionTests {
+			assert.Equal(t, test.expected, expressions.Violation(test.license), test.license)
+		}
+
+		denyOnly := LicensePolicy{Deny: []string{"GPL-3.0-only"}, AllowUnknown: true}
+		assert.Equal(t, "", denyOnly.Violation("BSD-3-Clause"))
+		assert.Equal(t, "", denyOnly.Violation("GPL-3.0-or-later"))
+		assert.Equal(t, "", denyOnly.Violation(""))
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		tests := []struct {
+			content  string
+			expected string
+		}{
+			{"deny: [Foo]\n", "unknown license ID 'Foo'"},
+			{"deny: [MIT OR GPL-3.0-only]\n", "'MIT OR GPL-3.0-only' is not a single license"},
+			{"allow: [MIT]\ndeny: [MIT]\n", "license 'MIT' is both allowed and denied"},
+		}
+		for _, test := range tests {
+			dir := t.TempDir()
+			path := filepath.Join(dir, DefaultLicensePolicyName)
+			writeLintFiles(t, dir, map[string]string{DefaultLicensePolicyName: test.content})
+			ui := testUI{}
+			_, err := ReadLicensePolicy(path, &ui)
+			assert.True(t, IsErrAlreadyReported(err))
+			assert.Equal(t, []string{"Error: Invalid license policy '" + path + "': " + test.expected}, ui.messages)
+		}
+
+		dir := t.TempDir()
+		writeLintFiles(t, dir, map[string]string{DefaultLicensePolicyName: "denied: [MIT]\n"})
+		ui := testUI{}
+		_, err := ReadLicensePolicy(filepath.Join(dir, DefaultLicensePolicyName), &ui)
+		assert.True(t, IsErrAlreadyReported(err))
+		assert.Len(t, ui.messages, 1)
+	})
+
+	t.Run("Enforce", func(t *testing.T) {
+		dir := t.TempDir()
+		projectDir := filepath.Join(dir, "project")
+		writeLintFiles(t, dir, map[string]string{
+			"project/" + DefaultSpecName: "name: app\n",
+			"project/" + DefaultLockFileName: `packages:
+  github.com/foo/bar:
+    url: github.com/foo/bar
+    version: 1.0.0
+  github.com/foo/gpl:
+    url: github.com/foo/gpl
+    version: 2.0.0
+  ..-local:
+    path: ../local
+`,
+		})
+		ui := testUI{}
+		m := ProjectPkgManager{
+			Manager: &Manager{
+				registries: makeRegistries(
+					NewDesc("bar", "", "github.com/foo/bar", "1.0.0", "", "MIT", "", nil),
+					NewDesc("gpl", "", "github.com/foo/gpl", "2.0.0", "", "GPL-3.0-only", "", nil)),
+				cache: NewCache("", &ui),
+				ui:    &ui,
+			},
+			Paths: &ProjectPaths{
+				ProjectRootPath: projectDir,
+				LockFile:        filepath.Join(projectDir, DefaultLockFileName),
+				SpecFile:        filepath.Join(projectDir, DefaultSpecName),
+			},
+		}
+		lf, err := ReadLockFile(m.Paths.LockFile)
+		require.NoError(t, err)
+
+		// Without a policy, nothing is enforced.
+		require.NoError(t, m.enforceLicensePolicy(lf))
+		licenses, err := m.Licenses(nil)
+		require.NoError(t, err)
+		require.Len(t, licenses, 3)
+		assert.Equal(t, PackageLicense{ID: "..-local", Name: "local", LocalPath: "../local"}, licenses[0])
+		assert.Equal(t, "MIT", licenses[1].License)
+		assert.Equal(t, "GPL-3.0-only", licenses[2].License)
+
+		writeLintFiles(t, projectDir, map[string]string{DefaultLicensePolicyName: "deny: [GPL-3.0]\n"})
+		err = m.enforceLicensePolicy(lf)
+		assert.True(t, IsErrAlreadyReported(err))
+		assert.Equal(t, []string{
+			"Error: Package 'github.com/foo/gpl' version 2.0.0 has license 'GPL-3.0-only', which is denied by the license policy",
+		}, ui.messages)
+
+		policy, err := m.LicensePolicy()
+		require.NoError(t, err)
+		licenses, err = m.Licenses(policy)
+		require.NoError(t, err)
+		// Local packages aren't checked.
+		assert.Equal(t, "", licenses[0].Violation)
+		assert.Equal(t, "", licenses[1].Violation)
+		assert.Equal(t, "has license 'GPL-3.0-only', which is denied by the license policy", licenses[2].Violation)
+	})
+}
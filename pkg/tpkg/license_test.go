@@ -0,0 +1,203 @@
+// Copyright (C) 2021 Toitware ApS.
+//
+// This library is free software; you can redistribute it and/or
+// modify it under the terms of the GNU Lesser General Public
+// License as published by the Free Software Foundation; version
+// 2.1 only.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Lesser General Public License for more details.
+//
+// The license can be found in the file `LICENSE` in the top level
+// directory of this repository.
+
+package tpkg
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func licenseText(t *testing.T, id string) string {
+	text, err := knownLicenseText(id)
+	require.NoError(t, err)
+	return text
+}
+
+// reflow changes the line breaks of the given text.
+func reflow(text string, width int) string {
+	result := strings.Builder{}
+	lineLength := 0
+	for _, word := range strings.Fields(text) {
+		if lineLength+len(word) > width {
+			result.WriteString("\n")
+			lineLength = 0
+		} else if lineLength > 0 {
+			result.WriteString(" ")
+		}
+		result.WriteString(word)
+		lineLength += len(word) + 1
+	}
+	return result.String()
+}
+
+func Test_DetectLicense(t *testing.T) {
+	t.Run("Known", func(t *testing.T) {
+		for _, id := range []string{"MIT", "Apache-2.0", "BSD-2-Clause", "BSD-3-Clause", "ISC", "0BSD", "GPL-3.0", "LGPL-2.1"} {
+			match := detectLicense([]byte(licenseText(t, id)))
+			assert.Equal(t, id, match.License)
+			assert.Equal(t, 1.0, match.Confidence, id)
+			assert.True(t, match.IsDetected())
+		}
+	})
+
+	t.Run("Variations", func(t *testing.T) {
+		parts := strings.SplitN(licenseText(t, "MIT"), "Copyright (c) <year> <copyright holders>", 2)
+		require.Len(t, parts, 2)
+		copyright := "Copyright (c) 2019-2020 Jane Doe\nCopyright (c) 2021 Toitware ApS\n"
+		mit := parts[0] + copyright + parts[1]
+
+		match := detectLicense([]byte(parts[0] + copyright + reflow(parts[1], 60)))
+		assert.Equal(t, "MIT", match.License)
+		assert.Equal(t, 1.0, match.Confidence)
+
+		match = detectLicense([]byte("The MIT License (MIT)\n\n" + mit))
+		assert.Equal(t, "MIT", match.License)
+		assert.True(t, match.IsDetected())
+		assert.Less(t, match.Confidence, 1.0)
+
+		bsd3 := strings.Replace(licenseText(t, "BSD-3-Clause"), "the copyright holder", "Toitware ApS", 1)
+		match = detectLicense([]byte(bsd3))
+		assert.Equal(t, "BSD-3-Clause", match.License)
+		assert.True(t, match.IsDetected())
+	})
+
+	t.Run("Several", func(t *testing.T) {
+		mit := strings.Replace(licenseText(t, "MIT"), "<year> <copyright holders>", "2021 Toitware ApS", 1)
+		apache := licenseText(t, "Apache-2.0")
+
+		match := detectLicense([]byte(mit + "\n\n" + apache))
+		assert.Equal(t, "MIT AND Apache-2.0", match.License)
+		assert.True(t, match.IsDetected())
+
+		notice := strings.Replace(licenseText(t, "MIT"), "<year> <copyright holders>", "2015 Jane Doe", 1)
+		match = detectLicense([]byte(mit + "\n\nThis package includes code from the 'foo' library,\nwhich has the following license:\n\n" + notice))
+		assert.Equal(t, "MIT", match.License)
+		assert.True(t, match.IsDetected())
+
+		preamble := "This project is licensed under either of\n\n" +
+			"- Apache License, Version 2.0, or\n- MIT license\n\nat your option.\n\n"
+		match = detectLicense([]byte(preamble + apache + "\n\n" + mit))
+		assert.Equal(t, "Apache-2.0 OR MIT", match.License)
+		assert.True(t, match.IsDetected())
+
+		match = detectLicense([]byte("Dual licensed under the MIT and Apache 2.0 licenses.\n\n" + mit + "\n\n" + apache))
+		assert.Equal(t, "MIT OR Apache-2.0", match.License)
+
+		// The notice of the GPL says "either" and "at your option", but doesn't
+		// offer the licenses as alternatives.
+		gplNotice := "This program is free software: you can redistribute it and/or modify\n" +
+			"it under the terms of the GNU General Public License as published by\n" +
+			"the Free Software Foundation, either version 3 of the License, or\n" +
+			"(at your option) any later version.\n\n"
+		match = detectLicense([]byte(gplNotice + licenseText(t, "GPL-3.0") + "\n\n" + mit))
+		assert.Equal(t, "GPL-3.0 AND MIT", match.License)
+		assert.True(t, match.IsDetected())
+
+		match = detectLicense([]byte(mit + "\n\nSome custom license with many more restrictions that isn't\n" +
+			"known, and that is long enough to make the whole file differ from\n" +
+			"the MIT license. The licensee must send a postcard to the author,\n" +
+			"and must not use the software on Mondays, Tuesdays, or Wednesdays,\n" +
+			"unless the author agreed to it in writing, in advance, and in person.\n"))
+		assert.Equal(t, "MIT", match.License)
+		assert.False(t, match.IsDetected())
+	})
+
+	t.Run("Unknown", func(t *testing.T) {
+		mit := licenseText(t, "MIT")
+		match := detectLicense([]byte(mit[:len(mit)/2]))
+		assert.Equal(t, "MIT", match.License)
+		assert.False(t, match.IsDetected())
+
+		match = detectLicense([]byte("Some custom license.\n"))
+		assert.False(t, match.IsDetected())
+
+		match = detectLicense([]byte{})
+		assert.Equal(t, LicenseMatch{}, match)
+	})
+}
+
+func Test_DetectLicenseFiles(t *testing.T) {
+	for name, expected := range map[string]bool{
+		"LICENSE":        true,
+		"license.md":     true,
+		"LICENSE-MIT":    true,
+		"LICENCE.txt":    true,
+		"COPYING":        true,
+		"COPYING.LESSER": true,
+		"LICENSES":       false,
+		"licensed.txt":   false,
+		"README.md":      false,
+	} {
+		assert.Equal(t, expected, isLicenseFileName(name), name)
+	}
+
+	dir := t.TempDir()
+	writeLintFiles(t, dir, map[string]string{
+		"LICENSE-MIT":           licenseText(t, "MIT"),
+		"LICENSE-APACHE":        licenseText(t, "Apache-2.0"),
+		"COPYING":               reflow(licenseText(t, "MIT"), 72),
+		"notes.txt":             "Not a license.\n",
+		"LICENSE.d/third_party": licenseText(t, "ISC"),
+	})
+	matches, err := detectLicenseFiles(dir)
+	require.NoError(t, err)
+	require.Len(t, matches, 3)
+	assert.Equal(t, "COPYING", matches[0].File)
+	assert.Equal(t, "LICENSE-APACHE", matches[1].File)
+	assert.Equal(t, "LICENSE-MIT", matches[2].File)
+	assert.Equal(t, "MIT AND Apache-2.0", combineLicenseMatches(matches))
+	assert.Equal(t, "MIT", combineLicenseMatches([]LicenseMatch{matches[0], matches[2]}))
+	assert.Equal(t, "(MIT OR Apache-2.0) AND MIT AND Apache-2.0", combineLicenseMatches([]LicenseMatch{
+		{License: "MIT OR Apache-2.0", Confidence: 1},
+		{License: "MIT AND Apache-2.0", Confidence: 1},
+	}))
+	assert.Equal(t, "MIT OR Apache-2.0", combineLicenseMatches([]LicenseMatch{
+		{License: "MIT OR Apache-2.0", Confidence: 1},
+	}))
+
+	writeLintFiles(t, dir, map[string]string{"LICENSE": "Some custom license.\n"})
+	matches, err = detectLicenseFiles(dir)
+	require.NoError(t, err)
+	assert.Equal(t, "", combineLicenseMatches(matches))
+
+	matches, err = detectLicenseFiles(filepath.Join(dir, "does-not-exist"))
+	require.NoError(t, err)
+	assert.Empty(t, matches)
+
+	t.Run("Description", func(t *testing.T) {
+		dir := t.TempDir()
+		writeLintFiles(t, dir, map[string]string{
+			DefaultSpecName:  "name: pkg\ndescription: Pkg.\n",
+			"LICENSE-MIT":    licenseText(t, "MIT"),
+			"LICENSE-APACHE": licenseText(t, "Apache-2.0"),
+		})
+		require.NoError(t, os.Mkdir(filepath.Join(dir, "src"), 0755))
+		ui := testUI{}
+		desc, err := ScrapeDescriptionAt(dir, DisallowLocalDeps, true, &ui)
+		require.NoError(t, err)
+		assert.Equal(t, "Apache-2.0 AND MIT", desc.License)
+		assert.Equal(t, []string{
+			"Info: Using license 'Apache-2.0' from 'LICENSE-APACHE' file (confidence 100%)",
+			"Info: Using license 'MIT' from 'LICENSE-MIT' file (confidence 100%)",
+			"Warning: Found several licenses in the license files. Using 'Apache-2.0 AND MIT'",
+		}, ui.messages)
+	})
+}
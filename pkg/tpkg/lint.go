@@ -0,0 +1,338 @@
+// Copyright (C) 2021 Toitware ApS.
+//
+// This library is free software; you can redistribute it and/or
+// modify it under the terms of the GNU Lesser General Public
+// License as published by the Free Software Foundation; version
+// 2.1 only.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Lesser General Public License for more details.
+//
+// The license can be found in the file `LICENSE` in the top level
+// directory of this repository.
+
+package tpkg
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/hashicorp/go-version"
+)
+
+// LintSeverity is the severity of a lint diagnostic.
+type LintSeverity string
+
+const (
+	// Problems that prevent the package from being published.
+	LintError LintSeverity = "error"
+	// Problems that should be fixed, but don't prevent publishing.
+	LintWarning LintSeverity = "warning"
+)
+
+// DefaultLintMaxFileSize is the size above which files are reported.
+const DefaultLintMaxFileSize = 1024 * 1024
+
+// LintDiagnostic is a problem the linter found in a package.
+type LintDiagnostic struct {
+	Severity LintSeverity `json:"severity"`
+	// A stable identifier of the check that found the problem. For example
+	// "readme".
+	Check   string `json:"check"`
+	Message string `json:"message"`
+	// The file the diagnostic is about, relative to the package. Empty if the
+	// diagnostic isn't about a specific file.
+	Path string `json:"path,omitempty"`
+}
+
+// LintOptions configures the checks of the linter.
+type LintOptions struct {
+	// The registries that are used to find name conflicts and the SDK
+	// requirements of dependencies.
+	Registries Registries
+	// The URL of the package, if known. Registry entries with this URL
+	// don't count as name conflicts.
+	URL string
+	// Files that are bigger than this size are reported.
+	// If 0, uses DefaultLintMaxFileSize.
+	MaxFileSize int64
+}
+
+// Lint checks whether the package at the given path is ready to be published.
+// Returns an error if the package can't be checked at all, for example,
+// because its package file is invalid.
+// The diagnostics are sorted by severity (errors first).
+func Lint(path string, o LintOptions, ui UI) ([]LintDiagnostic, error) {
+	isDir, err := isDirectory(path)
+	if err != nil {
+		return nil, err
+	}
+	if !isDir {
+		return nil, ui.ReportError("Path '%s' is not a directory", path)
+	}
+	specPath := filepath.Join(path, DefaultSpecName)
+	if exists, err := isFile(specPath); err != nil {
+		return nil, err
+	} else if !exists {
+		return nil, ui.ReportError("Missing '%s' file in '%s'", DefaultSpecName, path)
+	}
+	spec, err := ReadSpec(specPath, ui)
+	if err != nil {
+		return nil, err
+	}
+
+	diagnostics := lintDiagnostics{}
+	report := diagnostics.report
+
+	lintName(spec, o, report)
+	if spec.Description == "" {
+		report(LintError, "description", DefaultSpecName, "Missing description")
+	}
+	if spec.Version != "" {
+		if _, err := semver.StrictNewVersion(spec.Version); err != nil {
+			report(LintError, "version", DefaultSpecName, "Version '%s' is not a semantic version like '1.2.3'", spec.Version)
+		}
+	}
+	lintDeps(spec, report)
+	if err := lintSDK(spec, o, report); err != nil {
+		return nil, err
+	}
+	if err := lintFiles(path, spec, o, report); err != nil {
+		return nil, err
+	}
+	if err := lintLicense(path, spec, report); err != nil {
+		return nil, err
+	}
+
+	return diagnostics.sorted(), nil
+}
+
+type lintReporter func(severity LintSeverity, check string, file string, format string, args ...interface{})
+
+// lintDiagnostics collects the diagnostics of the linter and of the
+// registry check.
+type lintDiagnostics []LintDiagnostic
+
+// report is a lintReporter that adds the diagnostic to the collection.
+func (d *lintDiagnostics) report(severity LintSeverity, check string, file string, format string, args ...interface{}) {
+	*d = append(*d, LintDiagnostic{
+		Severity: severity,
+		Check:    check,
+		Message:  fmt.Sprintf(format, args...),
+		Path:     file,
+	})
+}
+
+// sorted returns the diagnostics, errors first. Otherwise the diagnostics
+// stay in the order they were reported.
+func (d lintDiagnostics) sorted() []LintDiagnostic {
+	result := []LintDiagnostic(d)
+	if result == nil {
+		result = []LintDiagnostic{}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Severity == LintError && result[j].Severity != LintError
+	})
+	return result
+}
+
+func lintName(spec *Spec, o LintOptions, report lintReporter) {
+	if spec.Name == "" {
+		report(LintError, "name", DefaultSpecName, "Missing name")
+		return
+	}
+	// Reading the spec already verified that the name is a valid identifier.
+	found, err := o.Registries.MatchName(spec.Name)
+	if err != nil {
+		return
+	}
+	urls := map[string]bool{}
+	for _, descReg := range found {
+		if descReg.Desc.URL != o.URL {
+			urls[descReg.Desc.URL] = true
+		}
+	}
+	for _, url := range sortedBoolKeys(urls) {
+		report(LintWarning, "name-taken", DefaultSpecName, "Name '%s' is already used by '%s'", spec.Name, url)
+	}
+}
+
+func lintDeps(spec *Spec, report lintReporter) {
+	prefixes := make([]string, 0, len(spec.Deps))
+	for prefix := range spec.Deps {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+	for _, prefix := range prefixes {
+		dep := spec.Deps[prefix]
+		if dep.Path != "" {
+			report(LintError, "local-dependency", DefaultSpecName, "Dependency '%s' is a local path: '%s'", prefix, dep.Path)
+		} else if dep.Ref != "" {
+			report(LintError, "git-dependency", DefaultSpecName, "Dependency '%s' is a git reference: '%s'", prefix, dep.Ref)
+		}
+	}
+}
+
+// lintSDK checks that the SDK constraint of the package isn't lower than the
+// one of its dependencies.
+// For each dependency, the lowest SDK requirement of the versions that satisfy
+// the dependency's constraint is used.
+func lintSDK(spec *Spec, o LintOptions, report lintReporter) error {
+	minSDK, err := sdkConstraintToMinSDK(spec.Environment.SDK)
+	if err != nil {
+		return err
+	}
+	urls := []string{}
+	constraints := map[string]string{}
+	for _, dep := range spec.Deps {
+		if dep.Path != "" || dep.Ref != "" {
+			continue
+		}
+		urls = append(urls, dep.URL)
+		constraints[dep.URL] = dep.Version
+	}
+	sort.Strings(urls)
+	for _, url := range urls {
+		constraint, err := parseConstraint(constraints[url])
+		if err != nil {
+			// Already reported when reading the spec.
+			continue
+		}
+		found, err := o.Registries.SearchURL(url)
+		if err != nil {
+			return err
+		}
+		var required *version.Version
+		matched := false
+		for _, descReg := range found {
+			v, err := version.NewVersion(descReg.Desc.Version)
+			if err != nil || !constraint.Check(v) {
+				continue
+			}
+			depMinSDK, err := sdkConstraintToMinSDK(descReg.Desc.Environment.SDK)
+			if err != nil {
+				continue
+			}
+			if !matched || depMinSDK == nil || (required != nil && depMinSDK.LessThan(required)) {
+				required = depMinSDK
+			}
+			matched = true
+		}
+		if !matched {
+			report(LintWarning, "dependency", DefaultSpecName, "No version of '%s' satisfies constraint '%s'", url, constraints[url])
+			continue
+		}
+		if required != nil && (minSDK == nil || minSDK.LessThan(required)) {
+			report(LintWarning, "sdk", DefaultSpecName, "Dependency '%s' requires SDK version %s or higher. Set the SDK constraint to at least '^%s'", url, required, required)
+		}
+	}
+	return nil
+}
+
+func lintFiles(path string, spec *Spec, o LintOptions, report lintReporter) error {
+	srcPath := filepath.Join(path, "src")
+	if isDir, err := isDirectory(srcPath); err != nil || !isDir {
+		report(LintError, "src", "", "Missing 'src' directory")
+	} else if spec.Name != "" {
+		entry := "src/" + spec.Name + ".toit"
+		if exists, err := isFile(filepath.Join(path, filepath.FromSlash(entry))); err != nil {
+			return err
+		} else if !exists {
+			report(LintWarning, "entry-file", entry, "Missing library '%s'. Users can't import the package by its name", entry)
+		}
+	}
+
+	if spec.Readme != "" {
+		if exists, err := isFile(filepath.Join(path, filepath.FromSlash(spec.Readme))); err != nil {
+			return err
+		} else if !exists {
+			report(LintWarning, "readme", spec.Readme, "Readme file '%s' not found", spec.Readme)
+		}
+	} else {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return err
+		}
+		found := false
+		for _, entry := range entries {
+			if !entry.IsDir() && strings.HasPrefix(strings.ToLower(entry.Name()), "readme") {
+				found = true
+				break
+			}
+		}
+		if !found {
+			report(LintWarning, "readme", "", "Missing README file")
+		}
+	}
+
+	maxSize := o.MaxFileSize
+	if maxSize == 0 {
+		maxSize = DefaultLintMaxFileSize
+	}
+	return filepath.WalkDir(path, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if p != path && (entry.Name() == ".git" || entry.Name() == ProjectPackagesPath) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if info.Size() > maxSize {
+			rel, err := filepath.Rel(path, p)
+			if err != nil {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+			report(LintWarning, "file-size", rel, "File '%s' is %s (more than %s)", rel, FormatSize(info.Size()), FormatSize(maxSize))
+		}
+		return nil
+	})
+}
+
+func lintLicense(path string, spec *Spec, report lintReporter) error {
+	if spec.License != "" {
+		if _, err := ParseLicenseExpression(spec.License); err != nil {
+			report(LintError, "license", DefaultSpecName, "Invalid SPDX license expression '%s': %v", spec.License, err)
+		}
+		return nil
+	}
+	matches, err := detectLicenseFiles(path)
+	if err != nil {
+		return err
+	}
+	if len(matches) == 0 {
+		report(LintError, "license", "", "Missing license")
+		return nil
+	}
+	for _, match := range matches {
+		if !match.IsDetected() {
+			report(LintError, "license", match.File, "Unknown license in '%s' file. Add a 'license' entry to '%s'", match.File, DefaultSpecName)
+		}
+	}
+	if license := combineLicenseMatches(matches); strings.Contains(license, " "+LicenseAnd+" ") {
+		report(LintWarning, "license", "", "The license files have several licenses. Add a 'license' entry to '%s'", DefaultSpecName)
+	}
+	return nil
+}
+
+func sortedBoolKeys(m map[string]bool) []string {
+	result := make([]string, 0, len(m))
+	for key := range m {
+		result = append(result, key)
+	}
+	sort.Strings(result)
+	return result
+}
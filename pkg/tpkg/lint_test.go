@@ -0,0 +1,150 @@
+// Copyright (C) 2021 Toitware ApS.
+//
+// This library is free software; you can redistribute it and/or
+// modify it under the terms of the GNU Lesser General Public
+// License as published by the Free Software Foundation; version
+// 2.1 only.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Lesser General Public License for more details.
+//
+// The license can be found in the file `LICENSE` in the top level
+// directory of this repository.
+
+package tpkg
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeLintFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0755))
+		require.NoError(t, os.WriteFile(p, []byte(content), 0644))
+	}
+}
+
+func Test_Lint(t *testing.T) {
+	bar100 := NewDesc("bar", "", "github.com/foo/bar", "1.0.0", "^1.5.0", "MIT", "", nil)
+	bar110 := NewDesc("bar", "", "github.com/foo/bar", "1.1.0", "^1.8.0", "MIT", "", nil)
+	other := NewDesc("morse", "", "github.com/other/morse", "1.0.0", "", "MIT", "", nil)
+	registries := makeRegistries(bar100, bar110, other)
+
+	t.Run("Clean", func(t *testing.T) {
+		dir := t.TempDir()
+		writeLintFiles(t, dir, map[string]string{
+			DefaultSpecName: `name: morse
+description: Morse code.
+license: MIT
+environment:
+  sdk: ^1.6.0
+dependencies:
+  bar:
+    url: github.com/foo/bar
+    version: ^1.0.0
+`,
+			"README.md":      "# Morse\n",
+			"src/morse.toit": "main:\n",
+		})
+		diagnostics, err := Lint(dir, LintOptions{
+			Registries: registries,
+			URL:        "github.com/other/morse",
+		}, &testUI{})
+		require.NoError(t, err)
+		assert.Empty(t, diagnostics)
+	})
+
+	t.Run("Problems", func(t *testing.T) {
+		dir := t.TempDir()
+		writeLintFiles(t, dir, map[string]string{
+			DefaultSpecName: `name: morse
+version: "1.0"
+license: Foo
+dependencies:
+  bar:
+    url: github.com/foo/bar
+    version: ^1.0.0
+  local:
+    path: ../local
+`,
+			"src/other.toit": "main:\n",
+			"data/big.bin":   strings.Repeat("0123456789", 30),
+		})
+		diagnostics, err := Lint(dir, LintOptions{
+			Registries:  registries,
+			MaxFileSize: 200,
+		}, &testUI{})
+		require.NoError(t, err)
+		assert.Equal(t, []LintDiagnostic{
+			{LintError, "description", "Missing description", DefaultSpecName},
+			{LintError, "version", "Version '1.0' is not a semantic version like '1.2.3'", DefaultSpecName},
+			{LintError, "local-dependency", "Dependency 'local' is a local path: '../local'", DefaultSpecName},
+			{LintError, "license", "Invalid SPDX license expression 'Foo': unknown license ID 'Foo'", DefaultSpecName},
+			{LintWarning, "name-taken", "Name 'morse' is already used by 'github.com/other/morse'", DefaultSpecName},
+			{LintWarning, "sdk", "Dependency 'github.com/foo/bar' requires SDK version 1.5.0 or higher. Set the SDK constraint to at least '^1.5.0'", DefaultSpecName},
+			{LintWarning, "entry-file", "Missing library 'src/morse.toit'. Users can't import the package by its name", "src/morse.toit"},
+			{LintWarning, "readme", "Missing README file", ""},
+			{LintWarning, "file-size", "File 'data/big.bin' is 300 B (more than 200 B)", "data/big.bin"},
+		}, diagnostics)
+	})
+
+	t.Run("Missing src", func(t *testing.T) {
+		dir := t.TempDir()
+		writeLintFiles(t, dir, map[string]string{
+			DefaultSpecName: "name: morse\ndescription: Morse.\n",
+			"LICENSE":       "Some custom license.\n",
+			"README.md":     "# Morse\n",
+		})
+		diagnostics, err := Lint(dir, LintOptions{}, &testUI{})
+		require.NoError(t, err)
+		assert.Equal(t, []LintDiagnostic{
+			{LintError, "src", "Missing 'src' directory", ""},
+			{LintError, "license", "Unknown license in 'LICENSE' file. Add a 'license' entry to 'package.yaml'", "LICENSE"},
+		}, diagnostics)
+	})
+
+	t.Run("License files", func(t *testing.T) {
+		dir := t.TempDir()
+		mit, err := knownLicenseText("MIT")
+		require.NoError(t, err)
+		isc, err := knownLicenseText("ISC")
+		require.NoError(t, err)
+		writeLintFiles(t, dir, map[string]string{
+			DefaultSpecName:  "name: morse\ndescription: Morse.\n",
+			"LICENSE.md":     mit,
+			"COPYING":        isc,
+			"COPYING.notes":  "Some notes.\n",
+			"README.md":      "# Morse\n",
+			"src/morse.toit": "main:\n",
+		})
+		diagnostics, err := Lint(dir, LintOptions{}, &testUI{})
+		require.NoError(t, err)
+		assert.Equal(t, []LintDiagnostic{
+			{LintError, "license", "Unknown license in 'COPYING.notes' file. Add a 'license' entry to 'package.yaml'", "COPYING.notes"},
+		}, diagnostics)
+
+		require.NoError(t, os.Remove(filepath.Join(dir, "COPYING.notes")))
+		diagnostics, err = Lint(dir, LintOptions{}, &testUI{})
+		require.NoError(t, err)
+		assert.Equal(t, []LintDiagnostic{
+			{LintWarning, "license", "The license files have several licenses. Add a 'license' entry to 'package.yaml'", ""},
+		}, diagnostics)
+	})
+
+	t.Run("Missing spec", func(t *testing.T) {
+		ui := testUI{}
+		dir := t.TempDir()
+		_, err := Lint(dir, LintOptions{}, &ui)
+		assert.True(t, IsErrAlreadyReported(err))
+		assert.Equal(t, []string{"Error: Missing 'package.yaml' file in '" + dir + "'"}, ui.messages)
+	})
+}
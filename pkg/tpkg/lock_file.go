@@ -35,14 +35,59 @@ import (
 // LockFile represents a lock file.
 type LockFile struct {
 	// The path to the lock file. If any.
-	path string `yaml:"-"`
+	path string `yaml:"-" json:"-"`
 	// SDK constraint, if any.
 	// Must be of form '^version'.
-	SDK string `yaml:"sdk,omitempty"`
+	SDK string `yaml:"sdk,omitempty" json:"sdk,omitempty"`
+	// The targets of the project the packages were solved for.
+	Targets []string `yaml:"targets,omitempty" json:"targets,omitempty"`
+	// The overrides of the package file the packages were solved with.
+	Overrides map[string]LockOverride `yaml:"overrides,omitempty" json:"overrides,omitempty"`
 	// Prefixes for the entry module.
-	Prefixes PrefixMap `yaml:"prefixes,omitempty"`
+	Prefixes PrefixMap `yaml:"prefixes,omitempty" json:"prefixes,omitempty"`
 	// All dependent packages: from package-id to their PackageEntry
-	Packages map[string]PackageEntry `yaml:"packages,omitempty"`
+	Packages map[string]PackageEntry `yaml:"packages,omitempty" json:"packages,omitempty"`
+}
+
+// LockOverride is an override of the package file, as recorded in the lock
+// file.
+type LockOverride struct {
+	URL     string        `yaml:"url,omitempty" json:"url,omitempty"`
+	Version string        `yaml:"version,omitempty" json:"version,omitempty"`
+	Path    compiler.Path `yaml:"path,omitempty" json:"path,omitempty"`
+}
+
+// lockOverrides returns the overrides of a package file in the form that is
+// recorded in the lock file.
+// Returns nil if there are no overrides.
+func lockOverrides(overrides DependencyMap) map[string]LockOverride {
+	if len(overrides) == 0 {
+		return nil
+	}
+	result := map[string]LockOverride{}
+	for url, override := range overrides {
+		result[url] = LockOverride{
+			URL:     override.URL,
+			Version: override.Version,
+			Path:    override.Path,
+		}
+	}
+	return result
+}
+
+// sameOverrides returns whether the overrides of the package file are the
+// ones that are recorded in the lock file.
+func sameOverrides(overrides DependencyMap, locked map[string]LockOverride) bool {
+	current := lockOverrides(overrides)
+	if len(current) != len(locked) {
+		return false
+	}
+	for url, override := range current {
+		if lockedOverride, ok := locked[url]; !ok || lockedOverride != override {
+			return false
+		}
+	}
+	return true
 }
 
 // PackageEntry corresponds to a resolved package.
@@ -50,13 +95,16 @@ type LockFile struct {
 // can be absolute or relative to the lock file.
 // If 'url' is given, then 'version' must be given as well. The entry then refers to
 // a non-local package and is found in the package cache.
+// If 'ref' is given, the package was checked out from its git repository at
+// the commit 'hash', and the 'version' is a pseudo version.
 type PackageEntry struct {
-	URL      compiler.URIPath `yaml:"url,omitempty"`
-	Name     string           `yaml:"name,omitempty"`
-	Version  string           `yaml:"version,omitempty"`
-	Path     compiler.Path    `yaml:"path,omitempty"`
-	Hash     string           `yaml:"hash,omitempty"`
-	Prefixes PrefixMap        `yaml:"prefixes,omitempty"`
+	URL      compiler.URIPath `yaml:"url,omitempty" json:"url,omitempty"`
+	Name     string           `yaml:"name,omitempty" json:"name,omitempty"`
+	Version  string           `yaml:"version,omitempty" json:"version,omitempty"`
+	Path     compiler.Path    `yaml:"path,omitempty" json:"path,omitempty"`
+	Ref      string           `yaml:"ref,omitempty" json:"ref,omitempty"`
+	Hash     string           `yaml:"hash,omitempty" json:"hash,omitempty"`
+	Prefixes PrefixMap        `yaml:"prefixes,omitempty" json:"prefixes,omitempty"`
 }
 
 // PrefixMap has a mapping from prefix to package-id.
@@ -17,6 +17,7 @@ package tpkg
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -37,6 +38,13 @@ type ProjectPaths struct {
 
 	// The path of the spec file for the current project.
 	SpecFile string
+
+	// The directory of the workspace member in which the project was found,
+	// or that was given as project root. Dependencies are added to, and
+	// removed from, the package file of this member.
+	// Empty if the project isn't a workspace, or if the search didn't start
+	// in a member.
+	WorkspaceMemberPath string
 }
 
 // Manager serves as entry point for all package-management related operations.
@@ -107,14 +115,26 @@ func (m *ProjectPkgManager) download(ctx context.Context, url string, version st
 		return err
 	}
 	p := m.cache.PreferredPkgPath(projectRoot, url, version)
-	_, err = DownloadGit(ctx, DownloadGitOptions{
-		Directory:  p,
-		URL:        url,
-		Version:    version,
-		Hash:       hash,
-		UI:         m.ui,
-		NoReadOnly: false,
-	})
+	if m.cache.HasPkgStore() {
+		var storePath string
+		storePath, err = downloadToStore(ctx, m.cache, url, version, hash, m.ui)
+		if err == nil {
+			err = linkTree(storePath, p)
+			if err != nil {
+				os.RemoveAll(p)
+				err = m.ui.ReportError("Failed to install package '%s' from the package store: %v", url, err)
+			}
+		}
+	} else {
+		_, err = DownloadGit(ctx, DownloadGitOptions{
+			Directory:  p,
+			URL:        url,
+			Version:    version,
+			Hash:       hash,
+			UI:         m.ui,
+			NoReadOnly: false,
+		})
+	}
 
 	event := &tracking.Event{
 		Name: "toit pkg download-git",
@@ -129,12 +149,29 @@ func (m *ProjectPkgManager) download(ctx context.Context, url string, version st
 	}
 	m.track(ctx, event)
 
+	var downloadErr *DownloadError
+	if err != nil && !errors.As(err, &downloadErr) {
+		if !IsErrAlreadyReported(err) {
+			m.ui.ReportError("Failed to download '%s' - '%s': %v", url, version, err)
+		}
+		err = &DownloadError{
+			URL:     url,
+			Version: version,
+			Err:     err,
+		}
+	}
 	return err
 }
 
 func (m *ProjectPkgManager) downloadLockFilePackages(ctx context.Context, lf *LockFile) error {
 	encounteredError := false
 	for pkgID, pe := range lf.Packages {
+		if pe.Path == "" && pe.Ref != "" {
+			if _, err := m.downloadGitRef(ctx, pe.URL.URL(), pe.Ref, pe.Hash); err != nil {
+				return err
+			}
+			continue
+		}
 		if pe.Path == "" {
 			if err := m.download(ctx, pe.URL.URL(), pe.Version, pe.Hash); err != nil {
 				return err
@@ -182,7 +219,8 @@ func (m *ProjectPkgManager) identifyInstallURL(ctx context.Context, pkgName stri
 		pkgName = pkgName[:atPos]
 	}
 
-	var constraints version.Constraints
+	// Without version, prereleases are ignored.
+	constraints := Constraints{}
 	if versionStr != nil {
 		if *versionStr == "" {
 			return nil, m.ui.ReportError("Missing version after '@' in '%s@'", pkgName)
@@ -212,7 +250,7 @@ func (m *ProjectPkgManager) identifyInstallURL(ctx context.Context, pkgName stri
 	}
 
 	if len(found) == 0 {
-		return nil, m.ui.ReportError("Package '%s' not found", pkgName)
+		return nil, reportError(m.ui, &PackageNotFoundError{Name: pkgName}, "Package '%s' not found", pkgName)
 	}
 
 	urlCandidates := set.String{}
@@ -236,7 +274,12 @@ func (m *ProjectPkgManager) identifyInstallURL(ctx context.Context, pkgName stri
 		}
 		if !foundFullMatch {
 			// TODO(florian): print all matching packages.
-			return nil, m.ui.ReportError("More than one matching package '%s' found", pkgName)
+			candidates := urlCandidates.Values()
+			sort.Strings(candidates)
+			return nil, reportError(m.ui, &AmbiguousPackageError{
+				Name:       pkgName,
+				Candidates: candidates,
+			}, "More than one matching package '%s' found", pkgName)
 		}
 	}
 
@@ -247,13 +290,18 @@ func (m *ProjectPkgManager) identifyInstallURL(ctx context.Context, pkgName stri
 
 	var maxVersion *version.Version
 	name := ""
+	foundYanked := false
 	for _, candidate := range candidates {
 		desc := candidate.Desc
 		v, err := version.NewVersion(desc.Version)
 		if err != nil {
 			return nil, err
 		}
-		if constraints != nil && !constraints.Check(v) {
+		if !constraints.Check(v) {
+			continue
+		}
+		if desc.Yanked != "" {
+			foundYanked = true
 			continue
 		}
 		if maxVersion == nil || v.GreaterThan(maxVersion) {
@@ -262,12 +310,25 @@ func (m *ProjectPkgManager) identifyInstallURL(ctx context.Context, pkgName stri
 		}
 	}
 
+	if maxVersion == nil && foundYanked {
+		return nil, reportError(m.ui, &PackageNotFoundError{
+			Name: pkgName,
+		}, "All matching versions of package '%s' have been yanked", pkgName)
+	}
+	if maxVersion == nil && versionStr == nil {
+		return nil, reportError(m.ui, &PackageNotFoundError{
+			Name: pkgName,
+		}, "Package '%s' only has prereleases. Specify a version to install one", pkgName)
+	}
 	if maxVersion == nil {
-		return nil, m.ui.ReportError("No package '%s' with version %s found", pkgName, *versionStr)
+		return nil, reportError(m.ui, &PackageNotFoundError{
+			Name:    pkgName,
+			Version: *versionStr,
+		}, "No package '%s' with version %s found", pkgName, *versionStr)
 	}
 
 	constraintsStr := ""
-	if constraints != nil {
+	if versionStr != nil {
 		constraintsStr = constraints.String()
 	}
 	return &pkgInstallRequest{
@@ -314,8 +375,9 @@ func (m *ProjectPkgManager) readSpecAndLock() (*Spec, *LockFile, error) {
 		// spec file.
 
 		missingPrefixes := []string{}
+		allDeps := spec.allDeps()
 		for prefix := range lf.Prefixes {
-			if _, ok := spec.Deps[prefix]; !ok {
+			if _, ok := allDeps[prefix]; !ok {
 				missingPrefixes = append(missingPrefixes, prefix)
 			}
 		}
@@ -327,6 +389,12 @@ func (m *ProjectPkgManager) readSpecAndLock() (*Spec, *LockFile, error) {
 		}
 	}
 
+	if specExists && spec.Workspace != nil {
+		if err := m.reportMemberLockFiles(spec); err != nil {
+			return nil, nil, err
+		}
+	}
+
 	if !specExists {
 		if lfExists {
 			spec, err = NewSpecFromLockFile(lf)
@@ -381,14 +449,14 @@ func (m *ProjectPkgManager) InstallLocalPkg(ctx context.Context, name string, pa
 		}
 		spec, err := ReadSpec(target_spec, m.ui)
 		if err != nil {
-			return "", m.ui.ReportError("Cannot read 'package.yaml' at '%s': %v", target_spec, err)
+			return "", reportSpecError(m.ui, target_spec, "Cannot read 'package.yaml' at '%s': %v", target_spec, err)
 		}
 		if spec.Name == "" {
-			return "", m.ui.ReportError("Missing name in 'package.yaml' of package at '%s'", path)
+			return "", reportSpecError(m.ui, target_spec, "Missing name in 'package.yaml' of package at '%s'", path)
 		}
 		name = spec.Name
 		if !isValidName(name) {
-			return "", m.ui.ReportError("Invalid name '%s' in 'package.yaml' file at '%s'", name, path)
+			return "", reportSpecError(m.ui, target_spec, "Invalid name '%s' in 'package.yaml' file at '%s'", name, path)
 		}
 	} else {
 		if !isValidName(name) {
@@ -400,40 +468,38 @@ func (m *ProjectPkgManager) InstallLocalPkg(ctx context.Context, name string, pa
 	if err != nil {
 		return "", err
 	}
+	depsSpec, err := m.readDepsSpec(spec)
+	if err != nil {
+		return "", err
+	}
 
-	if _, ok := spec.Deps[name]; ok {
+	if _, ok := depsSpec.allDeps()[name]; ok {
 		return "", m.ui.ReportError("Project has already a package with name '%s'", name)
 
 	}
 
 	// Add the local dependency to the deps before we build the solver deps.
-	spec.addDep(name, "", "", path, m.ui)
+	depsSpec.addDep(name, "", "", path, m.ui)
 
-	solverDeps, err := spec.BuildSolverDeps(m.ui)
-	if err != nil {
-		return "", err
-	}
-
-	solution, err := m.findSolution(spec.Environment.SDK, solverDeps, lf, nil)
-	if err != nil {
-		return "", err
-	}
-	if solution == nil {
-		return "", m.ui.ReportError("Couldn't find a valid solution for the package constraints")
-	}
+	_, err = m.updateDeps(spec, depsSpec, func() (*LockFile, error) {
+		solverDeps, err := spec.BuildSolverDeps(m.ui)
+		if err != nil {
+			return nil, err
+		}
 
-	// Note that we need the downloaded packages, as we need their spec files to build
-	// the updated lock file. Otherwise we don't have the prefixes of the packages.
-	if err := m.downloadSolution(ctx, solution); err != nil {
-		return "", err
-	}
+		solution, err := m.findSolution(ctx, spec, solverDeps, lf, nil)
+		if err != nil {
+			return nil, err
+		}
 
-	updatedLock, err := spec.BuildLockFile(solution, m.cache, m.registries, m.ui)
-	if err != nil {
-		return "", err
-	}
+		// Note that we need the downloaded packages, as we need their spec files to build
+		// the updated lock file. Otherwise we don't have the prefixes of the packages.
+		if err := m.downloadSolution(ctx, solution); err != nil {
+			return nil, err
+		}
 
-	err = m.writeSpecAndLock(spec, updatedLock)
+		return spec.BuildLockFile(solution, m.cache, m.registries, m.ui)
+	})
 	if err != nil {
 		return "", err
 	}
@@ -468,10 +534,14 @@ func (m *ProjectPkgManager) InstallURLPkg(ctx context.Context, name string, id s
 	if err != nil {
 		return "", "", err
 	}
+	depsSpec, err := m.readDepsSpec(spec)
+	if err != nil {
+		return "", "", err
+	}
 
 	// Packages can theoretically change names with different versions.
 	// We will recheck before adding the new dependency.
-	if _, ok := spec.Deps[name]; ok {
+	if _, ok := depsSpec.allDeps()[name]; ok {
 		return "", "", m.ui.ReportError("Project has already a package with name '%s'", name)
 
 	}
@@ -507,13 +577,10 @@ func (m *ProjectPkgManager) InstallURLPkg(ctx context.Context, name string, id s
 		}
 	}
 
-	solution, err := m.findSolution(spec.Environment.SDK, solverDeps, lf, unpreferred)
+	solution, err := m.findSolution(ctx, spec, solverDeps, lf, unpreferred)
 	if err != nil {
 		return "", "", err
 	}
-	if solution == nil {
-		return "", "", m.ui.ReportError("Couldn't find a valid solution for the package constraints")
-	}
 
 	// We still need to add the package to the dependencies.
 	// Also, if the name was inferred, we need to check that the name is still the
@@ -544,25 +611,30 @@ func (m *ProjectPkgManager) InstallURLPkg(ctx context.Context, name string, id s
 	// The installation process automatically adjusts the version constraint of
 	// installed packages to accept semver compatible versions.
 	versionConstraint := "^" + solvedVersion
-	if err := spec.addDep(name, installPkg.url, versionConstraint, "", m.ui); err != nil {
+	if err := depsSpec.addDep(name, installPkg.url, versionConstraint, "", m.ui); err != nil {
 		return "", "", err
 	}
 
-	// Note that we need the downloaded packages, as we need their spec files to build
-	// the updated lock file. Otherwise we don't have the prefixes of the packages.
-	if err := m.downloadSolution(ctx, solution); err != nil {
-		return "", "", err
-	}
-
-	updatedLock, err := spec.BuildLockFile(solution, m.cache, m.registries, m.ui)
-	if err != nil {
-		return "", "", err
-	}
+	updatedLock, err := m.updateDeps(spec, depsSpec, func() (*LockFile, error) {
+		// Note that we need the downloaded packages, as we need their spec files to build
+		// the updated lock file. Otherwise we don't have the prefixes of the packages.
+		if err := m.downloadSolution(ctx, solution); err != nil {
+			return nil, err
+		}
 
-	err = m.writeSpecAndLock(spec, updatedLock)
+		updatedLock, err := spec.BuildLockFile(solution, m.cache, m.registries, m.ui)
+		if err != nil {
+			return nil, err
+		}
+		if err := m.enforceLicensePolicy(updatedLock); err != nil {
+			return nil, err
+		}
+		return updatedLock, nil
+	})
 	if err != nil {
 		return "", "", err
 	}
+	m.reportDeprecations(updatedLock)
 
 	installedPkgStr := installPkg.url + "@" + solvedVersion
 	return name, installedPkgStr, nil
@@ -573,24 +645,31 @@ func (m *ProjectPkgManager) Uninstall(ctx context.Context, name string) error {
 	if err != nil {
 		return err
 	}
-	if _, ok := spec.Deps[name]; !ok {
+	depsSpec, err := m.readDepsSpec(spec)
+	if err != nil {
+		return err
+	}
+	if _, ok := depsSpec.allDeps()[name]; !ok {
 		m.ui.ReportInfo("Package '%s' does not exist", name)
 		return nil
 	}
-	delete(spec.Deps, name)
+	delete(depsSpec.Deps, name)
+	delete(depsSpec.DevDeps, name)
 
-	updatedLock, err := m.solveAndDownload(ctx, spec, lf)
-	if err != nil {
-		return err
-	}
-	return m.writeSpecAndLock(spec, updatedLock)
+	_, err = m.updateDeps(spec, depsSpec, func() (*LockFile, error) {
+		return m.solveAndDownload(ctx, spec, lf)
+	})
+	return err
 }
 
 // Install downloads all dependencies.
 // Simply downloads all dependencies, if forceRecompute is false, and a lock file
-// without local dependencies exists.
+// exists that still satisfies the dependencies of the local packages and
+// workspace members.
 // Otherwise (re)computes the lockfile, giving preference to versions that are
 // listed in the lockfile (if it exists).
+// Fails if the license policy of the project doesn't allow the license of a
+// dependency.
 func (m *ProjectPkgManager) Install(ctx context.Context, forceRecompute bool) error {
 	spec, lf, err := m.readSpecAndLock()
 	if err != nil {
@@ -602,19 +681,41 @@ func (m *ProjectPkgManager) Install(ctx context.Context, forceRecompute bool) er
 		needsToSolve = true
 	} else if spec.Environment.SDK != lf.SDK {
 		needsToSolve = true
+	} else if !sameOverrides(spec.Overrides, lf.Overrides) {
+		needsToSolve = true
+	} else if gitRefsChanged(spec, lf) {
+		needsToSolve = true
+	} else if !sameTargets(projectTargets(spec.Environment.Targets), lf.Targets) {
+		needsToSolve = true
 	} else {
+		hasLocalPkgs := spec.Workspace != nil
 		for _, pkg := range lf.Packages {
 			if pkg.Path != "" {
-				// Path dependencies might have changed constraints.
-				// Recompute the dependencies, preferring the existing entries.
-				needsToSolve = true
+				hasLocalPkgs = true
 				break
 			}
 		}
+		if hasLocalPkgs {
+			// Path dependencies and workspace members might have changed their
+			// dependencies. Recompute the dependencies, preferring the existing
+			// entries, if the lock file doesn't satisfy them anymore.
+			changed, err := spec.localDepsChanged(lf, m.ui)
+			if err != nil {
+				return err
+			}
+			needsToSolve = changed
+		}
 	}
 
 	if !needsToSolve {
-		return m.downloadLockFilePackages(ctx, lf)
+		if err := m.downloadLockFilePackages(ctx, lf); err != nil {
+			return err
+		}
+		if err := m.enforceLicensePolicy(lf); err != nil {
+			return err
+		}
+		m.reportDeprecations(lf)
+		return nil
 	}
 
 	updatedLock, err := m.solveAndDownload(ctx, spec, lf)
@@ -629,7 +730,14 @@ func (m *ProjectPkgManager) Install(ctx context.Context, forceRecompute bool) er
 	// is easy to run into reading partially written specs when
 	// installing dependencies in parallel across multiple
 	// projects.
-	return updatedLock.WriteToFile()
+	if err := m.enforceLicensePolicy(updatedLock); err != nil {
+		return err
+	}
+	if err := updatedLock.WriteToFile(); err != nil {
+		return err
+	}
+	m.reportDeprecations(updatedLock)
+	return nil
 }
 
 func (m *ProjectPkgManager) Update(ctx context.Context) error {
@@ -649,16 +757,75 @@ func (m *ProjectPkgManager) Update(ctx context.Context) error {
 		return err
 	}
 
-	spec.Deps = newSpec.Deps
+	// Dev dependencies stay dev dependencies.
+	// Overridden dependencies are kept as they are, as the lock file
+	// contains the replacements.
+	deps := DependencyMap{}
+	for prefix, dep := range newSpec.Deps {
+		if old, ok := spec.allDeps()[prefix]; ok && old.Path == "" {
+			if _, isOverridden := spec.Overrides[old.URL]; isOverridden {
+				dep = old
+			}
+		}
+		if _, ok := spec.DevDeps[prefix]; ok {
+			spec.DevDeps[prefix] = dep
+		} else {
+			deps[prefix] = dep
+		}
+	}
+	spec.Deps = deps
 
-	return m.writeSpecAndLock(spec, updatedLock)
+	if err := m.enforceLicensePolicy(updatedLock); err != nil {
+		return err
+	}
+	if err := m.writeSpecAndLock(spec, updatedLock); err != nil {
+		return err
+	}
+	m.reportDeprecations(updatedLock)
+	return nil
 }
 
-func (m *ProjectPkgManager) findSolution(minSDKStr string, solverDeps []SolverDep, oldLock *LockFile, unpreferred *PackageEntry) (*Solution, error) {
+// reportDeprecations warns about packages in the lock file that are
+// deprecated or whose locked version has been yanked.
+// A package is deprecated if the locked version or its newest version
+// is marked as deprecated.
+func (m *ProjectPkgManager) reportDeprecations(lf *LockFile) {
+	for _, status := range m.lockedPackageStatuses(lf) {
+		if status.Yanked != "" {
+			m.ui.ReportWarning("Package '%s' version %s has been yanked: %s", status.URL, status.Version, status.Yanked)
+		}
+		if deprecation := status.Deprecated; deprecation != nil {
+			if deprecation.Replacement != "" {
+				m.ui.ReportWarning("Package '%s' is deprecated: %s. Use '%s' instead", status.URL, deprecation.Message, deprecation.Replacement)
+			} else {
+				m.ui.ReportWarning("Package '%s' is deprecated: %s", status.URL, deprecation.Message)
+			}
+		}
+	}
+}
+
+// findSolution runs the solver on the given dependencies.
+// The SDK constraint, the project targets and the overrides are taken from the
+// given (entry) spec.
+// Git-ref dependencies are resolved (and downloaded) first, using the hashes of
+// the old lock file, if any.
+// Returns a NoSolutionError if there isn't any solution.
+func (m *ProjectPkgManager) findSolution(ctx context.Context, spec *Spec, solverDeps []SolverDep, oldLock *LockFile, unpreferred *PackageEntry) (*Solution, error) {
 	solver, err := NewSolver(m.registries, m.sdkVersion, m.ui)
 	if err != nil {
 		return nil, err
 	}
+	solver.SetTargets(projectTargets(spec.Environment.Targets))
+	if err := solver.SetOverrides(spec.Overrides); err != nil {
+		return nil, err
+	}
+	gitRefs, err := m.resolveGitRefs(ctx, spec, oldLock)
+	if err != nil {
+		return nil, err
+	}
+	if err := solver.setGitRefs(gitRefs); err != nil {
+		return nil, err
+	}
 	if oldLock != nil {
 		preferred := []versionedURL{}
 		for _, lockPkg := range oldLock.Packages {
@@ -674,25 +841,35 @@ func (m *ProjectPkgManager) findSolution(minSDKStr string, solverDeps []SolverDe
 		}
 		solver.SetPreferred(preferred)
 	}
-	minSDK, err := sdkConstraintToMinSDK(minSDKStr)
+	sdk, err := parseSDKConstraint(spec.Environment.SDK)
 	if err != nil {
 		return nil, err
 	}
-	return solver.Solve(minSDK, solverDeps), nil
+	solution := solver.Solve(sdk, solverDeps)
+	if solution == nil {
+		return nil, reportError(m.ui, &NoSolutionError{
+			Conflicts: solver.Conflicts(),
+		}, "Couldn't find a valid solution for the package constraints")
+	}
+	return solution, nil
 }
 
-func (m *ProjectPkgManager) findSolutionFromSpec(spec *Spec, oldLock *LockFile) (*Solution, error) {
+func (m *ProjectPkgManager) findSolutionFromSpec(ctx context.Context, spec *Spec, oldLock *LockFile) (*Solution, error) {
 	solverDeps, err := spec.BuildSolverDeps(m.ui)
 	if err != nil {
 		return nil, err
 	}
-	return m.findSolution(spec.Environment.SDK, solverDeps, oldLock, nil)
+	return m.findSolution(ctx, spec, solverDeps, oldLock, nil)
 
 }
 
 // downloadSolution downloads all packages in the given solution.
 func (m *ProjectPkgManager) downloadSolution(ctx context.Context, solution *Solution) error {
 	for url, versions := range solution.pkgs {
+		if _, ok := solution.gitRefs[url]; ok {
+			// Git-ref packages are downloaded when they are resolved.
+			continue
+		}
 		for _, version := range versions {
 			// If we can't find the hash in the registries, we just use the empty string.
 			hash, _ := m.registries.hashFor(url, version.vStr)
@@ -709,13 +886,10 @@ func (m *ProjectPkgManager) downloadSolution(ctx context.Context, solution *Solu
 // It uses the old lockfile as hints for which package versions are preferred.
 // Returns a lock-file corresponding to the resolved packages of the spec.
 func (m *ProjectPkgManager) solveAndDownload(ctx context.Context, spec *Spec, oldLock *LockFile) (*LockFile, error) {
-	solution, err := m.findSolutionFromSpec(spec, oldLock)
+	solution, err := m.findSolutionFromSpec(ctx, spec, oldLock)
 	if err != nil {
 		return nil, err
 	}
-	if solution == nil {
-		return nil, m.ui.ReportError("Couldn't find a valid solution for the package constraints")
-	}
 	// Note that we need the downloaded packages, as we need their spec files to build
 	// the updated lock file. Otherwise we don't have the prefixes of the packages.
 	if err := m.downloadSolution(ctx, solution); err != nil {
@@ -820,20 +994,12 @@ func (m *ProjectPkgManager) CleanPackages() error {
 // Does not overwrite a set value (m.SpecFile or m.LockFile).
 // If the given directory is empty, starts the search in the current working directory.
 // If a file doesn't exists, returns the path for it in the given directory.
+// If the found (or given) directory is a member of a workspace, uses the root
+// of the workspace instead.
 func NewProjectPaths(projectRoot string, lockPath string, specPath string) (*ProjectPaths, error) {
 
 	if projectRoot != "" {
-		if lockPath == "" {
-			lockPath = lockPathForDir(projectRoot)
-		}
-		if specPath == "" {
-			specPath = pkgPathForDir(projectRoot)
-		}
-		return &ProjectPaths{
-			ProjectRootPath: projectRoot,
-			LockFile:        lockPath,
-			SpecFile:        specPath,
-		}, nil
+		return newWorkspacePaths(projectRoot, lockPathForDir(projectRoot), pkgPathForDir(projectRoot), lockPath, specPath)
 	}
 
 	dir, err := os.Getwd()
@@ -876,6 +1042,31 @@ func NewProjectPaths(projectRoot string, lockPath string, specPath string) (*Pro
 		}
 	}
 
+	return newWorkspacePaths(dir, lockPathCandidate, specPathCandidate, lockPath, specPath)
+}
+
+// newWorkspacePaths returns the paths of the project in the given directory.
+// Members of a workspace use the lock file of the workspace root. If the
+// directory is a member, the project root is the root of the workspace, and
+// the member is recorded in the WorkspaceMemberPath.
+// Does not overwrite a given lockPath or specPath.
+func newWorkspacePaths(dir string, lockPathCandidate string, specPathCandidate string, lockPath string, specPath string) (*ProjectPaths, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	workspaceRoot, err := findWorkspaceRoot(absDir)
+	if err != nil {
+		return nil, err
+	}
+	memberPath := ""
+	if workspaceRoot != "" {
+		memberPath = absDir
+		dir = workspaceRoot
+		lockPathCandidate = lockPathForDir(dir)
+		specPathCandidate = pkgPathForDir(dir)
+	}
+
 	if lockPath == "" {
 		lockPath = lockPathCandidate
 	}
@@ -883,12 +1074,27 @@ func NewProjectPaths(projectRoot string, lockPath string, specPath string) (*Pro
 		specPath = specPathCandidate
 	}
 	return &ProjectPaths{
-		ProjectRootPath: dir,
-		LockFile:        lockPath,
-		SpecFile:        specPath,
+		ProjectRootPath:     dir,
+		LockFile:            lockPath,
+		SpecFile:            specPath,
+		WorkspaceMemberPath: memberPath,
 	}, nil
 }
 
+// SortByRelevance sorts the descriptions by how well they match the query.
+// The best match comes first. Descriptions that match equally well keep
+// their relative order.
+func (descs DescRegistries) SortByRelevance(query *SearchQuery) {
+	scores := map[*Desc]int{}
+	for _, descReg := range descs {
+		m, _ := query.match(descReg.Desc)
+		scores[descReg.Desc] = m.score
+	}
+	sort.SliceStable(descs, func(p, q int) bool {
+		return scores[descs[p].Desc] > scores[descs[q].Desc]
+	})
+}
+
 // WithoutLowerVersions discards descriptions of packages where a higher
 // version exists.
 // If a constraint is given, then descriptions are first filtered out according to
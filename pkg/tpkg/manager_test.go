@@ -16,6 +16,7 @@
 package tpkg
 
 import (
+	"context"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -87,3 +88,70 @@ func Test_DescForURL(t *testing.T) {
 		assert.Equal(t, 0, len(found))
 	})
 }
+
+func Test_ReportDeprecations(t *testing.T) {
+	old := mkPkg("old-1.0.0")
+	old.Yanked = "Corrupts data"
+	oldNewest := mkPkg("old-1.1.0")
+	oldNewest.Deprecated = &DescDeprecation{Message: "No longer maintained", Replacement: "github.com/foo/new"}
+	other := mkPkg("other-2.0.0")
+	other.Deprecated = &DescDeprecation{Message: "Merged into core"}
+	fine := mkPkg("fine-1.0.0")
+
+	ui := testUI{}
+	m := ProjectPkgManager{
+		Manager: &Manager{
+			registries: makeRegistries(old, oldNewest, other, fine),
+			ui:         &ui,
+		},
+	}
+	m.reportDeprecations(&LockFile{
+		Packages: map[string]PackageEntry{
+			"old":   {URL: "old", Version: "1.0.0"},
+			"other": {URL: "other", Version: "2.0.0"},
+			"fine":  {URL: "fine", Version: "1.0.0"},
+			"local": {Path: "../local"},
+		},
+	})
+	assert.Equal(t, []string{
+		"Warning: Package 'old' version 1.0.0 has been yanked: Corrupts data",
+		"Warning: Package 'old' is deprecated: No longer maintained. Use 'github.com/foo/new' instead",
+		"Warning: Package 'other' is deprecated: Merged into core",
+	}, ui.messages)
+}
+
+func Test_ProjectTargets(t *testing.T) {
+	assert.Equal(t, []string{"esp32", "host"}, projectTargets([]string{"host", "ESP32", "esp32*", "esp32c?", "esp32"}))
+	assert.Empty(t, projectTargets(nil))
+
+	b := mkPkg("b-1.0.0")
+	b.Environment.Targets = []string{"esp32"}
+	spec := &Spec{
+		Deps: DependencyMap{
+			"b": {URL: "b", Version: "^1.0.0"},
+		},
+		Environment: SpecEnvironment{
+			// The pattern only describes what the project supports.
+			Targets: []string{"esp32*"},
+		},
+	}
+	ui := testUI{}
+	m := ProjectPkgManager{
+		Manager: &Manager{
+			registries: makeRegistries(b),
+			ui:         &ui,
+		},
+	}
+	solution, err := m.findSolutionFromSpec(context.Background(), spec, nil)
+	require.NoError(t, err)
+	checkSolution(t, solution, b)
+	assert.Empty(t, ui.messages)
+
+	spec.Environment.Targets = []string{"esp32*", "host"}
+	_, err = m.findSolutionFromSpec(context.Background(), spec, nil)
+	assert.True(t, IsErrAlreadyReported(err))
+	assert.Equal(t, []string{
+		"Warning: No version of 'b' satisfies constraint '>=1.0.0,<2.0.0' for target 'host'",
+		"Error: Couldn't find a valid solution for the package constraints",
+	}, ui.messages)
+}
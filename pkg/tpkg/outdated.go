@@ -0,0 +1,123 @@
+// Copyright (C) 2021 Toitware ApS.
+//
+// This library is free software; you can redistribute it and/or
+// modify it under the terms of the GNU Lesser General Public
+// License as published by the Free Software Foundation; version
+// 2.1 only.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Lesser General Public License for more details.
+//
+// The license can be found in the file `LICENSE` in the top level
+// directory of this repository.
+
+package tpkg
+
+import (
+	"sort"
+
+	"github.com/hashicorp/go-version"
+)
+
+// OutdatedPackage is a package of the lock file compared to the versions in
+// the registries.
+type OutdatedPackage struct {
+	URL string `json:"url"`
+	// The locked version.
+	Version string `json:"version"`
+	// The newest version in the registries, if it is newer than the locked
+	// version. Yanked versions and prereleases are ignored.
+	Latest string `json:"latest,omitempty"`
+	// Why the locked version was yanked. Empty if it wasn't.
+	Yanked string `json:"yanked,omitempty"`
+	// The deprecation of the locked version, or of the newest version.
+	Deprecated *DescDeprecation `json:"deprecated,omitempty"`
+}
+
+// IsOutdated returns whether a newer version than the locked one exists, or
+// whether the locked version is yanked or deprecated.
+func (p OutdatedPackage) IsOutdated() bool {
+	return p.Latest != "" || p.Yanked != "" || p.Deprecated != nil
+}
+
+// lockedPackageStatuses compares the registry packages of the lock file with
+// the registries. Local and git-ref packages, as well as packages that aren't
+// in any registry, are skipped.
+// The result is sorted by package id.
+func (m *ProjectPkgManager) lockedPackageStatuses(lf *LockFile) []OutdatedPackage {
+	ids := make([]string, 0, len(lf.Packages))
+	for id := range lf.Packages {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	result := []OutdatedPackage{}
+	for _, id := range ids {
+		pe := lf.Packages[id]
+		if pe.Path != "" || pe.Ref != "" || pe.URL == "" {
+			continue
+		}
+		url := pe.URL.URL()
+		found, err := m.registries.SearchURL(url)
+		if err != nil || len(found) == 0 {
+			continue
+		}
+		status := OutdatedPackage{
+			URL:     url,
+			Version: pe.Version,
+		}
+		lockedVersion, err := version.NewVersion(pe.Version)
+		if err != nil {
+			continue
+		}
+		var newest *Desc
+		var newestVersion *version.Version
+		latestVersion := lockedVersion
+		for _, descReg := range found {
+			desc := descReg.Desc
+			if desc.Version == pe.Version {
+				status.Yanked = desc.Yanked
+				status.Deprecated = desc.Deprecated
+			}
+			v, err := version.NewVersion(desc.Version)
+			if err != nil {
+				continue
+			}
+			if newestVersion == nil || v.GreaterThan(newestVersion) {
+				newest = desc
+				newestVersion = v
+			}
+			if desc.Yanked == "" && v.Prerelease() == "" && v.GreaterThan(latestVersion) {
+				latestVersion = v
+				status.Latest = desc.Version
+			}
+		}
+		if status.Deprecated == nil && newest != nil {
+			status.Deprecated = newest.Deprecated
+		}
+		result = append(result, status)
+	}
+	return result
+}
+
+// Outdated returns the packages of the lock file that have a newer version in
+// the registries, or that are deprecated or yanked.
+// Deprecated and yanked packages are also reported as warnings.
+func (m *ProjectPkgManager) Outdated() ([]OutdatedPackage, error) {
+	_, lf, err := m.readSpecAndLock()
+	if err != nil {
+		return nil, err
+	}
+	if lf == nil {
+		return nil, m.ui.ReportError("Missing lock file '%s'. Run 'toit pkg install' first", m.Paths.LockFile)
+	}
+	m.reportDeprecations(lf)
+	result := []OutdatedPackage{}
+	for _, status := range m.lockedPackageStatuses(lf) {
+		if status.IsOutdated() {
+			result = append(result, status)
+		}
+	}
+	return result, nil
+}
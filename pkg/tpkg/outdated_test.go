@@ -0,0 +1,98 @@
+// Copyright (C) 2021 Toitware ApS.
+//
+// This library is free software; you can redistribute it and/or
+// modify it under the terms of the GNU Lesser General Public
+// License as published by the Free Software Foundation; version
+// 2.1 only.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Lesser General Public License for more details.
+//
+// The license can be found in the file `LICENSE` in the top level
+// directory of this repository.
+
+package tpkg
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Outdated(t *testing.T) {
+	current := mkPkg("current-1.0.0")
+	old100 := mkPkg("old-1.0.0")
+	old110 := mkPkg("old-1.1.0")
+	old120 := mkPkg("old-1.2.0")
+	old120.Yanked = "Broken"
+	old200 := mkPkg("old-2.0.0")
+	old200.Version = "2.0.0-beta.1"
+	deprecated := mkPkg("deprecated-1.0.0")
+	deprecated.Deprecated = &DescDeprecation{Message: "Merged into core"}
+	registries := makeRegistries(current, old100, old110, old120, old200, deprecated)
+
+	dir := t.TempDir()
+	writeLintFiles(t, dir, map[string]string{
+		DefaultSpecName: "name: app\n",
+		DefaultLockFileName: `packages:
+  current:
+    url: current
+    version: 1.0.0
+  deprecated:
+    url: deprecated
+    version: 1.0.0
+  local:
+    path: ../local
+  old:
+    url: old
+    version: 1.0.0
+  unknown:
+    url: unknown
+    version: 1.0.0
+`,
+	})
+	ui := testUI{}
+	m := ProjectPkgManager{
+		Manager: &Manager{
+			registries: registries,
+			ui:         &ui,
+		},
+		Paths: &ProjectPaths{
+			ProjectRootPath: dir,
+			LockFile:        filepath.Join(dir, DefaultLockFileName),
+			SpecFile:        filepath.Join(dir, DefaultSpecName),
+		},
+	}
+	outdated, err := m.Outdated()
+	require.NoError(t, err)
+	assert.Equal(t, []OutdatedPackage{
+		{URL: "deprecated", Version: "1.0.0", Deprecated: deprecated.Deprecated},
+		{URL: "old", Version: "1.0.0", Latest: "1.1.0"},
+	}, outdated)
+	assert.Equal(t, []string{
+		"Warning: Package 'deprecated' is deprecated: Merged into core",
+	}, ui.messages)
+
+	t.Run("Missing lock file", func(t *testing.T) {
+		dir := t.TempDir()
+		writeLintFiles(t, dir, map[string]string{
+			DefaultSpecName: "name: app\n",
+		})
+		ui := testUI{}
+		m.ui = &ui
+		m.Paths = &ProjectPaths{
+			ProjectRootPath: dir,
+			LockFile:        filepath.Join(dir, DefaultLockFileName),
+			SpecFile:        filepath.Join(dir, DefaultSpecName),
+		}
+		_, err := m.Outdated()
+		assert.True(t, IsErrAlreadyReported(err))
+		assert.Equal(t, []string{
+			"Error: Missing lock file '" + m.Paths.LockFile + "'. Run 'toit pkg install' first",
+		}, ui.messages)
+	})
+}
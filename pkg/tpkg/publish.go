@@ -0,0 +1,169 @@
+// Copyright (C) 2021 Toitware ApS.
+//
+// This library is free software; you can redistribute it and/or
+// modify it under the terms of the GNU Lesser General Public
+// License as published by the Free Software Foundation; version
+// 2.1 only.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Lesser General Public License for more details.
+//
+// The license can be found in the file `LICENSE` in the top level
+// directory of this repository.
+
+package tpkg
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/toitlang/tpkg/pkg/git"
+)
+
+// PublishOptions configures how a package is published.
+type PublishOptions struct {
+	// The URL of the package.
+	URL string
+	// The version of the package. The repository must have a corresponding
+	// tag ('v<version>', or '<name>-v<version>' for nested packages).
+	Version string
+	// The path to the local checkout of the package. If given, its package file
+	// must describe the same package as the one of the tagged version.
+	ProjectPath string
+	// The path to the local checkout of the registry.
+	RegistryPath string
+	// The branch of the registry the description is committed to. If empty,
+	// the description is committed to the checked out branch.
+	Branch    string
+	IsVerbose bool
+}
+
+// PublishResult describes the outcome of a publication.
+type PublishResult struct {
+	Desc *Desc
+	// The path of the description file in the registry.
+	Path string
+	// The hash of the registry commit. Empty if the registry isn't a git
+	// repository, or if the description was already published.
+	Commit string
+	// The branch the registry checkout was switched to. Empty if no branch
+	// was requested.
+	// The checkout stays on this branch after the publication.
+	Branch string
+	// Whether the same description was already in the registry.
+	AlreadyPublished bool
+}
+
+// Publish adds the description of the given package version to a local
+// registry checkout.
+// The description is scraped from the tagged version of the package. If the
+// registry is a git repository, the description is committed, so it can be
+// pushed, or used for a pull request.
+// Publishing a version again is only allowed if the description doesn't change.
+func Publish(ctx context.Context, o PublishOptions, ui UI) (*PublishResult, error) {
+	stat, err := os.Stat(o.RegistryPath)
+	if err != nil || !stat.IsDir() {
+		return nil, ui.ReportError("Registry path '%s' is not a directory", o.RegistryPath)
+	}
+	isGitRegistry := git.IsRepository(o.RegistryPath)
+	if o.Branch != "" && !isGitRegistry {
+		return nil, ui.ReportError("Registry '%s' is not a git repository", o.RegistryPath)
+	}
+
+	v := o.Version
+	if !strings.HasPrefix(v, "v") {
+		v = "v" + v
+	}
+	desc, err := ScrapeDescriptionGit(ctx, o.URL, v, DisallowLocalDeps, o.IsVerbose, ui)
+	if err != nil {
+		return nil, err
+	}
+	descBytes, err := descYAML(desc)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.ProjectPath != "" {
+		// Warnings were already reported for the tagged version.
+		local, err := ScrapeDescriptionAt(o.ProjectPath, DisallowLocalDeps, false, nullUI{})
+		if err != nil {
+			return nil, ui.ReportError("Failed to describe the package at '%s'. Use 'pkg describe' for details", o.ProjectPath)
+		}
+		local.URL = desc.URL
+		local.Version = desc.Version
+		local.Hash = desc.Hash
+		localBytes, err := descYAML(local)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(descBytes, localBytes) {
+			return nil, ui.ReportError("The package file of '%s' doesn't match the one of tag '%s'. Commit and tag the changes first", o.ProjectPath, v)
+		}
+	}
+
+	result := &PublishResult{
+		Desc: desc,
+		Path: filepath.Join(o.RegistryPath, desc.PackageDir(), DescriptionFileName),
+	}
+	if isGitRegistry && o.Branch != "" {
+		previous, err := git.CheckoutBranch(o.RegistryPath, o.Branch)
+		if err != nil {
+			return nil, ui.ReportError("Failed to check out branch '%s' in registry '%s': %v", o.Branch, o.RegistryPath, err)
+		}
+		if previous != o.Branch {
+			ui.ReportInfo("Switched registry '%s' to branch '%s'", o.RegistryPath, o.Branch)
+		}
+		result.Branch = o.Branch
+	}
+
+	existingBytes, err := os.ReadFile(result.Path)
+	if err == nil {
+		existing := &Desc{path: result.Path}
+		if err := existing.Parse(existingBytes, ui); err != nil {
+			return nil, err
+		}
+		existingYAML, err := descYAML(existing)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(existingYAML, descBytes) {
+			return nil, ui.ReportError("Registry already has a different description for '%s' version %s: '%s'", desc.URL, desc.Version, result.Path)
+		}
+		result.AlreadyPublished = true
+		return result, nil
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if _, err := desc.WriteInDir(o.RegistryPath); err != nil {
+		return nil, err
+	}
+	if !isGitRegistry {
+		return result, nil
+	}
+	rel, err := filepath.Rel(o.RegistryPath, result.Path)
+	if err != nil {
+		return nil, err
+	}
+	message := fmt.Sprintf("Publish %s %s", desc.Name, desc.Version)
+	result.Commit, err = git.Commit(o.RegistryPath, []string{rel}, message)
+	if err != nil {
+		return nil, ui.ReportError("Failed to commit '%s' to registry '%s': %v", rel, o.RegistryPath, err)
+	}
+	return result, nil
+}
+
+// descYAML returns the YAML encoding of the description.
+func descYAML(desc *Desc) ([]byte, error) {
+	buffer := bytes.Buffer{}
+	if err := desc.WriteYAML(&buffer); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
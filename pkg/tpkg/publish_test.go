@@ -0,0 +1,183 @@
+// Copyright (C) 2021 Toitware ApS.
+//
+// This library is free software; you can redistribute it and/or
+// modify it under the terms of the GNU Lesser General Public
+// License as published by the Free Software Foundation; version
+// 2.1 only.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Lesser General Public License for more details.
+//
+// The license can be found in the file `LICENSE` in the top level
+// directory of this repository.
+
+package tpkg
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Publish(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	pkgDir := filepath.Join(dir, "pkg")
+	pkgRepository, err := git.PlainInit(pkgDir, false)
+	require.NoError(t, err)
+	commitFile(t, pkgRepository, pkgDir, "src/morse.toit", "main:\n")
+	spec := "name: morse\ndescription: Morse code.\nlicense: MIT\n"
+	hash := commitFile(t, pkgRepository, pkgDir, DefaultSpecName, spec)
+	_, err = pkgRepository.CreateTag("v1.0.0", plumbing.NewHash(hash), nil)
+	require.NoError(t, err)
+	url := TestGitPathHost + "/" + filepath.ToSlash(pkgDir)
+
+	registryDir := filepath.Join(dir, "registry")
+	registryRepository, err := git.PlainInit(registryDir, false)
+	require.NoError(t, err)
+	cfg, err := registryRepository.Config()
+	require.NoError(t, err)
+	cfg.User.Name = "Test Committer"
+	cfg.User.Email = "not_used@example.com"
+	require.NoError(t, registryRepository.SetConfig(cfg))
+	commitFile(t, registryRepository, registryDir, "README.md", "Registry\n")
+
+	options := PublishOptions{
+		URL:          url,
+		Version:      "1.0.0",
+		ProjectPath:  pkgDir,
+		RegistryPath: registryDir,
+	}
+
+	t.Run("Commit", func(t *testing.T) {
+		ui := testUI{}
+		result, err := Publish(ctx, options, &ui)
+		require.NoError(t, err)
+		assert.Empty(t, ui.messages)
+		assert.False(t, result.AlreadyPublished)
+		assert.NotEmpty(t, result.Commit)
+		assert.Equal(t, "morse", result.Desc.Name)
+		assert.Equal(t, hash, result.Desc.Hash)
+
+		published := Desc{}
+		require.NoError(t, published.ParseFile(result.Path, &ui))
+		assert.Equal(t, url, published.URL)
+		assert.Equal(t, "1.0.0", published.Version)
+
+		head, err := registryRepository.Head()
+		require.NoError(t, err)
+		assert.Equal(t, result.Commit, head.Hash().String())
+		wt, err := registryRepository.Worktree()
+		require.NoError(t, err)
+		status, err := wt.Status()
+		require.NoError(t, err)
+		assert.True(t, status.IsClean())
+	})
+
+	t.Run("Again", func(t *testing.T) {
+		ui := testUI{}
+		result, err := Publish(ctx, options, &ui)
+		require.NoError(t, err)
+		assert.True(t, result.AlreadyPublished)
+		assert.Empty(t, result.Commit)
+	})
+
+	t.Run("Different", func(t *testing.T) {
+		ui := testUI{}
+		result, err := Publish(ctx, options, &ui)
+		require.NoError(t, err)
+		different := "name: morse\ndescription: Old.\nurl: " + url + "\nversion: 1.0.0\n"
+		require.NoError(t, os.WriteFile(result.Path, []byte(different), 0644))
+
+		ui = testUI{}
+		_, err = Publish(ctx, options, &ui)
+		assert.True(t, IsErrAlreadyReported(err))
+		assert.Equal(t, []string{
+			"Error: Registry already has a different description for '" + url + "' version 1.0.0: '" + result.Path + "'",
+		}, ui.messages)
+	})
+
+	t.Run("Branch", func(t *testing.T) {
+		tagHash := commitFile(t, pkgRepository, pkgDir, "src/morse.toit", "main:\n  print 1\n")
+		_, err = pkgRepository.CreateTag("v1.1.0", plumbing.NewHash(tagHash), nil)
+		require.NoError(t, err)
+
+		branchOptions := options
+		branchOptions.Version = "v1.1.0"
+		branchOptions.Branch = "morse-1.1.0"
+		ui := testUI{}
+		result, err := Publish(ctx, branchOptions, &ui)
+		require.NoError(t, err)
+		head, err := registryRepository.Head()
+		require.NoError(t, err)
+		assert.Equal(t, plumbing.NewBranchReferenceName("morse-1.1.0"), head.Name())
+		assert.Equal(t, result.Commit, head.Hash().String())
+		assert.Equal(t, "morse-1.1.0", result.Branch)
+		assert.Contains(t, ui.messages, "Info: Switched registry '"+registryDir+"' to branch 'morse-1.1.0'")
+
+		// Publishing again on the same branch doesn't report a switch.
+		ui = testUI{}
+		result, err = Publish(ctx, branchOptions, &ui)
+		require.NoError(t, err)
+		assert.True(t, result.AlreadyPublished)
+		assert.Equal(t, "morse-1.1.0", result.Branch)
+		assert.Empty(t, ui.messages)
+	})
+
+	t.Run("Short Version", func(t *testing.T) {
+		shortSpec := spec + "version: \"1.2\"\n"
+		tagHash := commitFile(t, pkgRepository, pkgDir, DefaultSpecName, shortSpec)
+		_, err = pkgRepository.CreateTag("v1.2.0", plumbing.NewHash(tagHash), nil)
+		require.NoError(t, err)
+		_, err = pkgRepository.CreateTag("v1.3.0", plumbing.NewHash(tagHash), nil)
+		require.NoError(t, err)
+
+		shortOptions := options
+		shortOptions.Version = "v1.2.0"
+		ui := testUI{}
+		result, err := Publish(ctx, shortOptions, &ui)
+		require.NoError(t, err)
+		assert.Equal(t, "1.2.0", result.Desc.Version)
+
+		shortOptions.Version = "v1.3.0"
+		ui = testUI{}
+		_, err = Publish(ctx, shortOptions, &ui)
+		assert.True(t, IsErrAlreadyReported(err))
+		assert.Equal(t, []string{
+			"Error: Version in '" + DefaultSpecName + "' is '1.2', but the tag is for version '1.3.0'",
+		}, ui.messages)
+
+		// Restore the package file of the other tests.
+		commitFile(t, pkgRepository, pkgDir, DefaultSpecName, spec)
+	})
+
+	t.Run("Mismatch", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(filepath.Join(pkgDir, DefaultSpecName), []byte(spec+"keywords: [morse]\n"), 0644))
+		ui := testUI{}
+		_, err := Publish(ctx, options, &ui)
+		assert.True(t, IsErrAlreadyReported(err))
+		assert.Equal(t, []string{
+			"Error: The package file of '" + pkgDir + "' doesn't match the one of tag 'v1.0.0'. Commit and tag the changes first",
+		}, ui.messages)
+	})
+
+	t.Run("Missing tag", func(t *testing.T) {
+		missingOptions := options
+		missingOptions.Version = "2.0.0"
+		missingOptions.ProjectPath = ""
+		ui := testUI{}
+		_, err := Publish(ctx, missingOptions, &ui)
+		require.Error(t, err)
+		var downloadErr *DownloadError
+		assert.ErrorAs(t, err, &downloadErr)
+	})
+}
@@ -54,7 +54,7 @@ type Registry interface {
 	MatchName(name string) ([]*Desc, error)
 	// Searches for needle.
 	// The search uses all description information (including description, authors, ...)
-	// to find the package.
+	// to find the package. The needle may use the syntax of SearchQuery.
 	SearchAll(needle string) ([]*Desc, error)
 	// Searches for a package with the given URL and version.
 	SearchURLVersion(url string, version string) ([]*Desc, error)
@@ -71,9 +71,9 @@ type Registry interface {
 // RegistryConfig can be used to load a registry with
 // LoadRegistry or LoadRegistries.
 type RegistryConfig struct {
-	Name string       `yaml:"name"`
-	Kind RegistryKind `yaml:"kind"`
-	Path string       `yaml:"path"`
+	Name string       `yaml:"name" json:"name"`
+	Kind RegistryKind `yaml:"kind" json:"kind"`
+	Path string       `yaml:"path" json:"path"`
 }
 
 type RegistryConfigs []RegistryConfig
@@ -172,7 +172,26 @@ var blocklist = []glob.Glob{
 
 func (p *pathRegistry) Load(_ context.Context, sync bool, _ Cache, ui UI) error {
 	entries := []*Desc{}
-	err := filepath.Walk(p.path, func(path string, info os.FileInfo, err error) error {
+	err := walkDescriptionFiles(p.path, func(path string, rel string) error {
+		var entry Desc
+		if err := entry.ParseFile(path, ui); err != nil {
+			return err
+		}
+		entries = append(entries, &entry)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	p.entries = entries
+	return nil
+}
+
+// walkDescriptionFiles calls the given function for each description file in
+// the registry at the given root.
+// Hidden and blocklisted files and directories are skipped.
+func walkDescriptionFiles(root string, f func(path string, rel string) error) error {
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
@@ -185,7 +204,7 @@ func (p *pathRegistry) Load(_ context.Context, sync bool, _ Cache, ui UI) error
 			return nil
 		}
 
-		rel, err := filepath.Rel(p.path, path)
+		rel, err := filepath.Rel(root, path)
 		if err != nil {
 			return err
 		}
@@ -212,19 +231,8 @@ func (p *pathRegistry) Load(_ context.Context, sync bool, _ Cache, ui UI) error
 		if e != ".yaml" && e != ".yml" {
 			return nil
 		}
-
-		var entry Desc
-		if err = entry.ParseFile(path, ui); err != nil {
-			return err
-		}
-		entries = append(entries, &entry)
-		return nil
+		return f(path, rel)
 	})
-	if err != nil {
-		return err
-	}
-	p.entries = entries
-	return nil
 }
 
 func (p *pathRegistry) ClearCache(ctx context.Context, cache Cache, ui UI) error {
@@ -287,13 +295,11 @@ func (p *pathRegistry) MatchName(name string) ([]*Desc, error) {
 }
 
 func (p *pathRegistry) SearchAll(needle string) ([]*Desc, error) {
-	result := []*Desc{}
-	for _, entry := range p.entries {
-		if searchName(needle, entry) || searchDescription(needle, entry) || searchURL(needle, entry) {
-			result = append(result, entry)
-		}
+	query, err := parseSearchQuery(needle)
+	if err != nil {
+		return nil, err
 	}
-	return result, nil
+	return query.filter(p.entries), nil
 }
 
 func (p *pathRegistry) SearchURLVersion(url string, version string) ([]*Desc, error) {
@@ -492,11 +498,38 @@ func (registries Registries) MatchName(name string) (DescRegistries, error) {
 	})
 }
 
-// SearchAll searches for the given needle in the names and descriptions of all registries.
+// SearchAll searches for the given query in all registries.
+// See SearchQuery for the syntax of the query.
+// The result is sorted by relevance. See SortByRelevance.
 func (registries Registries) SearchAll(needle string) (DescRegistries, error) {
-	return registries.searchInRegistries(func(registry Registry) ([]*Desc, error) {
+	query, err := parseSearchQuery(needle)
+	if err != nil {
+		return nil, err
+	}
+	found, err := registries.searchInRegistries(func(registry Registry) ([]*Desc, error) {
 		return registry.SearchAll(needle)
 	})
+	if err != nil {
+		return nil, err
+	}
+	// Each registry only returns typo matches if it doesn't have any other
+	// match. Do the same across registries.
+	descs := []*Desc{}
+	for _, descReg := range found {
+		descs = append(descs, descReg.Desc)
+	}
+	remaining := map[*Desc]bool{}
+	for _, desc := range query.filter(descs) {
+		remaining[desc] = true
+	}
+	result := DescRegistries{}
+	for _, descReg := range found {
+		if remaining[descReg.Desc] {
+			result = append(result, descReg)
+		}
+	}
+	result.SortByRelevance(query)
+	return result, nil
 }
 
 // SearchURLVersion searches for the package with the given url and version in all registries.
@@ -0,0 +1,173 @@
+// Copyright (C) 2021 Toitware ApS.
+//
+// This library is free software; you can redistribute it and/or
+// modify it under the terms of the GNU Lesser General Public
+// License as published by the Free Software Foundation; version
+// 2.1 only.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Lesser General Public License for more details.
+//
+// The license can be found in the file `LICENSE` in the top level
+// directory of this repository.
+
+package tpkg
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/go-version"
+)
+
+// RegistryCheckOptions configures the checks of CheckRegistry.
+type RegistryCheckOptions struct {
+	// Whether to run the solver for every package version, to find versions
+	// that can't be installed.
+	Solve bool
+}
+
+// CheckRegistry validates the registry at the given path.
+// In addition to the validation of each description, it checks that
+//   - descriptions are at the location that corresponds to their URL and
+//     version,
+//   - there aren't two descriptions for the same URL and version, and
+//   - the dependencies can be satisfied by packages of the registry.
+//
+// Returns an error if the registry can't be read at all.
+// The diagnostics are sorted by severity (errors first). Their paths are
+// relative to the registry.
+func CheckRegistry(path string, o RegistryCheckOptions, ui UI) ([]LintDiagnostic, error) {
+	if isDir, err := isDirectory(path); err != nil || !isDir {
+		return nil, ui.ReportError("Registry path '%s' is not a directory", path)
+	}
+
+	diagnostics := lintDiagnostics{}
+	report := diagnostics.report
+
+	entries := []*Desc{}
+	// From the description to its path relative to the registry.
+	rels := map[*Desc]string{}
+	// From url@version to the first description with that id.
+	ids := map[string]string{}
+	err := walkDescriptionFiles(path, func(p string, rel string) error {
+		rel = filepath.ToSlash(rel)
+		descUI := &diagnosticUI{
+			report: func(severity LintSeverity, msg string) {
+				report(severity, "description", rel, "%s", msg)
+			},
+		}
+		desc := &Desc{}
+		if err := desc.ParseFile(p, descUI); err != nil {
+			if !IsErrAlreadyReported(err) {
+				report(LintError, "description", rel, "%v", err)
+			}
+			return nil
+		}
+		desc.reportUnknownFields(descUI, true)
+		expected := filepath.ToSlash(filepath.Join(desc.PackageDir(), DescriptionFileName))
+		if rel != expected {
+			report(LintError, "location", rel, "Description of '%s' version %s must be at '%s'", desc.URL, desc.Version, expected)
+		}
+		id := desc.URL + "@" + desc.Version
+		if first, ok := ids[id]; ok {
+			report(LintError, "duplicate", rel, "Duplicate description of '%s' version %s (also in '%s')", desc.URL, desc.Version, first)
+			return nil
+		}
+		ids[id] = rel
+		entries = append(entries, desc)
+		rels[desc] = rel
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].IDCompare(entries[j]) < 0
+	})
+
+	versions := map[string][]*version.Version{}
+	for _, desc := range entries {
+		v, err := version.NewVersion(desc.Version)
+		if err != nil {
+			continue
+		}
+		versions[desc.URL] = append(versions[desc.URL], v)
+	}
+	for _, desc := range entries {
+		for _, dep := range desc.Deps {
+			available, ok := versions[dep.URL]
+			if !ok {
+				report(LintError, "dependency", rels[desc], "Dependency '%s' of '%s' version %s is not in the registry", dep.URL, desc.URL, desc.Version)
+				continue
+			}
+			constraint, err := parseConstraint(dep.Version)
+			if err != nil {
+				// Already reported by the validation of the description.
+				continue
+			}
+			satisfied := false
+			for _, v := range available {
+				if constraint.Check(v) {
+					satisfied = true
+					break
+				}
+			}
+			if !satisfied {
+				report(LintError, "dependency", rels[desc], "No version of dependency '%s' of '%s' version %s satisfies constraint '%s'", dep.URL, desc.URL, desc.Version, dep.Version)
+			}
+		}
+	}
+
+	if o.Solve {
+		registry := &pathRegistry{
+			path:    path,
+			entries: entries,
+		}
+		solver, err := NewSolver(Registries{registry}, nil, nullUI{})
+		if err != nil {
+			return nil, err
+		}
+		for _, desc := range entries {
+			if desc.Yanked != "" {
+				continue
+			}
+			dep, err := NewSolverDep(desc.URL, "="+desc.Version)
+			if err != nil {
+				continue
+			}
+			solver.reset()
+			sdk, err := parseSDKConstraint(desc.Environment.SDK)
+			if err != nil {
+				continue
+			}
+			if solver.Solve(sdk, []SolverDep{dep}) == nil {
+				report(LintError, "solve", rels[desc], "'%s' version %s can't be installed: %s", desc.URL, desc.Version, strings.Join(solver.Conflicts(), "; "))
+			}
+		}
+	}
+
+	return diagnostics.sorted(), nil
+}
+
+// diagnosticUI is a UI that turns errors and warnings into diagnostics.
+type diagnosticUI struct {
+	report func(severity LintSeverity, msg string)
+}
+
+func (ui *diagnosticUI) ReportError(format string, a ...interface{}) error {
+	ui.report(LintError, fmt.Sprintf(format, a...))
+	return ErrAlreadyReported
+}
+
+func (ui *diagnosticUI) ReportWarning(format string, a ...interface{}) {
+	ui.report(LintWarning, fmt.Sprintf(format, a...))
+}
+
+func (ui *diagnosticUI) ReportInfo(format string, a ...interface{}) {
+}
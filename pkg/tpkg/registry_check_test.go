@@ -0,0 +1,97 @@
+// Copyright (C) 2021 Toitware ApS.
+//
+// This library is free software; you can redistribute it and/or
+// modify it under the terms of the GNU Lesser General Public
+// License as published by the Free Software Foundation; version
+// 2.1 only.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Lesser General Public License for more details.
+//
+// The license can be found in the file `LICENSE` in the top level
+// directory of this repository.
+
+package tpkg
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_CheckRegistry(t *testing.T) {
+	writeDescs := func(t *testing.T, dir string, descs ...*Desc) {
+		for _, desc := range descs {
+			_, err := desc.WriteInDir(dir)
+			require.NoError(t, err)
+		}
+	}
+
+	t.Run("Valid", func(t *testing.T) {
+		dir := t.TempDir()
+		writeDescs(t, dir, mkPkg("a-1.0.0", "b ^1.0.0"), mkPkg("b-1.0.0"), mkPkg("b-1.2.0"))
+		diagnostics, err := CheckRegistry(dir, RegistryCheckOptions{Solve: true}, &testUI{})
+		require.NoError(t, err)
+		assert.Empty(t, diagnostics)
+	})
+
+	t.Run("Problems", func(t *testing.T) {
+		dir := t.TempDir()
+		a := mkPkg("a-1.0.0", "b ^2.0.0", "missing ^1.0.0")
+		writeDescs(t, dir, a, mkPkg("b-1.0.0"))
+
+		// A description at the wrong location.
+		b := mkPkg("b-1.1.0")
+		b.path = filepath.Join(dir, "misplaced.yaml")
+		require.NoError(t, b.WriteToFile())
+		// A duplicate.
+		duplicate := mkPkg("b-1.0.0")
+		duplicate.Description = "Duplicate."
+		duplicate.path = filepath.Join(dir, "zz-duplicate.yaml")
+		require.NoError(t, duplicate.WriteToFile())
+		// An invalid description.
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "invalid.yaml"), []byte("name: invalid\n"), 0644))
+		// A description with an unknown field.
+		c := mkPkg("c-1.0.0")
+		c.Extra = map[string]interface{}{"mirror": "github.com/other/c"}
+		writeDescs(t, dir, c)
+		cPath := "packages/c/1.0.0/desc.yaml"
+
+		diagnostics, err := CheckRegistry(dir, RegistryCheckOptions{}, &testUI{})
+		require.NoError(t, err)
+		aPath := "packages/a/1.0.0/desc.yaml"
+		assert.Equal(t, []LintDiagnostic{
+			{LintError, "description", "Description 'invalid' is missing a version", "invalid.yaml"},
+			{LintError, "location", "Description of 'b' version 1.1.0 must be at 'packages/b/1.1.0/desc.yaml'", "misplaced.yaml"},
+			{LintError, "location", "Description of 'b' version 1.0.0 must be at 'packages/b/1.0.0/desc.yaml'", "zz-duplicate.yaml"},
+			{LintError, "duplicate", "Duplicate description of 'b' version 1.0.0 (also in 'packages/b/1.0.0/desc.yaml')", "zz-duplicate.yaml"},
+			{LintError, "dependency", "No version of dependency 'b' of 'a' version 1.0.0 satisfies constraint '^2.0.0'", aPath},
+			{LintError, "dependency", "Dependency 'missing' of 'a' version 1.0.0 is not in the registry", aPath},
+			{LintWarning, "description", "Unknown field 'mirror' in '" + filepath.Join(dir, cPath) + "'", cPath},
+		}, diagnostics)
+	})
+
+	t.Run("Solve", func(t *testing.T) {
+		dir := t.TempDir()
+		writeDescs(t, dir,
+			mkPkg("a-1.0.0", "b ^1.1.0", "c ^1.0.0"),
+			mkPkg("c-1.0.0", "b <1.1.0"),
+			mkPkg("b-1.0.0"),
+			mkPkg("b-1.1.0"))
+		diagnostics, err := CheckRegistry(dir, RegistryCheckOptions{}, &testUI{})
+		require.NoError(t, err)
+		assert.Empty(t, diagnostics)
+
+		diagnostics, err = CheckRegistry(dir, RegistryCheckOptions{Solve: true}, &testUI{})
+		require.NoError(t, err)
+		require.Len(t, diagnostics, 1)
+		assert.Equal(t, "solve", diagnostics[0].Check)
+		assert.Equal(t, "packages/a/1.0.0/desc.yaml", diagnostics[0].Path)
+		assert.Contains(t, diagnostics[0].Message, "'a' version 1.0.0 can't be installed")
+	})
+}
@@ -0,0 +1,477 @@
+// Copyright (C) 2021 Toitware ApS.
+//
+// This library is free software; you can redistribute it and/or
+// modify it under the terms of the GNU Lesser General Public
+// License as published by the Free Software Foundation; version
+// 2.1 only.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Lesser General Public License for more details.
+//
+// The license can be found in the file `LICENSE` in the top level
+// directory of this repository.
+
+package tpkg
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SBOMFormat is the format of a software bill of materials.
+type SBOMFormat string
+
+const (
+	// SPDX 2.3, in its JSON serialization.
+	SBOMFormatSPDX SBOMFormat = "spdx-json"
+	// CycloneDX 1.5, in its JSON serialization.
+	SBOMFormatCycloneDX SBOMFormat = "cyclonedx-json"
+)
+
+// SBOMComponent is a package of a software bill of materials.
+type SBOMComponent struct {
+	// The package ID in the lock file. Empty for the project itself.
+	ID      string
+	Name    string
+	Version string
+	URL     string
+	// The git hash of the package. Empty for local packages.
+	Hash string
+	// The SPDX license expression of the package. Empty if unknown.
+	License string
+	// The path of a local package, as given in the lock file.
+	LocalPath string
+	// The package IDs of the dependencies, sorted.
+	Dependencies []string
+}
+
+// IsLocal returns whether the component is a local path package.
+func (c SBOMComponent) IsLocal() bool {
+	return c.LocalPath != ""
+}
+
+// SBOM is a software bill of materials of a project.
+type SBOM struct {
+	// The project itself.
+	Project SBOMComponent
+	// The packages of the lock file, sorted by ID.
+	Components []SBOMComponent
+}
+
+// BuildSBOM builds the software bill of materials of the project from its
+// lock file.
+// Licenses are taken from the registry descriptions. For packages that
+// aren't in any registry, the license is taken from the package file, or
+// guessed from the LICENSE file of the downloaded package.
+func (m *ProjectPkgManager) BuildSBOM() (*SBOM, error) {
+	spec, lf, err := m.readSpecAndLock()
+	if err != nil {
+		return nil, err
+	}
+	if lf == nil {
+		return nil, m.ui.ReportError("Missing lock file '%s'. Run 'toit pkg install' first", m.Paths.LockFile)
+	}
+
+	project := SBOMComponent{
+		Name:         spec.Name,
+		Version:      spec.Version,
+		License:      spec.License,
+		Dependencies: sbomDependencies(lf.Prefixes),
+	}
+	if project.Name == "" {
+		project.Name = filepath.Base(m.Paths.ProjectRootPath)
+	}
+
+	ids := make([]string, 0, len(lf.Packages))
+	for id := range lf.Packages {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	components := make([]SBOMComponent, 0, len(ids))
+	for _, id := range ids {
+		component, err := m.sbomComponent(id, lf.Packages[id])
+		if err != nil {
+			return nil, err
+		}
+		components = append(components, component)
+	}
+	return &SBOM{
+		Project:    project,
+		Components: components,
+	}, nil
+}
+
+func (m *ProjectPkgManager) sbomComponent(id string, pe PackageEntry) (SBOMComponent, error) {
+	component := SBOMComponent{
+		ID:           id,
+		Name:         pe.Name,
+		Version:      pe.Version,
+		Hash:         pe.Hash,
+		Dependencies: sbomDependencies(pe.Prefixes),
+	}
+	var dir string
+	if pe.Path != "" {
+		component.LocalPath = pe.Path.FilePath()
+		dir = component.LocalPath
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(filepath.Dir(m.Paths.LockFile), dir)
+		}
+	} else {
+		component.URL = pe.URL.URL()
+		found, err := m.registries.SearchURLVersion(component.URL, pe.Version)
+		if err != nil {
+			return component, err
+		}
+		for _, descReg := range found {
+			if component.Name == "" {
+				component.Name = descReg.Desc.Name
+			}
+			if component.License == "" {
+				component.License = descReg.Desc.License
+			}
+		}
+		dir, err = m.cache.FindPkg(m.Paths.ProjectRootPath, component.URL, pe.Version)
+		if err != nil {
+			return component, err
+		}
+	}
+
+	if dir != "" && (component.Name == "" || component.License == "") {
+		name, license, err := packageNameAndLicense(dir)
+		if err != nil {
+			return component, err
+		}
+		if component.Name == "" {
+			component.Name = name
+		}
+		if component.License == "" {
+			component.License = license
+		}
+	}
+	if component.Name == "" {
+		if component.URL != "" {
+			component.Name = component.URL[strings.LastIndex(component.URL, "/")+1:]
+		} else {
+			component.Name = filepath.Base(dir)
+		}
+	}
+	return component, nil
+}
+
+// packageNameAndLicense returns the name and the license of the package in
+// the given directory.
+// If the package file doesn't declare a license, guesses it from the LICENSE
+// file.
+func packageNameAndLicense(dir string) (string, string, error) {
+	name := ""
+	license := ""
+	specPath := filepath.Join(dir, DefaultSpecName)
+	if exists, err := isFile(specPath); err != nil {
+		return "", "", err
+	} else if exists {
+		// Errors in the package file aren't relevant for the bill of materials.
+		if spec, err := ReadSpec(specPath, nullUI{}); err == nil {
+			name = spec.Name
+			license = spec.License
+		}
+	}
+	if license == "" {
+		matches, err := detectLicenseFiles(dir)
+		if err != nil {
+			return "", "", err
+		}
+		license = combineLicenseMatches(matches)
+	}
+	return name, license, nil
+}
+
+func sbomDependencies(prefixes PrefixMap) []string {
+	ids := map[string]bool{}
+	for _, id := range prefixes {
+		ids[id] = true
+	}
+	return sortedBoolKeys(ids)
+}
+
+// Write writes the bill of materials in the given format.
+// The creation time is included in the document.
+func (s *SBOM) Write(w io.Writer, format SBOMFormat, created time.Time) error {
+	var doc interface{}
+	switch format {
+	case SBOMFormatSPDX:
+		doc = s.spdx(created)
+	case SBOMFormatCycloneDX:
+		doc = s.cycloneDX(created)
+	default:
+		return fmt.Errorf("unknown SBOM format: '%s'", format)
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(doc)
+}
+
+const sbomToolName = "toit-pkg"
+
+type spdxDocument struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+	Packages          []spdxPackage      `json:"packages"`
+	Relationships     []spdxRelationship `json:"relationships"`
+	// License references that are used by the packages must be declared.
+	ExtractedLicenses []spdxExtractedLicense `json:"hasExtractedLicensingInfos,omitempty"`
+}
+
+type spdxExtractedLicense struct {
+	LicenseID     string `json:"licenseId"`
+	ExtractedText string `json:"extractedText"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	Name             string `json:"name"`
+	SPDXID           string `json:"SPDXID"`
+	VersionInfo      string `json:"versionInfo,omitempty"`
+	DownloadLocation string `json:"downloadLocation"`
+	FilesAnalyzed    bool   `json:"filesAnalyzed"`
+	LicenseConcluded string `json:"licenseConcluded"`
+	LicenseDeclared  string `json:"licenseDeclared"`
+	CopyrightText    string `json:"copyrightText"`
+	Comment          string `json:"comment,omitempty"`
+}
+
+type spdxRelationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+const spdxProjectID = "SPDXRef-Project"
+
+// spdxID converts the given package ID to an SPDX identifier.
+// SPDX identifiers may only contain letters, numbers, '.' and '-'.
+func spdxID(id string) string {
+	return "SPDXRef-Package-" + strings.Map(func(r rune) rune {
+		if ('0' <= r && r <= '9') || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || r == '.' || r == '-' {
+			return r
+		}
+		return '-'
+	}, id)
+}
+
+// spdxLicense returns the normalized license expression, and the license
+// references it uses.
+// Returns "NOASSERTION" if the license is unknown or invalid.
+func spdxLicense(license string) (string, []string) {
+	expression, err := ParseLicenseExpression(license)
+	if err != nil {
+		return "NOASSERTION", nil
+	}
+	refs := []string{}
+	for _, single := range expression.Licenses() {
+		if strings.HasPrefix(single.License, "LicenseRef-") {
+			refs = append(refs, single.License)
+		}
+	}
+	return expression.String(), refs
+}
+
+func (s *SBOM) spdx(created time.Time) *spdxDocument {
+	licenseRefs := map[string]bool{}
+	toPackage := func(c SBOMComponent, id string) spdxPackage {
+		license, refs := spdxLicense(c.License)
+		for _, ref := range refs {
+			licenseRefs[ref] = true
+		}
+		result := spdxPackage{
+			Name:             c.Name,
+			SPDXID:           id,
+			VersionInfo:      c.Version,
+			DownloadLocation: "NOASSERTION",
+			LicenseConcluded: "NOASSERTION",
+			LicenseDeclared:  license,
+			CopyrightText:    "NOASSERTION",
+		}
+		if c.IsLocal() {
+			result.DownloadLocation = "NONE"
+			result.Comment = fmt.Sprintf("Local package at '%s'", filepath.ToSlash(c.LocalPath))
+		} else if c.URL != "" {
+			result.DownloadLocation = "git+https://" + c.URL
+			if c.Hash != "" {
+				result.DownloadLocation += "@" + c.Hash
+			}
+		}
+		return result
+	}
+
+	packages := []spdxPackage{toPackage(s.Project, spdxProjectID)}
+	relationships := []spdxRelationship{
+		{"SPDXRef-DOCUMENT", "DESCRIBES", spdxProjectID},
+	}
+	addDependencies := func(from string, deps []string) {
+		for _, dep := range deps {
+			relationships = append(relationships, spdxRelationship{from, "DEPENDS_ON", spdxID(dep)})
+		}
+	}
+	addDependencies(spdxProjectID, s.Project.Dependencies)
+	for _, c := range s.Components {
+		packages = append(packages, toPackage(c, spdxID(c.ID)))
+		addDependencies(spdxID(c.ID), c.Dependencies)
+	}
+
+	var extracted []spdxExtractedLicense
+	for _, ref := range sortedBoolKeys(licenseRefs) {
+		extracted = append(extracted, spdxExtractedLicense{ref, "NOASSERTION"})
+	}
+
+	timestamp := created.UTC().Format(time.RFC3339)
+	return &spdxDocument{
+		SPDXVersion:       "SPDX-2.3",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              s.Project.Name,
+		DocumentNamespace: "https://spdx.org/spdxdocs/" + s.Project.Name + "-" + s.digest(timestamp),
+		CreationInfo: spdxCreationInfo{
+			Created:  timestamp,
+			Creators: []string{"Tool: " + sbomToolName},
+		},
+		Packages:          packages,
+		Relationships:     relationships,
+		ExtractedLicenses: extracted,
+	}
+}
+
+// digest returns a hash of the bill of materials and the given salt.
+// SPDX documents need a unique namespace. Deriving it from the content keeps
+// the output reproducible.
+func (s *SBOM) digest(salt string) string {
+	encoded, _ := json.Marshal(s)
+	sum := sha256.Sum256(append(encoded, salt...))
+	return hex.EncodeToString(sum[:16])
+}
+
+type cycloneDXDocument struct {
+	BOMFormat    string                `json:"bomFormat"`
+	SpecVersion  string                `json:"specVersion"`
+	Version      int                   `json:"version"`
+	Metadata     cycloneDXMetadata     `json:"metadata"`
+	Components   []cycloneDXComponent  `json:"components"`
+	Dependencies []cycloneDXDependency `json:"dependencies"`
+}
+
+type cycloneDXMetadata struct {
+	Timestamp string             `json:"timestamp"`
+	Tools     cycloneDXTools     `json:"tools"`
+	Component cycloneDXComponent `json:"component"`
+}
+
+type cycloneDXTools struct {
+	Components []cycloneDXComponent `json:"components"`
+}
+
+type cycloneDXComponent struct {
+	Type               string                       `json:"type"`
+	BOMRef             string                       `json:"bom-ref,omitempty"`
+	Name               string                       `json:"name"`
+	Version            string                       `json:"version,omitempty"`
+	Licenses           []cycloneDXLicenseChoice     `json:"licenses,omitempty"`
+	ExternalReferences []cycloneDXExternalReference `json:"externalReferences,omitempty"`
+	Properties         []cycloneDXProperty          `json:"properties,omitempty"`
+}
+
+// cycloneDXLicenseChoice is either a single license or an SPDX expression.
+type cycloneDXLicenseChoice struct {
+	License    *cycloneDXLicense `json:"license,omitempty"`
+	Expression string            `json:"expression,omitempty"`
+}
+
+type cycloneDXLicense struct {
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name,omitempty"`
+}
+
+type cycloneDXExternalReference struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+}
+
+type cycloneDXProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type cycloneDXDependency struct {
+	Ref       string   `json:"ref"`
+	DependsOn []string `json:"dependsOn"`
+}
+
+const cycloneDXProjectRef = "project"
+
+func (s *SBOM) cycloneDX(created time.Time) *cycloneDXDocument {
+	toComponent := func(c SBOMComponent, ref string, componentType string) cycloneDXComponent {
+		result := cycloneDXComponent{
+			Type:    componentType,
+			BOMRef:  ref,
+			Name:    c.Name,
+			Version: c.Version,
+		}
+		if expression, err := ParseLicenseExpression(c.License); err == nil {
+			if expression.IsSingleLicense() {
+				result.Licenses = []cycloneDXLicenseChoice{{License: &cycloneDXLicense{ID: expression.License}}}
+			} else {
+				result.Licenses = []cycloneDXLicenseChoice{{Expression: expression.String()}}
+			}
+		} else if c.License != "" {
+			result.Licenses = []cycloneDXLicenseChoice{{License: &cycloneDXLicense{Name: c.License}}}
+		}
+		if c.URL != "" {
+			result.ExternalReferences = []cycloneDXExternalReference{{"vcs", "https://" + c.URL}}
+		}
+		if c.Hash != "" {
+			result.Properties = append(result.Properties, cycloneDXProperty{"toit:git-hash", c.Hash})
+		}
+		if c.IsLocal() {
+			result.Properties = append(result.Properties, cycloneDXProperty{"toit:local-path", filepath.ToSlash(c.LocalPath)})
+		}
+		return result
+	}
+
+	dependencies := []cycloneDXDependency{
+		{cycloneDXProjectRef, s.Project.Dependencies},
+	}
+	components := []cycloneDXComponent{}
+	for _, c := range s.Components {
+		components = append(components, toComponent(c, c.ID, "library"))
+		dependencies = append(dependencies, cycloneDXDependency{c.ID, c.Dependencies})
+	}
+	return &cycloneDXDocument{
+		BOMFormat:   "CycloneDX",
+		SpecVersion: "1.5",
+		Version:     1,
+		Metadata: cycloneDXMetadata{
+			Timestamp: created.UTC().Format(time.RFC3339),
+			Tools: cycloneDXTools{
+				Components: []cycloneDXComponent{{Type: "application", Name: sbomToolName}},
+			},
+			Component: toComponent(s.Project, cycloneDXProjectRef, "application"),
+		},
+		Components:   components,
+		Dependencies: dependencies,
+	}
+}
@@ -0,0 +1,195 @@
+// Copyright (C) 2021 Toitware ApS.
+//
+// This library is free software; you can redistribute it and/or
+// modify it under the terms of the GNU Lesser General Public
+// License as published by the Free Software Foundation; version
+// 2.1 only.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Lesser General Public License for more details.
+//
+// The license can be found in the file `LICENSE` in the top level
+// directory of this repository.
+
+package tpkg
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_SBOM(t *testing.T) {
+	dir := t.TempDir()
+	projectDir := filepath.Join(dir, "project")
+	cacheDir := filepath.Join(dir, "cache")
+	mitText, err := knownLicenseText("MIT")
+	require.NoError(t, err)
+	writeLintFiles(t, dir, map[string]string{
+		"project/" + DefaultSpecName: `name: app
+version: 1.2.0
+license: MIT
+dependencies:
+  bar:
+    url: github.com/foo/bar
+    version: ^1.0.0
+  local:
+    path: ../local
+`,
+		"project/" + DefaultLockFileName: `prefixes:
+  bar: github.com/foo/bar
+  local: ..-local
+packages:
+  github.com/foo/bar:
+    url: github.com/foo/bar
+    name: bar
+    version: 1.0.0
+    hash: 1234567890abcdef
+    prefixes:
+      baz: github.com/foo/baz
+  github.com/foo/baz:
+    url: github.com/foo/baz
+    version: 2.0.0
+    hash: fedcba0987654321
+  ..-local:
+    path: ../local
+`,
+		"cache/" + URLVersionToRelPath("github.com/foo/baz", "2.0.0") + "/LICENSE": mitText,
+		"local/" + DefaultSpecName: "name: local\nlicense: Apache-2.0\n",
+	})
+
+	bar := NewDesc("bar", "", "github.com/foo/bar", "1.0.0", "", "BSD-3-Clause", "", nil)
+	ui := testUI{}
+	m := ProjectPkgManager{
+		Manager: &Manager{
+			registries: makeRegistries(bar),
+			cache:      NewCache("", &ui, WithPkgCachePath(cacheDir)),
+			ui:         &ui,
+		},
+		Paths: &ProjectPaths{
+			ProjectRootPath: projectDir,
+			LockFile:        filepath.Join(projectDir, DefaultLockFileName),
+			SpecFile:        filepath.Join(projectDir, DefaultSpecName),
+		},
+	}
+	sbom, err := m.BuildSBOM()
+	require.NoError(t, err)
+	assert.Empty(t, ui.messages)
+	assert.Equal(t, SBOMComponent{
+		Name:         "app",
+		Version:      "1.2.0",
+		License:      "MIT",
+		Dependencies: []string{"..-local", "github.com/foo/bar"},
+	}, sbom.Project)
+	assert.Equal(t, []SBOMComponent{
+		{
+			ID:           "..-local",
+			Name:         "local",
+			License:      "Apache-2.0",
+			LocalPath:    "../local",
+			Dependencies: []string{},
+		},
+		{
+			ID:           "github.com/foo/bar",
+			Name:         "bar",
+			Version:      "1.0.0",
+			URL:          "github.com/foo/bar",
+			Hash:         "1234567890abcdef",
+			License:      "BSD-3-Clause",
+			Dependencies: []string{"github.com/foo/baz"},
+		},
+		{
+			ID:           "github.com/foo/baz",
+			Name:         "baz",
+			Version:      "2.0.0",
+			URL:          "github.com/foo/baz",
+			Hash:         "fedcba0987654321",
+			License:      "MIT",
+			Dependencies: []string{},
+		},
+	}, sbom.Components)
+
+	created := time.Date(2021, 7, 8, 10, 0, 0, 0, time.UTC)
+
+	t.Run("SPDX", func(t *testing.T) {
+		var buffer bytes.Buffer
+		require.NoError(t, sbom.Write(&buffer, SBOMFormatSPDX, created))
+		doc := spdxDocument{}
+		require.NoError(t, json.Unmarshal(buffer.Bytes(), &doc))
+		assert.Equal(t, "SPDX-2.3", doc.SPDXVersion)
+		assert.Equal(t, "2021-07-08T10:00:00Z", doc.CreationInfo.Created)
+		require.Len(t, doc.Packages, 4)
+		assert.Equal(t, spdxPackage{
+			Name:             "local",
+			SPDXID:           "SPDXRef-Package-..-local",
+			DownloadLocation: "NONE",
+			LicenseConcluded: "NOASSERTION",
+			LicenseDeclared:  "Apache-2.0",
+			CopyrightText:    "NOASSERTION",
+			Comment:          "Local package at '../local'",
+		}, doc.Packages[1])
+		assert.Equal(t, "git+https://github.com/foo/bar@1234567890abcdef", doc.Packages[2].DownloadLocation)
+		assert.Equal(t, []spdxRelationship{
+			{"SPDXRef-DOCUMENT", "DESCRIBES", "SPDXRef-Project"},
+			{"SPDXRef-Project", "DEPENDS_ON", "SPDXRef-Package-..-local"},
+			{"SPDXRef-Project", "DEPENDS_ON", "SPDXRef-Package-github.com-foo-bar"},
+			{"SPDXRef-Package-github.com-foo-bar", "DEPENDS_ON", "SPDXRef-Package-github.com-foo-baz"},
+		}, doc.Relationships)
+
+		// The output is reproducible.
+		var again bytes.Buffer
+		require.NoError(t, sbom.Write(&again, SBOMFormatSPDX, created))
+		assert.Equal(t, buffer.String(), again.String())
+	})
+
+	t.Run("CycloneDX", func(t *testing.T) {
+		var buffer bytes.Buffer
+		require.NoError(t, sbom.Write(&buffer, SBOMFormatCycloneDX, created))
+		doc := cycloneDXDocument{}
+		require.NoError(t, json.Unmarshal(buffer.Bytes(), &doc))
+		assert.Equal(t, "CycloneDX", doc.BOMFormat)
+		assert.Equal(t, "app", doc.Metadata.Component.Name)
+		require.Len(t, doc.Components, 3)
+		assert.Equal(t, []cycloneDXProperty{{"toit:local-path", "../local"}}, doc.Components[0].Properties)
+		assert.Equal(t, cycloneDXComponent{
+			Type:               "library",
+			BOMRef:             "github.com/foo/bar",
+			Name:               "bar",
+			Version:            "1.0.0",
+			Licenses:           []cycloneDXLicenseChoice{{License: &cycloneDXLicense{ID: "BSD-3-Clause"}}},
+			ExternalReferences: []cycloneDXExternalReference{{"vcs", "https://github.com/foo/bar"}},
+			Properties:         []cycloneDXProperty{{"toit:git-hash", "1234567890abcdef"}},
+		}, doc.Components[1])
+		assert.Equal(t, []cycloneDXDependency{
+			{"project", []string{"..-local", "github.com/foo/bar"}},
+			{"..-local", []string{}},
+			{"github.com/foo/bar", []string{"github.com/foo/baz"}},
+			{"github.com/foo/baz", []string{}},
+		}, doc.Dependencies)
+	})
+
+	t.Run("Missing lock file", func(t *testing.T) {
+		ui := testUI{}
+		emptyDir := t.TempDir()
+		m := ProjectPkgManager{
+			Manager: &Manager{ui: &ui},
+			Paths: &ProjectPaths{
+				ProjectRootPath: emptyDir,
+				LockFile:        filepath.Join(emptyDir, DefaultLockFileName),
+				SpecFile:        filepath.Join(emptyDir, DefaultSpecName),
+			},
+		}
+		_, err := m.BuildSBOM()
+		assert.True(t, IsErrAlreadyReported(err))
+		assert.Equal(t, []string{
+			"Error: Missing lock file '" + m.Paths.LockFile + "'. Run 'toit pkg install' first",
+		}, ui.messages)
+	})
+}
@@ -0,0 +1,358 @@
+// Copyright (C) 2021 Toitware ApS.
+//
+// This library is free software; you can redistribute it and/or
+// modify it under the terms of the GNU Lesser General Public
+// License as published by the Free Software Foundation; version
+// 2.1 only.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Lesser General Public License for more details.
+//
+// The license can be found in the file `LICENSE` in the top level
+// directory of this repository.
+
+package tpkg
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/go-version"
+)
+
+// SearchQuery is a parsed search query.
+//
+// A query consists of whitespace-separated terms. A term of the form
+// 'field:value' only matches packages where the given field matches
+// the value:
+//   - 'name:' the name contains the value (or is close to it).
+//   - 'license:' the license is the value, or the license expression contains
+//     the value.
+//   - 'keyword:' (or 'topic:') one of the keywords is the value.
+//   - 'sdk:' the SDK constraint of the package accepts the SDK version.
+//   - 'target:' the package supports the target.
+//   - 'url:' the URL contains the value.
+//
+// All other terms are searched in the name, keywords, description, URL and
+// the remaining metadata of the package.
+// A package must match all terms of the query. Comparisons are case-insensitive.
+type SearchQuery struct {
+	terms    []string
+	names    []string
+	licenses []string
+	keywords []string
+	urls     []string
+	sdks     []*version.Version
+	targets  []string
+}
+
+// Scores of matches. Matches in the name are the most relevant, followed by
+// keywords, the description, and the URL.
+// Fuzzy matches (typos) are the least relevant.
+const (
+	scoreExactName     = 100
+	scoreNamePrefix    = 75
+	scoreNameContains  = 50
+	scoreExactKeyword  = 40
+	scoreKeyword       = 20
+	scoreDescription   = 10
+	scoreURL           = 5
+	scoreOtherMetadata = 2
+	scoreFuzzy         = 1
+)
+
+// ParseSearchQuery parses the given query.
+// See SearchQuery for the syntax.
+func ParseSearchQuery(query string, ui UI) (*SearchQuery, error) {
+	result, err := parseSearchQuery(query)
+	if err != nil {
+		return nil, ui.ReportError("Invalid search query: %v", err)
+	}
+	return result, nil
+}
+
+func parseSearchQuery(query string) (*SearchQuery, error) {
+	result := &SearchQuery{}
+	for _, term := range strings.Fields(query) {
+		field, value, found := strings.Cut(term, ":")
+		if !found {
+			result.terms = append(result.terms, term)
+			continue
+		}
+		var values *[]string
+		switch strings.ToLower(field) {
+		case "name":
+			values = &result.names
+		case "license":
+			values = &result.licenses
+		case "keyword", "keywords", "topic", "topics":
+			values = &result.keywords
+		case "url":
+			values = &result.urls
+		case "target":
+			values = &result.targets
+		case "sdk":
+			if value == "" {
+				return nil, fmt.Errorf("missing value for '%s:'", field)
+			}
+			v, err := version.NewVersion(value)
+			if err != nil {
+				return nil, fmt.Errorf("'%s' is not a valid SDK version", value)
+			}
+			result.sdks = append(result.sdks, v)
+			continue
+		default:
+			// Not a known field. Search for the whole term.
+			result.terms = append(result.terms, term)
+			continue
+		}
+		if value == "" {
+			return nil, fmt.Errorf("missing value for '%s:'", field)
+		}
+		*values = append(*values, value)
+	}
+	return result, nil
+}
+
+// searchMatch describes how well a description matches a query.
+type searchMatch struct {
+	score int
+	// Whether some term only matched because of a typo.
+	fuzzy bool
+}
+
+// match returns whether the given description matches the query, and how
+// relevant the match is.
+func (q *SearchQuery) match(desc *Desc) (searchMatch, bool) {
+	result := searchMatch{}
+	for _, license := range q.licenses {
+		if !hasLicense(desc, license) {
+			return result, false
+		}
+	}
+	for _, keyword := range q.keywords {
+		if !hasKeyword(desc, keyword) {
+			return result, false
+		}
+	}
+	for _, url := range q.urls {
+		if !containsFold(desc.URL, url) {
+			return result, false
+		}
+	}
+	for _, sdk := range q.sdks {
+		if !acceptsSDK(desc, sdk) {
+			return result, false
+		}
+	}
+	for _, target := range q.targets {
+		if !supportsTarget(desc.Environment.Targets, target) {
+			return result, false
+		}
+	}
+	for _, name := range q.names {
+		nameScore := scoreName(name, desc.Name)
+		if nameScore == 0 {
+			if !isFuzzyMatch(name, desc.Name) {
+				return result, false
+			}
+			nameScore = scoreFuzzy
+			result.fuzzy = true
+		}
+		result.score += nameScore
+	}
+	for _, term := range q.terms {
+		termScore := scoreTerm(term, desc)
+		if termScore == 0 {
+			if !isFuzzyTermMatch(term, desc) {
+				return result, false
+			}
+			termScore = scoreFuzzy
+			result.fuzzy = true
+		}
+		result.score += termScore
+	}
+	return result, true
+}
+
+// filter returns the descriptions that match the query.
+// Matches that rely on typos are only returned if there isn't any other match.
+func (q *SearchQuery) filter(descs []*Desc) []*Desc {
+	exact := []*Desc{}
+	fuzzy := []*Desc{}
+	for _, desc := range descs {
+		m, ok := q.match(desc)
+		if !ok {
+			continue
+		}
+		if m.fuzzy {
+			fuzzy = append(fuzzy, desc)
+		} else {
+			exact = append(exact, desc)
+		}
+	}
+	if len(exact) > 0 {
+		return exact
+	}
+	return fuzzy
+}
+
+func containsFold(haystack string, needle string) bool {
+	return strings.Contains(strings.ToLower(haystack), strings.ToLower(needle))
+}
+
+func hasKeyword(desc *Desc, keyword string) bool {
+	for _, k := range desc.Keywords {
+		if strings.EqualFold(k, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasLicense returns whether the license of the description is the given
+// license, or is an SPDX expression that contains it.
+func hasLicense(desc *Desc, license string) bool {
+	if strings.EqualFold(desc.License, license) {
+		return true
+	}
+	expression, err := ParseLicenseExpression(desc.License)
+	if err != nil {
+		return false
+	}
+	for _, single := range expression.Licenses() {
+		if strings.EqualFold(single.License, license) {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptsSDK returns whether the SDK constraint of the description accepts
+// the given SDK version.
+// Packages without constraint accept every SDK.
+func acceptsSDK(desc *Desc, sdk *version.Version) bool {
+	if desc.Environment.SDK == "" {
+		return true
+	}
+	constraint, err := parseConstraint(desc.Environment.SDK)
+	if err != nil {
+		return false
+	}
+	return constraint.Check(sdk)
+}
+
+func scoreName(needle string, name string) int {
+	needle = strings.ToLower(needle)
+	name = strings.ToLower(name)
+	switch {
+	case name == needle:
+		return scoreExactName
+	case strings.HasPrefix(name, needle):
+		return scoreNamePrefix
+	case strings.Contains(name, needle):
+		return scoreNameContains
+	}
+	return 0
+}
+
+// scoreTerm computes how well the given description matches the term.
+// Returns 0 if the description doesn't match.
+func scoreTerm(term string, desc *Desc) int {
+	score := scoreName(term, desc.Name)
+	keywordScore := 0
+	for _, keyword := range desc.Keywords {
+		if strings.EqualFold(keyword, term) {
+			keywordScore = scoreExactKeyword
+			break
+		} else if containsFold(keyword, term) {
+			keywordScore = scoreKeyword
+		}
+	}
+	score += keywordScore
+	if searchDescription(term, desc) {
+		score += scoreDescription
+	}
+	if searchURL(term, desc) {
+		score += scoreURL
+	}
+	otherMetadata := append([]string{desc.Homepage, desc.Repository}, desc.Authors...)
+	for _, str := range otherMetadata {
+		if containsFold(str, term) {
+			score += scoreOtherMetadata
+			break
+		}
+	}
+	return score
+}
+
+// isFuzzyTermMatch returns whether the term is close to the name or one of
+// the keywords of the description.
+func isFuzzyTermMatch(term string, desc *Desc) bool {
+	if isFuzzyMatch(term, desc.Name) {
+		return true
+	}
+	for _, keyword := range desc.Keywords {
+		if isFuzzyMatch(term, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// isFuzzyMatch returns whether the needle is close enough to str to be
+// considered a typo.
+// Short needles must match exactly, as almost everything is close to them.
+func isFuzzyMatch(needle string, str string) bool {
+	needle = strings.ToLower(needle)
+	str = strings.ToLower(str)
+	allowed := 0
+	switch {
+	case len(needle) >= 7:
+		allowed = 2
+	case len(needle) >= 4:
+		allowed = 1
+	default:
+		return false
+	}
+	return editDistance(needle, str) <= allowed
+}
+
+// editDistance computes the edit distance between a and b.
+// Insertions, deletions, substitutions and transpositions of two adjacent
+// characters count as one edit.
+func editDistance(a string, b string) int {
+	ra := []rune(a)
+	rb := []rune(b)
+	// d[i][j] is the distance between the first i runes of a and the first
+	// j runes of b.
+	d := make([][]int, len(ra)+1)
+	for i := range d {
+		d[i] = make([]int, len(rb)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	minOf := func(x int, y int) int {
+		if x < y {
+			return x
+		}
+		return y
+	}
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			d[i][j] = minOf(minOf(d[i-1][j]+1, d[i][j-1]+1), d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				d[i][j] = minOf(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(ra)][len(rb)]
+}
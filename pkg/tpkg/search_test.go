@@ -0,0 +1,132 @@
+// Copyright (C) 2021 Toitware ApS.
+//
+// This library is free software; you can redistribute it and/or
+// modify it under the terms of the GNU Lesser General Public
+// License as published by the Free Software Foundation; version
+// 2.1 only.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Lesser General Public License for more details.
+//
+// The license can be found in the file `LICENSE` in the top level
+// directory of this repository.
+
+package tpkg
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func searchNames(t *testing.T, registries Registries, query string) []string {
+	found, err := registries.SearchAll(query)
+	require.NoError(t, err)
+	names := []string{}
+	for _, descReg := range found {
+		names = append(names, descReg.Desc.Name)
+	}
+	return names
+}
+
+func Test_SearchQuery(t *testing.T) {
+	morse := NewDesc("morse", "Morse code.", "github.com/toitware/toit-morse", "1.0.0", "^1.0.0", "MIT", "", nil)
+	morse.Keywords = []string{"encoding"}
+	morseExt := NewDesc("morse-extended", "More morse.", "github.com/other/morse-extended", "1.0.0", "", "Apache-2.0", "", nil)
+	encoder := NewDesc("encoder", "An encoder for morse code.", "github.com/other/encoder", "1.0.0", "^2.0.0", "MIT", "", nil)
+	display := NewDesc("display", "Displays.", "github.com/toitware/display", "1.0.0", "", "MIT", "", nil)
+	display.Keywords = []string{"graphics", "screen"}
+
+	registries := makeRegistries(encoder, display, morseExt, morse)
+
+	t.Run("Ranking", func(t *testing.T) {
+		assert.Equal(t, []string{"morse", "morse-extended", "encoder"}, searchNames(t, registries, "morse"))
+		// 'encoder' contains 'code' in its name.
+		assert.Equal(t, []string{"encoder", "morse"}, searchNames(t, registries, "code"))
+	})
+
+	t.Run("License expression", func(t *testing.T) {
+		dual := NewDesc("dual", "", "github.com/other/dual", "1.0.0", "", "MIT OR Apache-2.0", "", nil)
+		registries := makeRegistries(dual, morse)
+		assert.Equal(t, []string{"dual"}, searchNames(t, registries, "license:apache-2.0"))
+		assert.Equal(t, []string{"dual", "morse"}, searchNames(t, registries, "license:MIT"))
+	})
+
+	t.Run("Fields", func(t *testing.T) {
+		assert.Equal(t, []string{"morse-extended"}, searchNames(t, registries, "license:apache-2.0"))
+		assert.Equal(t, []string{"display"}, searchNames(t, registries, "keyword:graphics"))
+		assert.Equal(t, []string{"display"}, searchNames(t, registries, "topic:SCREEN"))
+		assert.Equal(t, []string{"display", "morse"}, searchNames(t, registries, "url:toitware"))
+		assert.Equal(t, []string{"morse", "morse-extended"}, searchNames(t, registries, "name:morse"))
+		// Packages without SDK constraint accept all SDKs.
+		assert.Equal(t, []string{"encoder", "display", "morse-extended"}, searchNames(t, registries, "sdk:2.1.0"))
+		assert.Equal(t, []string{"encoder", "morse"}, searchNames(t, registries, "license:MIT code"))
+		assert.Empty(t, searchNames(t, registries, "license:MIT keyword:graphics morse"))
+
+		esp32 := NewDesc("esp32-driver", "", "esp32-driver", "1.0.0", "", "MIT", "", nil)
+		esp32.Environment.Targets = []string{"esp32*"}
+		host := NewDesc("host-driver", "", "host-driver", "1.0.0", "", "MIT", "", nil)
+		host.Environment.Targets = []string{"host"}
+		anywhere := NewDesc("any-driver", "", "any-driver", "1.0.0", "", "MIT", "", nil)
+		targetRegistries := makeRegistries(esp32, host, anywhere)
+		assert.Equal(t, []string{"esp32-driver", "any-driver"}, searchNames(t, targetRegistries, "target:esp32s3"))
+		assert.Equal(t, []string{"host-driver", "any-driver"}, searchNames(t, targetRegistries, "target:HOST"))
+	})
+
+	t.Run("Fuzzy", func(t *testing.T) {
+		assert.Equal(t, []string{"display"}, searchNames(t, registries, "dispaly"))
+		assert.Equal(t, []string{"display"}, searchNames(t, registries, "grafics"))
+		// Short terms must match exactly.
+		assert.Empty(t, searchNames(t, registries, "mrs"))
+
+		// Typos are only considered if there isn't any other match.
+		pkg1 := NewDesc("pkg1", "", "pkg1", "1.0.0", "", "MIT", "", nil)
+		pkg2 := NewDesc("pkg2", "", "pkg2", "1.0.0", "", "MIT", "", nil)
+		pkgRegistries := makeRegistries(pkg1, pkg2)
+		assert.Equal(t, []string{"pkg2"}, searchNames(t, pkgRegistries, "pkg2"))
+		assert.Equal(t, []string{"pkg1", "pkg2"}, searchNames(t, pkgRegistries, "pkg3"))
+	})
+
+	t.Run("Unknown field", func(t *testing.T) {
+		// Unknown fields are searched as normal terms.
+		assert.Empty(t, searchNames(t, registries, "foo:bar"))
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		ui := &testUI{}
+		_, err := ParseSearchQuery("sdk:not-a-version", ui)
+		require.Error(t, err)
+		assert.True(t, IsErrAlreadyReported(err))
+		assert.Equal(t, []string{"Error: Invalid search query: 'not-a-version' is not a valid SDK version"}, ui.messages)
+
+		ui = &testUI{}
+		_, err = ParseSearchQuery("name:", ui)
+		require.Error(t, err)
+		assert.Equal(t, []string{"Error: Invalid search query: missing value for 'name:'"}, ui.messages)
+	})
+}
+
+func Test_EditDistance(t *testing.T) {
+	assert.Equal(t, 0, editDistance("morse", "morse"))
+	assert.Equal(t, 1, editDistance("morse", "moose"))
+	assert.Equal(t, 1, editDistance("display", "dispaly"))
+	assert.Equal(t, 2, editDistance("graphics", "grafics"))
+	assert.Equal(t, 3, editDistance("", "abc"))
+	assert.Equal(t, 1, editDistance("abc", "abd"))
+}
+
+func Test_SearchAllRanking(t *testing.T) {
+	inDescription := NewDesc("other", "A driver for sensors.", "github.com/a/other", "1.0.0", "", "MIT", "", nil)
+	inKeywords := NewDesc("bme280", "Humidity.", "github.com/b/bme280", "1.0.0", "", "MIT", "", nil)
+	inKeywords.Keywords = []string{"sensors"}
+	inName := NewDesc("sensors", "Utilities.", "github.com/c/sensors", "1.0.0", "", "MIT", "", nil)
+	byAuthor := NewDesc("unrelated", "Unrelated.", "github.com/d/unrelated", "1.0.0", "", "MIT", "", nil)
+	byAuthor.Authors = []string{"Sensors Inc."}
+	noMatch := NewDesc("nothing", "Nothing.", "github.com/e/nothing", "1.0.0", "", "MIT", "", nil)
+
+	registries := makeRegistries(inDescription, byAuthor, noMatch, inKeywords, inName)
+	assert.Equal(t, []string{"sensors", "bme280", "other", "unrelated"}, searchNames(t, registries, "sensors"))
+}
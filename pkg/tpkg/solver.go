@@ -30,9 +30,29 @@ type Solver struct {
 	ui            UI
 	state         solverState
 	printedErrors set.String
+	// The reported problems, in the order they were encountered.
+	conflicts []string
 	// sdkVersion is the SDK version the application runs on.
 	// All packages must satisfy this version.
 	sdkVersion *version.Version
+	// The targets the application runs on.
+	// All packages must support these targets.
+	targets []string
+	// Overrides, from package-url to its replacement.
+	overrides map[string]solverOverride
+	// Git-ref packages, from package-url to the resolved package.
+	gitRefs map[string]*gitRefPackage
+}
+
+// solverOverride replaces all dependencies on a package.
+type solverOverride struct {
+	// The URL of the replacement. Empty if the URL doesn't change.
+	url string
+	// The constraints of the replacement. Nil if the constraints don't change.
+	constraints *Constraints
+	// Whether the package is replaced by a local package.
+	// Dependencies on it are dropped, as local packages aren't solved.
+	isLocal bool
 }
 
 // pkgDB is a map from package-url to all the existing packages of that url.
@@ -46,20 +66,28 @@ type pkgDB map[string][]solverPkg
 type solverPkg struct {
 	version *version.Version
 	deps    []SolverDep
-	minSDK  *version.Version
+	sdk     *sdkConstraint
+	// The supported targets. Empty if the package supports all targets.
+	targets []string
+	// Whether the version was yanked. Yanked versions are only used if
+	// they are preferred (because they are already locked).
+	yanked bool
 }
 
 // SolverDep represents a dependency for the solver.
 // It needs the target's package name and the version constraints for it.
 type SolverDep struct {
 	url         string
-	constraints version.Constraints
+	constraints Constraints
 }
 
 // Solution is a map from pkg-url to a set of version-strings.
 type Solution struct {
 	pkgs   map[string][]StringVersion
 	minSDK *version.Version
+	// The git-ref packages the solver knew about, from package-url to the
+	// resolved package.
+	gitRefs map[string]*gitRefPackage
 }
 
 type StringVersion struct {
@@ -148,7 +176,7 @@ func (a byVersion) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
 func (a byVersion) Less(i, j int) bool { return a[i].version.LessThan(a[j].version) }
 
 func NewSolverDep(url string, constraintString string) (SolverDep, error) {
-	constraints := version.Constraints{}
+	constraints := Constraints{}
 	if constraintString != "" {
 		var err error
 		constraints, err = parseConstraint(constraintString)
@@ -192,7 +220,7 @@ func NewSolver(registries Registries, sdkVersion *version.Version, ui UI) (*Solv
 			if err != nil {
 				return nil, err
 			}
-			minSDK, err := sdkConstraintToMinSDK(desc.Environment.SDK)
+			sdk, err := parseSDKConstraint(desc.Environment.SDK)
 			if err != nil {
 				return nil, err
 			}
@@ -200,7 +228,9 @@ func NewSolver(registries Registries, sdkVersion *version.Version, ui UI) (*Solv
 			pkgs = append(pkgs, solverPkg{
 				version: v,
 				deps:    deps,
-				minSDK:  minSDK,
+				sdk:     sdk,
+				targets: desc.Environment.Targets,
+				yanked:  desc.Yanked != "",
 			})
 			result.db[desc.URL] = pkgs
 		}
@@ -219,6 +249,67 @@ func NewSolver(registries Registries, sdkVersion *version.Version, ui UI) (*Solv
 	return result, nil
 }
 
+// SetTargets sets the targets the application runs on.
+// Versions of packages that don't support all of them are skipped.
+func (s *Solver) SetTargets(targets []string) {
+	s.targets = targets
+}
+
+// SetOverrides sets the overrides of the solver.
+// The overrides are given as in the spec: a map from package-url to
+// the replacement.
+func (s *Solver) SetOverrides(overrides DependencyMap) error {
+	s.overrides = map[string]solverOverride{}
+	for url, override := range overrides {
+		solverOverride := solverOverride{
+			url:     override.URL,
+			isLocal: override.Path != "",
+		}
+		if override.Version != "" {
+			constraints, err := parseConstraint(override.Version)
+			if err != nil {
+				return err
+			}
+			solverOverride.constraints = &constraints
+		}
+		s.overrides[url] = solverOverride
+	}
+	return nil
+}
+
+// setGitRefs adds the given git-ref packages to the solver.
+// A git-ref package replaces all registry packages of its URL, and all
+// dependencies on the URL are resolved to it.
+// Must be called after SetOverrides.
+func (s *Solver) setGitRefs(gitRefs map[string]*gitRefPackage) error {
+	if s.overrides == nil {
+		s.overrides = map[string]solverOverride{}
+	}
+	for url, gitRef := range gitRefs {
+		v, err := version.NewVersion(gitRef.version)
+		if err != nil {
+			return err
+		}
+		constraints, err := parseConstraint("=" + gitRef.version)
+		if err != nil {
+			return err
+		}
+		s.db[url] = []solverPkg{
+			{
+				version: v,
+				deps:    gitRef.deps,
+				sdk:     gitRef.sdk,
+				targets: gitRef.targets,
+			},
+		}
+		s.overrides[url] = solverOverride{
+			constraints: &constraints,
+		}
+	}
+	s.gitRefs = gitRefs
+	return nil
+}
+
 // SetPreferred marks the list of versionedURLs as preferred.
 func (s *Solver) SetPreferred(preferred []versionedURL) {
 	// Start from the back, so that the given preferred versions are found in order.
@@ -241,6 +332,9 @@ func (s *Solver) SetPreferred(preferred []versionedURL) {
 		for j := 0; j < len(pkgs); j++ {
 			pkg := pkgs[j]
 			if pkg.version.Equal(version) {
+				// Preferred versions come from the lock file. They are kept
+				// even if they have been yanked in the meantime.
+				pkg.yanked = false
 				// Take the current pkg and move it to the first slot.
 				for k := j; k > 0; k-- {
 					pkgs[k] = pkgs[k-1]
@@ -259,11 +353,7 @@ func (s *Solver) solveDep(dep *SolverDep, cont solverContinuation) (bool, solver
 	available, ok := s.db[url]
 
 	if !ok {
-		msg := fmt.Sprintf("Package '%s' not found", url)
-		if !s.printedErrors.Contains(msg) {
-			s.ui.ReportWarning(msg)
-			s.printedErrors.Add(msg)
-		}
+		s.reportConflict("Package '%s' not found", url)
 		return false, solverContinuation{}, undoInfo{}
 	}
 
@@ -271,6 +361,8 @@ func (s *Solver) solveDep(dep *SolverDep, cont solverContinuation) (bool, solver
 	constraints := dep.constraints
 	foundSatisfying := index != 0 // We already found one last time.
 	sdkMismatch := false
+	targetMismatch := false
+	yankedMismatch := false
 	// Annoyingly we still need to run through all available packages,
 	// even if an earlier entry already fixed a version. This is, because
 	// the dependency might allow multiple major versions, and we only
@@ -281,10 +373,18 @@ func (s *Solver) solveDep(dep *SolverDep, cont solverContinuation) (bool, solver
 		if !constraints.Check(candidate.version) {
 			continue
 		}
-		if s.sdkVersion != nil && candidate.minSDK != nil && s.sdkVersion.LessThan(candidate.minSDK) {
+		if candidate.yanked {
+			yankedMismatch = true
+			continue
+		}
+		if s.sdkVersion != nil && !candidate.sdk.check(s.sdkVersion) {
 			sdkMismatch = true
 			continue
 		}
+		if !supportsTargets(candidate.targets, s.targets) {
+			targetMismatch = true
+			continue
+		}
 		foundSatisfying = true
 		major := candidate.version.Segments()[0]
 		urlVersion := url + "-" + fmt.Sprint(major)
@@ -303,9 +403,10 @@ func (s *Solver) solveDep(dep *SolverDep, cont solverContinuation) (bool, solver
 		}
 		if !ok {
 			// First time we set a concrete version for this URL-major.
+			candidateMinSDK := candidate.sdk.minVersion()
 			if s.state.minSDK == nil ||
-				(candidate.minSDK != nil && candidate.minSDK.GreaterThan(s.state.minSDK)) {
-				s.state.minSDK = candidate.minSDK
+				(candidateMinSDK != nil && candidateMinSDK.GreaterThan(s.state.minSDK)) {
+				s.state.minSDK = candidateMinSDK
 			}
 			s.state.pkgs[urlVersion] = candidate.version
 			s.addDeps(candidate.deps)
@@ -315,30 +416,92 @@ func (s *Solver) solveDep(dep *SolverDep, cont solverContinuation) (bool, solver
 		return true, solverContinuation{index: index}, undo
 	}
 	if !foundSatisfying {
-		msg := ""
+		format := ""
+		args := []interface{}{url}
 		if constraints.String() != "" {
-			msg = fmt.Sprintf("No version of '%s' satisfies constraint '%s'", url, constraints.String())
+			format = "No version of '%s' satisfies constraint '%s'"
+			args = append(args, constraints.String())
 			if sdkMismatch {
-				msg += " with SDK version " + s.sdkVersion.String()
+				format += " with SDK version %s"
+				args = append(args, s.sdkVersion.String())
+			}
+			if targetMismatch {
+				format += " for %s"
+				args = append(args, describeTargets(s.targets))
 			}
+		} else if sdkMismatch {
+			format = "No version of '%s' exists for SDK version '%s'"
+			args = append(args, s.sdkVersion.String())
+			if targetMismatch {
+				format += " and %s"
+				args = append(args, describeTargets(s.targets))
+			}
+		} else if targetMismatch {
+			format = "No version of '%s' exists for %s"
+			args = append(args, describeTargets(s.targets))
+		} else if yankedMismatch {
+			format = "All versions of '%s' have been yanked"
+		} else if s.sdkVersion == nil {
+			format = "No version of '%s' exists"
 		} else {
-			msg = fmt.Sprintf("No version of '%s' exists for SDK version '%s'", url, s.sdkVersion.String())
+			format = "No version of '%s' exists for SDK version '%s'"
+			args = append(args, s.sdkVersion.String())
 		}
-		if !s.printedErrors.Contains(msg) {
-			s.ui.ReportWarning(msg)
-			s.printedErrors.Add(msg)
+		if yankedMismatch && (constraints.String() != "" || sdkMismatch || targetMismatch) {
+			format += " (some matching versions have been yanked)"
 		}
+		s.reportConflict(format, args...)
 	}
 
 	// Return a failure.
 	return false, solverContinuation{}, undoInfo{}
 }
 
+// reportConflict reports the given problem as warning, unless it was
+// already reported.
+// The format and arguments are passed to the UI unchanged, so that UIs
+// can report them separately.
+func (s *Solver) reportConflict(format string, a ...interface{}) {
+	msg := fmt.Sprintf(format, a...)
+	if s.printedErrors.Contains(msg) {
+		return
+	}
+	s.ui.ReportWarning(format, a...)
+	s.printedErrors.Add(msg)
+	s.conflicts = append(s.conflicts, msg)
+}
+
+// reset forgets the problems of earlier calls to Solve, so that the solver
+// can be reused for unrelated dependencies.
+func (s *Solver) reset() {
+	s.printedErrors = set.String{}
+	s.conflicts = nil
+}
+
+// Conflicts returns the problems the solver encountered while searching for
+// a solution.
+// If Solve didn't find a solution, they explain why.
+func (s *Solver) Conflicts() []string {
+	return s.conflicts
+}
+
 // addDeps adds all dependencies to the working queue.
 // They will be checked when it's their turn.
+// Overrides are applied before the dependencies are added.
 func (s *Solver) addDeps(deps []SolverDep) {
 	for _, dep := range deps {
 		localDep := dep
+		if override, ok := s.overrides[dep.url]; ok {
+			if override.isLocal {
+				continue
+			}
+			if override.url != "" {
+				localDep.url = override.url
+			}
+			if override.constraints != nil {
+				localDep.constraints = *override.constraints
+			}
+		}
 		s.state.workingQueue = append(s.state.workingQueue, &localDep)
 	}
 }
@@ -353,17 +516,19 @@ func (s *Solver) applyUndo(undo undoInfo) {
 	s.state.minSDK = undo.minSDK
 }
 
-func (s *Solver) Solve(minSDK *version.Version, deps []SolverDep) *Solution {
-	if s.sdkVersion != nil && minSDK != nil {
-		if s.sdkVersion.LessThan(minSDK) {
-			s.ui.ReportWarning("SDK version '%s' does not satisfy the minimal SDK requirement '^%s'",
-				s.sdkVersion.String(), minSDK.String())
-			return nil
-		}
+// Solve finds versions for the given dependencies.
+// The sdk is the SDK constraint of the application. It may be nil.
+// Returns nil if there isn't any solution. The reasons are reported to the
+// UI, and are available through Conflicts.
+func (s *Solver) Solve(sdk *sdkConstraint, deps []SolverDep) *Solution {
+	if s.sdkVersion != nil && !sdk.check(s.sdkVersion) {
+		s.reportConflict("SDK version '%s' does not satisfy the SDK requirement '%s'",
+			s.sdkVersion.String(), sdk.String())
+		return nil
 	}
 	s.state = solverState{
 		pkgs:          map[string]*version.Version{},
-		minSDK:        minSDK,
+		minSDK:        sdk.minVersion(),
 		workingQueue:  []*SolverDep{},
 		undos:         []undoInfo{},
 		continuations: []solverContinuation{},
@@ -386,7 +551,9 @@ func (s *Solver) Solve(minSDK *version.Version, deps []SolverDep) *Solution {
 		if workingIndex >= len(s.state.workingQueue) {
 			// We have successfully handled all workingQueue entries.
 			// This means we found a solution.
-			return s.state.Solution()
+			solution := s.state.Solution()
+			solution.gitRefs = s.gitRefs
+			return solution
 		}
 		if workingIndex < 0 {
 			// No solution was found.
@@ -436,7 +603,12 @@ func (sol Solution) versionFor(url string, constraintsString string, ui UI) (str
 	if !ok {
 		return "", fmt.Errorf("package solution missing package '%s'", url)
 	}
-	constraints := version.Constraints{}
+	if gitRef, ok := sol.gitRefs[url]; ok {
+		// All dependencies on a git-ref package use it, independent of their
+		// constraints.
+		return gitRef.version, nil
+	}
+	constraints := Constraints{}
 	if constraintsString != "" {
 		var err error
 		constraints, err = parseConstraint(constraintsString)
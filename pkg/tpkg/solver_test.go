@@ -16,6 +16,8 @@
 package tpkg
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"strings"
 	"testing"
@@ -101,7 +103,7 @@ func findSolutionSDKUI(t *testing.T, solveFor *Desc, registries Registries, sdkV
 	startConstraint, err := parseConstraint(solveFor.Version)
 	require.NoError(t, err)
 
-	solveForSDK, err := sdkConstraintToMinSDK(solveFor.Environment.SDK)
+	solveForSDK, err := parseSDKConstraint(solveFor.Environment.SDK)
 	require.NoError(t, err)
 
 	solution := solver.Solve(solveForSDK, []SolverDep{
@@ -356,6 +358,172 @@ func Test_Solver(t *testing.T) {
 		solution, ui = findSolutionSDKUI(t, a170, registries, v105)
 		assert.Nil(t, solution)
 		assert.Len(t, ui.messages, 1)
-		assert.Equal(t, "Warning: SDK version '1.0.5' does not satisfy the minimal SDK requirement '^1.1.0'", ui.messages[0])
+		assert.Equal(t, "Warning: SDK version '1.0.5' does not satisfy the SDK requirement '^1.1.0'", ui.messages[0])
+	})
+
+	t.Run("SDK Constraints", func(t *testing.T) {
+		a170 := mkPkg("a-1.7.0", "b ^1.0.0")
+		b140 := mkPkg("b-1.4.0")
+		b160 := mkPkg("b-1.6.0")
+		b140.Environment.SDK = ">=1.0.0,<2.0.0"
+		b160.Environment.SDK = "^2.0.0-alpha.100 || ~2.1"
+		registries := makeRegistries(a170, b140, b160)
+
+		v150 := version.Must(version.NewVersion("1.5.0"))
+		solution := findSolutionSDK(t, a170, registries, v150)
+		checkSolution(t, solution, a170, b140)
+		assert.Equal(t, "1.0.0", solution.minSDK.String())
+
+		v200 := version.Must(version.NewVersion("2.0.0-alpha.120"))
+		solution = findSolutionSDK(t, a170, registries, v200)
+		checkSolution(t, solution, a170, b160)
+		assert.Equal(t, "2.0.0-alpha.100", solution.minSDK.String())
+
+		v300 := version.Must(version.NewVersion("3.0.0"))
+		solution, ui := findSolutionSDKUI(t, a170, registries, v300)
+		assert.Nil(t, solution)
+		assert.Equal(t, []string{"Warning: No version of 'b' satisfies constraint '>=1.0.0,<2.0.0' with SDK version 3.0.0"}, ui.messages)
+	})
+
+	t.Run("Overrides", func(t *testing.T) {
+		a170 := mkPkg("a-1.7.0", "b ^1.0.0", "c ^1.0.0")
+		b140 := mkPkg("b-1.4.0", "c ^1.0.0")
+		b200 := mkPkg("b-2.0.0")
+		c100 := mkPkg("c-1.0.0")
+		forkC := mkPkg("fork_c-1.0.1")
+		registries := makeRegistries(a170, b140, b200, c100, forkC)
+
+		ui := testUI{}
+		solver, err := NewSolver(registries, nil, &ui)
+		require.NoError(t, err)
+		require.NoError(t, solver.SetOverrides(DependencyMap{
+			"b": {Version: "2.0.0"},
+			"c": {URL: "fork_c"},
+		}))
+		startConstraint, err := parseConstraint(a170.Version)
+		require.NoError(t, err)
+		solution := solver.Solve(nil, []SolverDep{
+			{
+				url:         a170.URL,
+				constraints: startConstraint,
+			},
+		})
+		assert.Empty(t, ui.messages)
+		checkSolution(t, solution, a170, b200, forkC)
+	})
+
+	t.Run("Overrides Local", func(t *testing.T) {
+		a170 := mkPkg("a-1.7.0", "b ^1.0.0")
+		registries := makeRegistries(a170)
+
+		ui := testUI{}
+		solver, err := NewSolver(registries, nil, &ui)
+		require.NoError(t, err)
+		require.NoError(t, solver.SetOverrides(DependencyMap{
+			"b": {Path: "../b"},
+		}))
+		startConstraint, err := parseConstraint(a170.Version)
+		require.NoError(t, err)
+		solution := solver.Solve(nil, []SolverDep{
+			{
+				url:         a170.URL,
+				constraints: startConstraint,
+			},
+		})
+		assert.Empty(t, ui.messages)
+		checkSolution(t, solution, a170)
+	})
+
+	t.Run("Targets", func(t *testing.T) {
+		a170 := mkPkg("a-1.7.0", "b ^1.0.0")
+		b140 := mkPkg("b-1.4.0")
+		b160 := mkPkg("b-1.6.0")
+		b160.Environment.Targets = []string{"host"}
+		registries := makeRegistries(a170, b140, b160)
+
+		ui := testUI{}
+		solver, err := NewSolver(registries, nil, &ui)
+		require.NoError(t, err)
+		solver.SetTargets([]string{"esp32"})
+		solution := solver.Solve(nil, []SolverDep{
+			{
+				url:         a170.URL,
+				constraints: Constraints{},
+			},
+		})
+		assert.Empty(t, ui.messages)
+		checkSolution(t, solution, a170, b140)
+
+		b140.Environment.Targets = []string{"esp32s3", "host"}
+		ui = testUI{}
+		solver, err = NewSolver(registries, nil, &ui)
+		require.NoError(t, err)
+		solver.SetTargets([]string{"esp32"})
+		solution = solver.Solve(nil, []SolverDep{
+			{
+				url:         a170.URL,
+				constraints: Constraints{},
+			},
+		})
+		assert.Nil(t, solution)
+		assert.Equal(t, []string{"Warning: No version of 'b' satisfies constraint '>=1.0.0,<2.0.0' for target 'esp32'"}, ui.messages)
+	})
+
+	t.Run("Yanked", func(t *testing.T) {
+		a170 := mkPkg("a-1.7.0", "b ^1.0.0")
+		b140 := mkPkg("b-1.4.0")
+		b160 := mkPkg("b-1.6.0")
+		b160.Yanked = "Broken release"
+		registries := makeRegistries(a170, b140, b160)
+
+		deps := []SolverDep{
+			{
+				url:         a170.URL,
+				constraints: Constraints{},
+			},
+		}
+		ui := testUI{}
+		solver, err := NewSolver(registries, nil, &ui)
+		require.NoError(t, err)
+		solution := solver.Solve(nil, deps)
+		assert.Empty(t, ui.messages)
+		checkSolution(t, solution, a170, b140)
+
+		// Locked versions are kept.
+		solver, err = NewSolver(registries, nil, &ui)
+		require.NoError(t, err)
+		solver.SetPreferred([]versionedURL{{URL: b160.URL, Version: b160.Version}})
+		solution = solver.Solve(nil, deps)
+		assert.Empty(t, ui.messages)
+		checkSolution(t, solution, a170, b160)
+
+		b140.Yanked = "Also broken"
+		solver, err = NewSolver(registries, nil, &ui)
+		require.NoError(t, err)
+		solution = solver.Solve(nil, deps)
+		assert.Nil(t, solution)
+		assert.Equal(t, []string{"Warning: No version of 'b' satisfies constraint '>=1.0.0,<2.0.0' (some matching versions have been yanked)"}, ui.messages)
+	})
+
+	t.Run("Conflict Message", func(t *testing.T) {
+		a170 := mkPkg("a-1.7.0", "b ^1.0.0")
+		registries := makeRegistries(a170)
+
+		out := bytes.Buffer{}
+		solver, err := NewSolver(registries, nil, NewJSONUI(&out))
+		require.NoError(t, err)
+		solution := solver.Solve(nil, []SolverDep{
+			{
+				url:         a170.URL,
+				constraints: Constraints{},
+			},
+		})
+		assert.Nil(t, solution)
+		var msg JSONMessage
+		require.NoError(t, json.Unmarshal(out.Bytes(), &msg))
+		assert.Equal(t, "package-not-found", msg.Code)
+		assert.Equal(t, "Package 'b' not found", msg.Message)
+		assert.Equal(t, []interface{}{"b"}, msg.Args)
+		assert.Equal(t, []string{"Package 'b' not found"}, solver.Conflicts())
 	})
 }
@@ -17,13 +17,17 @@ package tpkg
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 
+	"github.com/hashicorp/go-version"
 	"github.com/toitlang/tpkg/pkg/compiler"
 	"github.com/toitlang/tpkg/pkg/set"
 	"gopkg.in/yaml.v2"
@@ -34,16 +38,55 @@ import (
 // 1. create a package description for package registries.
 // 2. specify the prefix-dependency mapping.
 type Spec struct {
-	path        string          `yaml:"-"`
+	path string `yaml:"-"`
+	// The parsed YAML document, if the spec was parsed.
+	// Used to preserve comments and formatting when writing the spec.
+	doc         *specDocument   `yaml:"-"`
 	Name        string          `yaml:"name,omitempty"`
 	Description string          `yaml:"description,omitempty"`
 	License     string          `yaml:"license,omitempty"`
 	Environment SpecEnvironment `yaml:"environment,omitempty"`
 	Deps        DependencyMap   `yaml:"dependencies,omitempty"`
+	// Dependencies that are only needed for the development of the package, like
+	// test helpers. They are resolved for the package itself, but are not
+	// part of its description, and are ignored when the package is used as
+	// a dependency.
+	DevDeps DependencyMap `yaml:"dev_dependencies,omitempty"`
+	// Overrides replace packages in the whole dependency graph, including
+	// transitive dependencies. The keys are the URLs of the replaced packages.
+	// An override can force a version (constraint), a local path, or a
+	// different URL (for example a fork). Git references ('ref') aren't supported.
+	// Only the overrides of the entry spec are used.
+	Overrides DependencyMap `yaml:"overrides,omitempty"`
+	// Workspace makes the spec the root of a workspace. The members of the
+	// workspace are solved together with the spec, and share its lock file.
+	Workspace *SpecWorkspace `yaml:"workspace,omitempty"`
+
+	// Optional metadata. It is copied into the description of the package.
+	Authors       []string `yaml:"authors,omitempty"`
+	Homepage      string   `yaml:"homepage,omitempty"`
+	Repository    string   `yaml:"repository,omitempty"`
+	Documentation string   `yaml:"documentation,omitempty"`
+	Keywords      []string `yaml:"keywords,omitempty"`
+	// Topics is an alias for Keywords.
+	Topics []string `yaml:"topics,omitempty"`
+	// The path to the README file, relative to the package.
+	Readme string `yaml:"readme,omitempty"`
+	// The version of the package.
+	// Published versions are determined by git tags. If the version is given,
+	// it must match the tag. 'pkg version bump' keeps it up to date.
+	Version string `yaml:"version,omitempty"`
+	// Fields that aren't known to this version of the package manager.
+	// They are kept so that writing the spec doesn't drop them.
+	Extra map[string]interface{} `yaml:",inline"`
 }
 
 type SpecEnvironment struct {
 	SDK string `yaml:"sdk,omitempty"`
+	// The targets (like 'esp32' or 'host') the package supports.
+	// For the entry spec, the targets that aren't patterns are also the
+	// targets of the project, and all dependencies must support them.
+	Targets []string `yaml:"targets,omitempty"`
 }
 
 // DependencyMap is a map from prefix to package.
@@ -58,21 +101,37 @@ type SpecPackage struct {
 	// Version is a version constraint on the package.
 	// A missing version constraint allows any version of the package.
 	Version string `yaml:"version,omitempty"`
+	// Ref is a git branch, tag, or commit of the repository at URL.
+	// If set, the package isn't taken from a registry, but from the
+	// repository directly. Can't be used together with Version.
+	Ref string `yaml:"ref,omitempty"`
 	// Path is set if the package should be found locally.
 	// This field overrides all other fields. This makes it possible to
 	// temporarily (during development) switch to a local version.
 	Path compiler.Path `yaml:"path,omitempty"`
+	// Fields that aren't known to this version of the package manager.
+	Extra map[string]interface{} `yaml:",inline"`
 }
 
-// TODO (jesper): Parse and WriteYAML should preserve comments.
+// Parse parses the given YAML into the receiver.
+// The YAML document is kept, so that WriteYAML can preserve comments and
+// formatting.
 func (s *Spec) Parse(b []byte, ui UI) error {
 	if err := yaml.Unmarshal(b, s); err != nil {
-		return ui.ReportError("Failed to parse app specification: %w", err)
+		loc := Location{File: s.path, Line: yamlErrorLine(err)}
+		return reportSpecErrorAt(ui, loc, "Failed to parse app specification: %v", err)
 	}
+	s.doc = parseSpecDocument(b)
+
+	s.reportUnknownFields(ui)
 
 	if err := s.Validate(ui); err != nil {
 		if !IsErrAlreadyReported(err) {
-			return ui.ReportError("Failed to parse app specification: %w", err)
+			return reportSpecError(ui, s.path, "Failed to parse app specification: %v", err)
+		}
+		var specErr *InvalidSpecError
+		if errors.As(err, &specErr) && specErr.Path == "" {
+			specErr.Path = s.path
 		}
 		return err
 	}
@@ -80,32 +139,170 @@ func (s *Spec) Parse(b []byte, ui UI) error {
 	return nil
 }
 
+// reportUnknownFields warns about fields that aren't known. They are frequently
+// typos, like 'dependancies'.
+func (s *Spec) reportUnknownFields(ui UI) {
+	location := ""
+	if s.path != "" {
+		location = fmt.Sprintf(" in '%s'", s.path)
+	}
+	for _, key := range sortedKeys(s.Extra) {
+		reportWarningAt(ui, s.location(key), "Unknown field '%s'%s", key, location)
+	}
+	allDeps := s.allDeps()
+	prefixes := []string{}
+	for prefix := range allDeps {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+	for _, prefix := range prefixes {
+		depsKey := "dependencies"
+		if _, ok := s.Deps[prefix]; !ok {
+			depsKey = "dev_dependencies"
+		}
+		for _, key := range sortedKeys(allDeps[prefix].Extra) {
+			loc := s.location(depsKey, prefix, key)
+			reportWarningAt(ui, loc, "Unknown field '%s' for dependency '%s'%s", key, prefix, location)
+		}
+	}
+}
+
+// location returns the location of the entry at the given path of keys.
+// The line is only known if the spec was parsed from YAML.
+func (s *Spec) location(keys ...string) Location {
+	return Location{
+		File: s.path,
+		Line: s.doc.line(keys...),
+	}
+}
+
+// yamlErrorLineRegexp matches the line number in the errors of the YAML
+// parser. For example "yaml: line 3: mapping values are not allowed".
+var yamlErrorLineRegexp = regexp.MustCompile(`line (\d+):`)
+
+// yamlErrorLine returns the line of the given YAML error, or 0 if the
+// error doesn't have one.
+func yamlErrorLine(err error) int {
+	match := yamlErrorLineRegexp.FindStringSubmatch(err.Error())
+	if match == nil {
+		return 0
+	}
+	line, err := strconv.Atoi(match[1])
+	if err != nil {
+		return 0
+	}
+	return line
+}
+
+// allDeps returns the dependencies and the dev dependencies of the spec.
+// The dev dependencies are only relevant when the spec is the entry spec of
+// a project.
+func (s *Spec) allDeps() DependencyMap {
+	if len(s.DevDeps) == 0 {
+		return s.Deps
+	}
+	result := DependencyMap{}
+	for prefix, dep := range s.Deps {
+		result[prefix] = dep
+	}
+	for prefix, dep := range s.DevDeps {
+		result[prefix] = dep
+	}
+	return result
+}
+
+// overridden returns the dependency after applying the overrides of the spec.
+// Local path dependencies are never overridden.
+func (s *Spec) overridden(dep SpecPackage) SpecPackage {
+	if dep.Path != "" {
+		return dep
+	}
+	override, ok := s.Overrides[dep.URL]
+	if !ok {
+		return dep
+	}
+	if override.Path != "" {
+		return SpecPackage{
+			Path: override.Path,
+		}
+	}
+	result := dep
+	if override.URL != "" {
+		result.URL = override.URL
+	}
+	if override.Version != "" {
+		result.Version = override.Version
+	}
+	return result
+}
+
+// allKeywords returns the keywords and topics of the spec, without duplicates.
+func (s *Spec) allKeywords() []string {
+	var result []string
+	seen := set.String{}
+	for _, keyword := range append(append([]string{}, s.Keywords...), s.Topics...) {
+		if !seen.Contains(keyword) {
+			seen.Add(keyword)
+			result = append(result, keyword)
+		}
+	}
+	return result
+}
+
 func (s *Spec) ParseString(str string, ui UI) error {
 	return s.Parse([]byte(str), ui)
 }
 
 func (s *Spec) Validate(ui UI) error {
 	if s.Name != "" && !isValidName(s.Name) {
-		return ui.ReportError("Invalid name: '%s'", s.Name)
+		return reportSpecErrorAt(ui, s.location("name"), "Invalid name: '%s'", s.Name)
 	}
 	for prefix, dep := range s.Deps {
-		if err := validatePrefix(prefix, ui); err != nil {
+		loc := s.location("dependencies", prefix)
+		if err := validatePrefix(prefix, loc, ui); err != nil {
 			return err
 		}
-		if err := dep.Validate(prefix, ui); err != nil {
+		if err := dep.validateAt(prefix, loc, ui); err != nil {
 			return err
 		}
 	}
-	if s.Environment.SDK != "" {
-		sdk := s.Environment.SDK
-		if !strings.HasPrefix(sdk, "^") {
-			return ui.ReportError("SDK constraint must be of form '^version': '%s'", sdk)
+	for prefix, dep := range s.DevDeps {
+		loc := s.location("dev_dependencies", prefix)
+		if _, ok := s.Deps[prefix]; ok {
+			return reportSpecErrorAt(ui, loc, "Prefix '%s' is both a dependency and a dev dependency", prefix)
 		}
-		_, err := parseConstraintRange(sdk[1:], semverRange)
-		if err != nil {
-			return ui.ReportError("Invalid SDK constraint '%s'", sdk)
+		if err := validatePrefix(prefix, loc, ui); err != nil {
+			return err
+		}
+		if err := dep.validateAt(prefix, loc, ui); err != nil {
+			return err
+		}
+	}
+	for url, override := range s.Overrides {
+		if err := override.validateOverride(url, s.path, ui); err != nil {
+			return err
+		}
+	}
+	if s.Workspace != nil {
+		if err := s.Workspace.validate(s.path, ui); err != nil {
+			return err
+		}
+	}
+	if s.Version != "" {
+		// Only 'pkg lint' and the publication (which compares the version with
+		// the tag) require a full semantic version.
+		if _, err := version.NewVersion(s.Version); err != nil {
+			return reportSpecErrorAt(ui, s.location("version"), "Invalid version: '%s'", s.Version)
 		}
 	}
+	for _, target := range s.Environment.Targets {
+		if !isValidTarget(target) {
+			return reportSpecErrorAt(ui, s.location("environment", "targets"), "Invalid target: '%s'", target)
+		}
+	}
+	if _, err := parseSDKConstraint(s.Environment.SDK); err != nil {
+		return reportSpecErrorAt(ui, s.location("environment", "sdk"), "Invalid SDK constraint '%s': %v", s.Environment.SDK, err)
+	}
 	return nil
 }
 
@@ -129,7 +326,13 @@ func ReadSpec(path string, ui UI) (*Spec, error) {
 	return &spec, nil
 }
 
+// WriteYAML writes the spec as YAML.
+// If the spec was parsed, only the modified entries of the original document
+// are changed. Comments, key order, and unknown fields are preserved.
 func (s *Spec) WriteYAML(writer io.Writer) error {
+	if s.doc != nil {
+		return s.doc.write(s, writer)
+	}
 	return yaml.NewEncoder(writer).Encode(s)
 }
 
@@ -154,10 +357,12 @@ func (s *Spec) BuildLockFile(solution *Solution, cache Cache, registries Registr
 		sdkMin = "^" + solution.minSDK.String()
 	}
 	result := LockFile{
-		path:     lockPath,
-		SDK:      sdkMin,
-		Prefixes: nil, // Will be overwritten.
-		Packages: map[string]PackageEntry{},
+		path:      lockPath,
+		SDK:       sdkMin,
+		Targets:   projectTargets(s.Environment.Targets),
+		Overrides: lockOverrides(s.Overrides),
+		Prefixes:  nil, // Will be overwritten.
+		Packages:  map[string]PackageEntry{},
 	}
 
 	// Map from URL/version to pkg-id.
@@ -171,22 +376,53 @@ func (s *Spec) BuildLockFile(solution *Solution, cache Cache, registries Registr
 		}
 	}
 
-	// buildPrefixes only handles uri dependencies.
+	// Local pkgs are only allowed in the entry packager, or in local packages that
+	// have been referenced through local dependencies or overrides. As such, a
+	// `visitLocalDeps` captures all of them.
+	localPkgIDs := map[string]string{}
+	localPkgIDFor := func(fullPath string) string {
+		pkgID, ok := localPkgIDs[fullPath]
+		if !ok {
+			pkgID = fmt.Sprintf("localPkg%d", idCounter)
+			localPkgIDs[fullPath] = pkgID
+			idCounter++
+		}
+		return pkgID
+	}
+
+	entryDir := filepath.Clean(filepath.Dir(s.path))
+	memberDirs, err := s.workspaceMemberDirs()
+	if err != nil {
+		return nil, err
+	}
+
+	// buildPrefixes only handles uri dependencies, and dependencies that are
+	// overridden by local packages.
 	// Local dependencies are done in a separate step.
-	buildPrefixes := func(spec *Spec, localDepsAllowed bool) (PrefixMap, error) {
+	buildPrefixes := func(spec *Spec, fullDir string, localDepsAllowed bool) (PrefixMap, error) {
 		if spec == nil {
 			return PrefixMap{}, nil
 		}
-		dm := spec.Deps
+		dm := s.resolvedDeps(spec, fullDir, memberDirs)
 		prefixes := PrefixMap{}
 		for prefix, specPkg := range dm {
 			if specPkg.Path != "" {
 				if !localDepsAllowed {
-					return nil, ui.ReportError("Path dependency '%s: %s'not allowed in '%s'", prefix, specPkg.Path, spec.path)
+					return nil, reportSpecError(ui, spec.path, "Path dependency '%s: %s'not allowed in '%s'", prefix, specPkg.Path, spec.path)
 				}
 				// Local dependencies are done later.
 				continue
 			}
+			specPkg = s.overridden(specPkg)
+			if specPkg.Path != "" {
+				// Paths of overrides are relative to the entry spec.
+				fullPath := specPkg.Path.FilePath()
+				if !filepath.IsAbs(fullPath) {
+					fullPath = filepath.Join(entryDir, fullPath)
+				}
+				prefixes[prefix] = localPkgIDFor(filepath.Clean(fullPath))
+				continue
+			}
 			version, err := solution.versionFor(specPkg.URL, specPkg.Version, ui)
 			if err != nil {
 				return nil, err
@@ -197,7 +433,7 @@ func (s *Spec) BuildLockFile(solution *Solution, cache Cache, registries Registr
 	}
 
 	// We assume that the current specification is the "entry" specification.
-	entryPrefixes, err := buildPrefixes(s, true)
+	entryPrefixes, err := buildPrefixes(s, entryDir, true)
 	if err != nil {
 		return nil, err
 	}
@@ -221,31 +457,34 @@ func (s *Spec) BuildLockFile(solution *Solution, cache Cache, registries Registr
 				// This should only fail for local dependencies.
 				name, _ = registries.nameFor(url, version)
 			}
-			prefixes, err := buildPrefixes(depSpec, true)
+			// Packages from the cache are never workspace members.
+			prefixes, err := buildPrefixes(depSpec, "", true)
 			if err != nil {
 				return nil, err
 			}
 			// If we can't find the hash we just use "".
 			hash, _ := registries.hashFor(url, version)
+			ref := ""
+			if gitRef, ok := solution.gitRefs[url]; ok {
+				hash = gitRef.hash
+				ref = gitRef.ref
+			}
 			result.Packages[pkgID] = PackageEntry{
 				URL:      compiler.ToURIPath(url),
 				Name:     name,
 				Version:  version,
+				Ref:      ref,
 				Hash:     hash,
 				Prefixes: prefixes,
 			}
 		}
 	}
 
-	// Local pkgs are only allowed in the entry packager, or in local packages that
-	// have been referenced through local dependencies. As such, a `visitLocalDeps`
-	// captures all of them.
-	localPkgIDs := map[string]string{}
-
-	addLocalDependencies := func(s *Spec, prefixes PrefixMap) {
-		dir := filepath.Dir(s.path)
+	addLocalDependencies := func(spec *Spec, fullDir string, prefixes PrefixMap) {
+		dir := filepath.Dir(spec.path)
+		deps := s.resolvedDeps(spec, fullDir, memberDirs)
 		// Go through the dependencies again and find local deps.
-		for prefix, specPkg := range s.Deps {
+		for prefix, specPkg := range deps {
 			if specPkg.Path == "" {
 				continue
 			}
@@ -254,39 +493,26 @@ func (s *Spec) BuildLockFile(solution *Solution, cache Cache, registries Registr
 			if !filepath.IsAbs(fullPath) {
 				fullPath = filepath.Join(dir, p)
 			}
-			fullPath = filepath.Clean(fullPath)
-			targetID, ok := localPkgIDs[fullPath]
-			if !ok {
-				targetID = fmt.Sprintf("localPkg%d", idCounter)
-				localPkgIDs[fullPath] = targetID
-				idCounter++
-			}
-			prefixes[prefix] = targetID
+			prefixes[prefix] = localPkgIDFor(filepath.Clean(fullPath))
 		}
 	}
 
-	addLocalDependencies(s, entryPrefixes)
+	addLocalDependencies(s, entryDir, entryPrefixes)
 
 	err = s.visitLocalDeps(ui, func(pkgPath string, fullPath string, depSpec *Spec) error {
 		if pkgPath == "" {
 			// Entry spec is already done.
 			return nil
 		}
-		pkgID, ok := localPkgIDs[fullPath]
 		// When the package was used as a target for a dependency we already added the id.
-		if !ok {
-			// First time we see this local package.
-			pkgID = fmt.Sprintf("localPkg%d", idCounter)
-			localPkgIDs[fullPath] = pkgID
-			idCounter++
-		}
-		prefixes, err := buildPrefixes(depSpec, true)
+		pkgID := localPkgIDFor(fullPath)
+		prefixes, err := buildPrefixes(depSpec, fullPath, true)
 		if err != nil {
 			return err
 		}
 
 		if depSpec != nil {
-			addLocalDependencies(depSpec, prefixes)
+			addLocalDependencies(depSpec, fullPath, prefixes)
 		}
 		result.Packages[pkgID] = PackageEntry{
 			Path:     compiler.ToPath(pkgPath),
@@ -303,7 +529,8 @@ func (s *Spec) BuildLockFile(solution *Solution, cache Cache, registries Registr
 	return &result, nil
 }
 
-// visitLocalDeps visits all local dependencies of this spec.
+// visitLocalDeps visits all local dependencies of this spec, including the
+// local packages of overrides and the members of the workspace.
 // Starts by invoking the callback for the given spec, with pkgPath "".
 // Then: for each local dependency it invokes the callback 'cb' with the path of the package,
 // and its spec file. The 'depSpec' may be nil if the package doesn't have a spec file.
@@ -316,10 +543,35 @@ func (s *Spec) BuildLockFile(solution *Solution, cache Cache, registries Registr
 // this specification).
 func (s *Spec) visitLocalDeps(ui UI, cb func(pkgPath string, fullPath string, depSpec *Spec) error) error {
 	entryDir := filepath.Clean(filepath.Dir(s.path))
+	members, err := s.workspaceMembers()
+	if err != nil {
+		return err
+	}
+	memberDirs, err := s.workspaceMemberDirs()
+	if err != nil {
+		return err
+	}
 	alreadyVisited := set.String{}
-	var visit func(spec *Spec) error
-	visit = func(spec *Spec) error {
-		for _, dep := range spec.Deps {
+	var visit func(spec *Spec, fullDir string) error
+	visit = func(spec *Spec, fullDir string) error {
+		deps := []SpecPackage{}
+		for _, dep := range s.resolvedDeps(spec, fullDir, memberDirs) {
+			deps = append(deps, dep)
+		}
+		if spec == s {
+			// Overrides and workspace members are only used for the entry spec.
+			for _, override := range s.Overrides {
+				if override.Path != "" {
+					deps = append(deps, override)
+				}
+			}
+			for _, member := range members {
+				deps = append(deps, SpecPackage{
+					Path: compiler.ToPath(member),
+				})
+			}
+		}
+		for _, dep := range deps {
 			if dep.Path == "" {
 				continue
 			}
@@ -377,7 +629,7 @@ func (s *Spec) visitLocalDeps(ui UI, cb func(pkgPath string, fullPath string, de
 				}
 				depSpec.path = filepath.Join(pkgPath, DefaultSpecName)
 				// Recursively find more local specs.
-				err = visit(depSpec)
+				err = visit(depSpec, fullPath)
 				if err != nil {
 					return err
 				}
@@ -390,12 +642,93 @@ func (s *Spec) visitLocalDeps(ui UI, cb func(pkgPath string, fullPath string, de
 		}
 		return nil
 	}
-	err := cb("", entryDir, s)
+	err = cb("", entryDir, s)
 	alreadyVisited.Add(entryDir)
 	if err != nil {
 		return err
 	}
-	return visit(s)
+	return visit(s, entryDir)
+}
+
+// localDepsChanged returns whether the local packages of the spec (local
+// dependencies, local overrides, and workspace members), or their
+// dependencies, differ from the ones in the lock file.
+// Dependencies are unchanged if the locked package still satisfies them.
+func (s *Spec) localDepsChanged(lf *LockFile, ui UI) (bool, error) {
+	memberDirs, err := s.workspaceMemberDirs()
+	if err != nil {
+		return false, err
+	}
+	localEntries := map[string]PackageEntry{}
+	for _, pe := range lf.Packages {
+		if pe.Path != "" {
+			localEntries[filepath.Clean(pe.Path.FilePath())] = pe
+		}
+	}
+	visited := set.String{}
+	changed := false
+	err = s.visitLocalDeps(ui, func(pkgPath string, fullPath string, depSpec *Spec) error {
+		if changed {
+			return nil
+		}
+		prefixes := lf.Prefixes
+		if pkgPath != "" {
+			pe, ok := localEntries[pkgPath]
+			if !ok {
+				changed = true
+				return nil
+			}
+			visited.Add(pkgPath)
+			prefixes = pe.Prefixes
+		}
+		deps := DependencyMap{}
+		if depSpec != nil {
+			deps = s.resolvedDeps(depSpec, fullPath, memberDirs)
+		}
+		if len(deps) != len(prefixes) {
+			changed = true
+			return nil
+		}
+		for prefix, dep := range deps {
+			locked, ok := lf.Packages[prefixes[prefix]]
+			if !ok || !s.isSatisfiedBy(dep, locked) {
+				changed = true
+				return nil
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return changed || len(visited.Values()) != len(localEntries), nil
+}
+
+// isSatisfiedBy returns whether the locked package satisfies the given
+// dependency, after applying the overrides of the spec.
+func (s *Spec) isSatisfiedBy(dep SpecPackage, locked PackageEntry) bool {
+	dep = s.overridden(dep)
+	if dep.Path != "" {
+		return locked.Path != ""
+	}
+	if locked.URL.URL() != dep.URL {
+		return false
+	}
+	if dep.Ref != "" {
+		return locked.Ref == dep.Ref
+	}
+	if dep.Version == "" {
+		return true
+	}
+	constraints, err := parseConstraint(dep.Version)
+	if err != nil {
+		return false
+	}
+	v, err := version.NewVersion(locked.Version)
+	if err != nil {
+		return false
+	}
+	return constraints.Check(v)
 }
 
 func (s *Spec) addDep(prefix string, url string, version string, p string, ui UI) error {
@@ -407,7 +740,7 @@ func (s *Spec) addDep(prefix string, url string, version string, p string, ui UI
 	if !isValidName(prefix) {
 		return ui.ReportError("Invalid prefix: '%s'", prefix)
 	}
-	if _, ok := s.Deps[prefix]; ok {
+	if _, ok := s.allDeps()[prefix]; ok {
 		return ui.ReportError("Project has already a package with prefix '%s'", prefix)
 
 	}
@@ -427,29 +760,73 @@ func isValidName(prefix string) bool {
 }
 
 // TODO(florian): create a Prefix type.
-func validatePrefix(prefix string, ui UI) error {
+func validatePrefix(prefix string, loc Location, ui UI) error {
 	if !isValidName(prefix) {
-		return ui.ReportError("Invalid prefix: '%s'", prefix)
+		return reportSpecErrorAt(ui, loc, "Invalid prefix: '%s'", prefix)
 	}
 	return nil
 }
 
 func (sp *SpecPackage) Validate(prefix string, ui UI) error {
+	return sp.validateAt(prefix, Location{}, ui)
+}
+
+// validateAt is like Validate, but reports the problems at the given
+// location.
+func (sp *SpecPackage) validateAt(prefix string, loc Location, ui UI) error {
 	if sp.URL == "" && sp.Path == "" {
-		return ui.ReportError("Package entry for prefix '%s' is missing 'url' or 'path'", prefix)
+		return reportSpecErrorAt(ui, loc, "Package entry for prefix '%s' is missing 'url' or 'path'", prefix)
 	}
 	if sp.URL == "" && sp.Version != "" {
-		ui.ReportWarning("Package entry for prefix '%s' has version constraint but no URL", prefix)
+		reportWarningAt(ui, loc, "Package entry for prefix '%s' has version constraint but no URL", prefix)
+	}
+	if sp.Ref != "" {
+		if sp.URL == "" {
+			return reportSpecErrorAt(ui, loc, "Package entry for prefix '%s' has a git reference but no URL", prefix)
+		}
+		if sp.Version != "" {
+			return reportSpecErrorAt(ui, loc, "Package entry for prefix '%s' can't have both a version constraint and a git reference", prefix)
+		}
+	}
+	if sp.Version != "" {
+		if _, err := parseConstraint(sp.Version); err != nil {
+			return reportSpecErrorAt(ui, loc, "Package entry for prefix '%s' has invalid version constraint: '%s': %v", prefix, sp.Version, err)
+		}
+	}
+	return nil
+}
+
+// validateOverride validates the receiver as override for the given URL.
+func (sp *SpecPackage) validateOverride(url string, specPath string, ui UI) error {
+	if url == "" {
+		return reportSpecError(ui, specPath, "Override without URL")
+	}
+	if sp.Ref != "" {
+		// Overrides are applied by the solver, which only knows about registry
+		// packages. Git references are resolved before solving.
+		return reportSpecError(ui, specPath, "Override for '%s' can't have a 'ref'. Use a dependency with a 'ref' instead", url)
+	}
+	if sp.URL == "" && sp.Version == "" && sp.Path == "" {
+		return reportSpecError(ui, specPath, "Override for '%s' is missing 'url', 'version' or 'path'", url)
+	}
+	if sp.Path != "" && (sp.URL != "" || sp.Version != "") {
+		return reportSpecError(ui, specPath, "Override for '%s' can't have a 'path' together with a 'url' or 'version'", url)
 	}
 	if sp.Version != "" {
 		if _, err := parseConstraint(sp.Version); err != nil {
-			return ui.ReportError("Package entry for prefix '%s' has invalid version constraint: '%s'", prefix, sp.Version)
+			return reportSpecError(ui, specPath, "Override for '%s' has invalid version constraint: '%s': %v", url, sp.Version, err)
 		}
 	}
 	return nil
 }
 
 func (pe PackageEntry) toSpecPackage() SpecPackage {
+	if pe.Ref != "" {
+		return SpecPackage{
+			URL: pe.URL.URL(),
+			Ref: pe.Ref,
+		}
+	}
 	version := pe.Version
 	if version != "" {
 		version = "^" + version
@@ -488,11 +865,16 @@ func NewSpecFromLockFile(lf *LockFile) (*Spec, error) {
 // This involves looking into spec files of local dependencies.
 func (s *Spec) BuildSolverDeps(ui UI) ([]SolverDep, error) {
 	result := []SolverDep{}
-	err := s.visitLocalDeps(ui, func(pkgPath string, _ string, depSpec *Spec) error {
+	memberDirs, err := s.workspaceMemberDirs()
+	if err != nil {
+		return nil, err
+	}
+	err = s.visitLocalDeps(ui, func(pkgPath string, fullPath string, depSpec *Spec) error {
 		if depSpec == nil {
 			return nil
 		}
-		for _, dep := range depSpec.Deps {
+		deps := s.resolvedDeps(depSpec, fullPath, memberDirs)
+		for _, dep := range deps {
 			if dep.Path != "" {
 				continue
 			}
@@ -16,6 +16,7 @@
 package tpkg
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -173,7 +174,7 @@ dependencies:
 `, ui)
 			assert.True(t, IsErrAlreadyReported(err))
 			assert.Len(t, ui.messages, 1)
-			assert.Equal(t, "Error: Package entry for prefix 'invalid_constraint' has invalid version constraint: 'not a constraint'", ui.messages[0])
+			assert.Equal(t, "Error: Package entry for prefix 'invalid_constraint' has invalid version constraint: 'not a constraint': invalid version 'not a constraint'", ui.messages[0])
 		})
 
 		t.Run("invalid prefix space", func(t *testing.T) {
@@ -204,6 +205,30 @@ dependencies:
 			assert.Equal(t, "Error: Invalid prefix: '0invalid-prefix'", ui.messages[0])
 		})
 
+		t.Run("invalid version", func(t *testing.T) {
+			ui := &testUI{}
+			var spec Spec
+			err := spec.ParseString(`
+name: foo
+version: 1.0.foo
+`, ui)
+			assert.True(t, IsErrAlreadyReported(err))
+			assert.Len(t, ui.messages, 1)
+			assert.Equal(t, "Error: Invalid version: '1.0.foo'", ui.messages[0])
+		})
+
+		t.Run("lenient version", func(t *testing.T) {
+			// Only 'pkg lint' requires a full semantic version.
+			for _, v := range []string{"1.0", "v1.2.3"} {
+				ui := &testUI{}
+				var spec Spec
+				err := spec.ParseString("name: foo\nversion: "+v+"\n", ui)
+				assert.NoError(t, err)
+				assert.Empty(t, ui.messages)
+				assert.Equal(t, v, spec.Version)
+			}
+		})
+
 	})
 }
 
@@ -508,10 +533,12 @@ func Test_SpecToLock(t *testing.T) {
 				Path: "local_path2",
 			},
 		})
+		spec.Environment.Targets = []string{"host", "esp32*"}
 		solution := &Solution{}
 		lf, err := spec.BuildLockFile(solution, tsc.c, Registries{}, &ui)
 		require.NoError(t, err)
 		assert.Equal(t, filepath.Join(tsc.dir, DefaultLockFileName), lf.path)
+		assert.Equal(t, []string{"host"}, lf.Targets)
 		assert.Equal(t, 2, len(lf.Prefixes))
 		assert.Equal(t, 2, len(lf.Packages))
 		pkgID, ok := lf.Prefixes["prefix0"]
@@ -598,3 +625,492 @@ func Test_SpecToLock(t *testing.T) {
 		assert.Equal(t, 0, len(pkgEntry.Prefixes))
 	})
 }
+
+func Test_WriteYAML(t *testing.T) {
+	original := `# The package file of foo.
+name: foo  # The name.
+description: 'Some description'
+custom_field:
+  - unknown
+dependencies:
+  # A comment for bar.
+  bar:
+    url: github.com/foo/bar
+    version: "^1.0.0"  # Pinned major.
+  gee:
+    path: ../gee
+  removed:
+    url: github.com/foo/removed
+    version: ^2.0.0
+`
+
+	parse := func(t *testing.T) *Spec {
+		ui := &testUI{}
+		spec := &Spec{}
+		err := spec.ParseString(original, ui)
+		require.NoError(t, err)
+		return spec
+	}
+
+	write := func(t *testing.T, spec *Spec) string {
+		var b bytes.Buffer
+		err := spec.WriteYAML(&b)
+		require.NoError(t, err)
+		return b.String()
+	}
+
+	t.Run("Unchanged", func(t *testing.T) {
+		spec := parse(t)
+		assert.Equal(t, original, write(t, spec))
+	})
+
+	t.Run("Modified", func(t *testing.T) {
+		spec := parse(t)
+		bar := spec.Deps["bar"]
+		bar.Version = "^1.2.0"
+		spec.Deps["bar"] = bar
+		delete(spec.Deps, "removed")
+		err := spec.addDep("added", "github.com/foo/added", "^3.0.0", "", &testUI{})
+		require.NoError(t, err)
+
+		expected := `# The package file of foo.
+name: foo # The name.
+description: 'Some description'
+custom_field:
+  - unknown
+dependencies:
+  # A comment for bar.
+  bar:
+    url: github.com/foo/bar
+    version: "^1.2.0" # Pinned major.
+  gee:
+    path: ../gee
+  added:
+    url: github.com/foo/added
+    version: ^3.0.0
+`
+		assert.Equal(t, expected, write(t, spec))
+
+		// The written spec parses to the same values.
+		reparsed := &Spec{}
+		err = reparsed.ParseString(expected, &testUI{})
+		require.NoError(t, err)
+		assert.Equal(t, spec.Deps, reparsed.Deps)
+	})
+
+	t.Run("Remove all dependencies", func(t *testing.T) {
+		spec := parse(t)
+		spec.Deps = DependencyMap{}
+		expected := `# The package file of foo.
+name: foo # The name.
+description: 'Some description'
+custom_field:
+  - unknown
+`
+		assert.Equal(t, expected, write(t, spec))
+	})
+
+	t.Run("Empty dependencies", func(t *testing.T) {
+		ui := &testUI{}
+		spec := &Spec{}
+		err := spec.ParseString("name: foo\ndependencies:\n", ui)
+		require.NoError(t, err)
+		err = spec.addDep("bar", "github.com/foo/bar", "^1.0.0", "", ui)
+		require.NoError(t, err)
+		expected := `name: foo
+dependencies:
+  bar:
+    url: github.com/foo/bar
+    version: ^1.0.0
+`
+		assert.Equal(t, expected, write(t, spec))
+	})
+}
+
+func Test_SpecUnknownFields(t *testing.T) {
+	ui := &testUI{}
+	spec := &Spec{}
+	err := spec.ParseString(`name: foo
+dependancies:
+  bar:
+    url: github.com/foo/bar
+dependencies:
+  gee:
+    url: github.com/foo/gee
+    mirror: github.com/other/gee
+`, ui)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"Warning: Unknown field 'dependancies'",
+		"Warning: Unknown field 'mirror' for dependency 'gee'",
+	}, ui.messages)
+
+	t.Run("Without document", func(t *testing.T) {
+		// Unknown fields are kept even if the spec is encoded from scratch.
+		spec.doc = nil
+		var b bytes.Buffer
+		err := spec.WriteYAML(&b)
+		require.NoError(t, err)
+
+		reparsed := &Spec{}
+		err = reparsed.ParseString(b.String(), &testUI{})
+		require.NoError(t, err)
+		assert.Equal(t, spec.Extra, reparsed.Extra)
+		assert.Equal(t, "github.com/other/gee", reparsed.Deps["gee"].Extra["mirror"])
+	})
+}
+
+func Test_DevDependencies(t *testing.T) {
+	t.Run("Lock", func(t *testing.T) {
+		ui := testUI{}
+		tsc := newTestSpecCreator(t, &ui)
+		// The dev dependencies of the local helper must be ignored.
+		helper := tsc.createLocal("helper", "helper", []SpecPackage{})
+		helper.DevDeps = DependencyMap{
+			"helper_dev": {URL: "helper-dev-url", Version: "^1.0.0"},
+		}
+		require.NoError(t, helper.WriteToFile())
+
+		spec := tsc.createLocal("", "", []SpecPackage{
+			{URL: "simple-url", Version: "^1.0.0"},
+		})
+		spec.DevDeps = DependencyMap{
+			"test_helper": {Path: "helper"},
+			"bench":       {URL: "bench-url", Version: "^2.0.0"},
+		}
+		require.NoError(t, spec.WriteToFile())
+		tsc.createUri("simple_url", "simple-url", "1.0.0", []SpecPackage{})
+		tsc.createUri("bench", "bench-url", "2.0.0", []SpecPackage{})
+
+		solverDeps, err := spec.BuildSolverDeps(&ui)
+		require.NoError(t, err)
+		urls := []string{}
+		for _, dep := range solverDeps {
+			urls = append(urls, dep.url)
+		}
+		assert.ElementsMatch(t, []string{"simple-url", "bench-url"}, urls)
+
+		solution := &Solution{
+			pkgs: map[string][]StringVersion{
+				"simple-url": makeStringVersions(t, "1.0.0"),
+				"bench-url":  makeStringVersions(t, "2.0.0"),
+			},
+		}
+		lf, err := spec.BuildLockFile(solution, tsc.c, Registries{}, &ui)
+		require.NoError(t, err)
+		assert.Equal(t, 3, len(lf.Prefixes))
+		assert.Equal(t, 3, len(lf.Packages))
+		helperEntry := lf.Packages[lf.Prefixes["test_helper"]]
+		assert.Equal(t, "helper", helperEntry.Path.FilePath())
+		assert.Equal(t, 0, len(helperEntry.Prefixes))
+		benchEntry := lf.Packages[lf.Prefixes["bench"]]
+		assert.Equal(t, "bench-url", benchEntry.URL.URL())
+	})
+
+	t.Run("Description", func(t *testing.T) {
+		ui := testUI{}
+		tsc := newTestSpecCreator(t, &ui)
+		spec := tsc.createLocal("pkg", "pkg", []SpecPackage{
+			{URL: "simple-url", Version: "^1.0.0"},
+		})
+		spec.License = "MIT"
+		spec.DevDeps = DependencyMap{
+			"test_helper": {Path: "../helper"},
+		}
+		require.NoError(t, spec.WriteToFile())
+		require.NoError(t, os.MkdirAll(filepath.Join(tsc.dir, "pkg", "src"), 0755))
+
+		// Local dev dependencies don't prevent the description from being
+		// built, as they aren't part of it.
+		desc, err := ScrapeDescriptionAt(filepath.Join(tsc.dir, "pkg"), DisallowLocalDeps, false, &ui)
+		require.NoError(t, err)
+		require.Len(t, desc.Deps, 1)
+		assert.Equal(t, "simple-url", desc.Deps[0].URL)
+	})
+
+	t.Run("Conflict", func(t *testing.T) {
+		ui := testUI{}
+		spec := Spec{}
+		err := spec.ParseString(`
+dependencies:
+  foo:
+    url: github.com/foo/foo
+dev_dependencies:
+  foo:
+    url: github.com/foo/foo
+`, &ui)
+		assert.True(t, IsErrAlreadyReported(err))
+		assert.Equal(t, []string{"Error: Prefix 'foo' is both a dependency and a dev dependency"}, ui.messages)
+	})
+}
+
+func Test_Overrides(t *testing.T) {
+	t.Run("Lock", func(t *testing.T) {
+		ui := testUI{}
+		tsc := newTestSpecCreator(t, &ui)
+		tsc.createLocal("local_c", "local_c", []SpecPackage{})
+		spec := tsc.createLocal("", "", []SpecPackage{
+			{URL: "a-url", Version: "^1.0.0"},
+			{URL: "b-url", Version: "^1.0.0"},
+			{URL: "c-url", Version: "^1.0.0"},
+		})
+		spec.Overrides = DependencyMap{
+			"a-url": {Version: "2.0.0"},
+			"b-url": {URL: "fork-b-url"},
+			"c-url": {Path: "local_c"},
+		}
+		require.NoError(t, spec.WriteToFile())
+		tsc.createUri("a", "a-url", "2.0.0", []SpecPackage{})
+		tsc.createUri("b", "fork-b-url", "1.2.0", []SpecPackage{})
+
+		solution := &Solution{
+			pkgs: map[string][]StringVersion{
+				"a-url":      makeStringVersions(t, "2.0.0"),
+				"fork-b-url": makeStringVersions(t, "1.2.0"),
+			},
+		}
+		lf, err := spec.BuildLockFile(solution, tsc.c, Registries{}, &ui)
+		require.NoError(t, err)
+		assert.Empty(t, ui.messages)
+		assert.Equal(t, 3, len(lf.Prefixes))
+		assert.Equal(t, 3, len(lf.Packages))
+		aEntry := lf.Packages[lf.Prefixes["prefix0"]]
+		assert.Equal(t, "a-url", aEntry.URL.URL())
+		assert.Equal(t, "2.0.0", aEntry.Version)
+		bEntry := lf.Packages[lf.Prefixes["prefix1"]]
+		assert.Equal(t, "fork-b-url", bEntry.URL.URL())
+		cEntry := lf.Packages[lf.Prefixes["prefix2"]]
+		assert.Equal(t, "local_c", cEntry.Path.FilePath())
+
+		// The overrides are recorded, so that installing only needs to solve
+		// again when they change.
+		assert.Equal(t, map[string]LockOverride{
+			"a-url": {Version: "2.0.0"},
+			"b-url": {URL: "fork-b-url"},
+			"c-url": {Path: "local_c"},
+		}, lf.Overrides)
+		assert.True(t, sameOverrides(spec.Overrides, lf.Overrides))
+		spec.Overrides["a-url"] = SpecPackage{Version: "2.1.0"}
+		assert.False(t, sameOverrides(spec.Overrides, lf.Overrides))
+		delete(spec.Overrides, "a-url")
+		assert.False(t, sameOverrides(spec.Overrides, lf.Overrides))
+		assert.True(t, sameOverrides(nil, nil))
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		tests := []struct {
+			yaml     string
+			expected string
+		}{
+			{
+				yaml: `
+overrides:
+  github.com/foo/foo:
+    version: 1.0.0
+    path: ../foo
+`,
+				expected: "Error: Override for 'github.com/foo/foo' can't have a 'path' together with a 'url' or 'version'",
+			},
+			{
+				yaml: `
+overrides:
+  github.com/foo/foo: {}
+`,
+				expected: "Error: Override for 'github.com/foo/foo' is missing 'url', 'version' or 'path'",
+			},
+			{
+				yaml: `
+overrides:
+  github.com/foo/foo:
+    version: not-a-version
+`,
+				expected: "Error: Override for 'github.com/foo/foo' has invalid version constraint: 'not-a-version': invalid version 'not-a-version'",
+			},
+			{
+				yaml: `
+overrides:
+  github.com/foo/foo:
+    url: github.com/fork/foo
+    ref: main
+`,
+				expected: "Error: Override for 'github.com/foo/foo' can't have a 'ref'. Use a dependency with a 'ref' instead",
+			},
+			{
+				yaml: `
+overrides:
+  github.com/foo/foo:
+    ref: main
+`,
+				expected: "Error: Override for 'github.com/foo/foo' can't have a 'ref'. Use a dependency with a 'ref' instead",
+			},
+		}
+		for _, test := range tests {
+			ui := testUI{}
+			spec := Spec{}
+			err := spec.ParseString(test.yaml, &ui)
+			assert.True(t, IsErrAlreadyReported(err))
+			assert.Equal(t, []string{test.expected}, ui.messages)
+		}
+	})
+}
+
+func Test_Workspace(t *testing.T) {
+	createWorkspace := func(t *testing.T, ui *testUI) (testSpecCreator, Spec) {
+		tsc := newTestSpecCreator(t, ui)
+		tsc.createLocal("a", filepath.Join("packages", "a"), []SpecPackage{
+			{URL: "shared-url", Version: "^1.0.0"},
+			{Path: "../b"},
+		})
+		b := tsc.createLocal("b", filepath.Join("packages", "b"), []SpecPackage{
+			{URL: "shared-url", Version: "^1.1.0"},
+		})
+		b.DevDeps = DependencyMap{
+			"test_helper": {URL: "test-url", Version: "^1.0.0"},
+		}
+		require.NoError(t, b.WriteToFile())
+		// Directories without package file don't match the pattern.
+		require.NoError(t, os.MkdirAll(filepath.Join(tsc.dir, "packages", "docs"), 0755))
+
+		spec := tsc.createLocal("", "", []SpecPackage{})
+		spec.Workspace = &SpecWorkspace{
+			Members: []string{"packages/*"},
+		}
+		require.NoError(t, spec.WriteToFile())
+		tsc.createUri("shared", "shared-url", "1.2.0", []SpecPackage{})
+		tsc.createUri("test", "test-url", "1.0.0", []SpecPackage{})
+		return tsc, spec
+	}
+
+	t.Run("Members", func(t *testing.T) {
+		ui := testUI{}
+		_, spec := createWorkspace(t, &ui)
+		members, err := spec.workspaceMembers()
+		require.NoError(t, err)
+		assert.Equal(t, []string{filepath.Join("packages", "a"), filepath.Join("packages", "b")}, members)
+	})
+
+	t.Run("Lock", func(t *testing.T) {
+		ui := testUI{}
+		tsc, spec := createWorkspace(t, &ui)
+
+		solverDeps, err := spec.BuildSolverDeps(&ui)
+		require.NoError(t, err)
+		urls := []string{}
+		for _, dep := range solverDeps {
+			urls = append(urls, dep.url)
+		}
+		// The dev dependencies of members are resolved.
+		assert.ElementsMatch(t, []string{"shared-url", "shared-url", "test-url"}, urls)
+
+		solution := &Solution{
+			pkgs: map[string][]StringVersion{
+				"shared-url": makeStringVersions(t, "1.2.0"),
+				"test-url":   makeStringVersions(t, "1.0.0"),
+			},
+		}
+		lf, err := spec.BuildLockFile(solution, tsc.c, Registries{}, &ui)
+		require.NoError(t, err)
+		assert.Empty(t, ui.messages)
+		assert.Equal(t, 0, len(lf.Prefixes))
+		assert.Equal(t, 4, len(lf.Packages))
+
+		entries := map[string]PackageEntry{}
+		for _, entry := range lf.Packages {
+			if entry.Path != "" {
+				entries[entry.Path.FilePath()] = entry
+			}
+		}
+		aEntry := entries[filepath.Join("packages", "a")]
+		bEntry := entries[filepath.Join("packages", "b")]
+		// Both members use the same version of the shared package.
+		assert.Equal(t, aEntry.Prefixes["prefix0"], bEntry.Prefixes["prefix0"])
+		assert.Equal(t, "shared-url", lf.Packages[aEntry.Prefixes["prefix0"]].URL.URL())
+		assert.Equal(t, bEntry, lf.Packages[aEntry.Prefixes["prefix1"]])
+		assert.Equal(t, "test-url", lf.Packages[bEntry.Prefixes["test_helper"]].URL.URL())
+	})
+
+	t.Run("Changed", func(t *testing.T) {
+		ui := testUI{}
+		tsc, spec := createWorkspace(t, &ui)
+		solution := &Solution{
+			pkgs: map[string][]StringVersion{
+				"shared-url": makeStringVersions(t, "1.2.0"),
+				"test-url":   makeStringVersions(t, "1.0.0"),
+			},
+		}
+		lf, err := spec.BuildLockFile(solution, tsc.c, Registries{}, &ui)
+		require.NoError(t, err)
+		changed, err := spec.localDepsChanged(lf, &ui)
+		require.NoError(t, err)
+		assert.False(t, changed)
+
+		// A constraint that the locked version still satisfies.
+		tsc.createLocal("b", filepath.Join("packages", "b"), []SpecPackage{
+			{URL: "shared-url", Version: "^1.2.0"},
+		})
+		b, err := ReadSpec(filepath.Join(tsc.dir, "packages", "b", DefaultSpecName), &ui)
+		require.NoError(t, err)
+		b.DevDeps = DependencyMap{
+			"test_helper": {URL: "test-url", Version: "^1.0.0"},
+		}
+		require.NoError(t, b.WriteToFile())
+		changed, err = spec.localDepsChanged(lf, &ui)
+		require.NoError(t, err)
+		assert.False(t, changed)
+
+		// A constraint that excludes the locked version.
+		b.Deps["prefix0"] = SpecPackage{URL: "shared-url", Version: "^1.3.0"}
+		require.NoError(t, b.WriteToFile())
+		changed, err = spec.localDepsChanged(lf, &ui)
+		require.NoError(t, err)
+		assert.True(t, changed)
+
+		// A new member.
+		b.Deps["prefix0"] = SpecPackage{URL: "shared-url", Version: "^1.1.0"}
+		require.NoError(t, b.WriteToFile())
+		tsc.createLocal("c", filepath.Join("packages", "c"), []SpecPackage{})
+		changed, err = spec.localDepsChanged(lf, &ui)
+		require.NoError(t, err)
+		assert.True(t, changed)
+
+		// A removed member.
+		require.NoError(t, os.RemoveAll(filepath.Join(tsc.dir, "packages", "c")))
+		require.NoError(t, os.RemoveAll(filepath.Join(tsc.dir, "packages", "b")))
+		changed, err = spec.localDepsChanged(lf, &ui)
+		require.NoError(t, err)
+		assert.True(t, changed)
+	})
+
+	t.Run("Root", func(t *testing.T) {
+		ui := testUI{}
+		tsc, _ := createWorkspace(t, &ui)
+		root, err := findWorkspaceRoot(filepath.Join(tsc.dir, "packages", "a"))
+		require.NoError(t, err)
+		assert.Equal(t, tsc.dir, root)
+
+		root, err = findWorkspaceRoot(filepath.Join(tsc.dir, "packages", "docs"))
+		require.NoError(t, err)
+		assert.Equal(t, "", root)
+
+		// A given project root is detected as member too.
+		memberDir := filepath.Join(tsc.dir, "packages", "a")
+		paths, err := NewProjectPaths(memberDir, "", "")
+		require.NoError(t, err)
+		assert.Equal(t, tsc.dir, paths.ProjectRootPath)
+		assert.Equal(t, memberDir, paths.WorkspaceMemberPath)
+		assert.Equal(t, filepath.Join(tsc.dir, DefaultLockFileName), paths.LockFile)
+		assert.Equal(t, filepath.Join(tsc.dir, DefaultSpecName), paths.SpecFile)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		ui := testUI{}
+		spec := Spec{}
+		err := spec.ParseString(`
+workspace:
+  members:
+    - /abs/path
+`, &ui)
+		assert.True(t, IsErrAlreadyReported(err))
+		assert.Equal(t, []string{"Error: Workspace member '/abs/path' must be a relative path"}, ui.messages)
+	})
+}
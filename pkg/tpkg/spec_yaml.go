@@ -0,0 +1,275 @@
+// Copyright (C) 2021 Toitware ApS.
+//
+// This library is free software; you can redistribute it and/or
+// modify it under the terms of the GNU Lesser General Public
+// License as published by the Free Software Foundation; version
+// 2.1 only.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Lesser General Public License for more details.
+//
+// The license can be found in the file `LICENSE` in the top level
+// directory of this repository.
+
+package tpkg
+
+import (
+	"bytes"
+	"io"
+	"sort"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// Spec files are written by users. When we modify them (for example when
+// installing a package), we edit the parsed YAML document instead of
+// re-encoding the Spec struct. Only the entries that changed are touched,
+// so that comments, the order of keys, the quoting of values, and fields
+// we don't know about are preserved.
+
+const strTag = "!!str"
+
+// specDocument is the parsed YAML of a spec file.
+type specDocument struct {
+	// The original bytes of the file.
+	raw []byte
+	// The document node. Its content is the top-level mapping.
+	root *yamlv3.Node
+}
+
+// parseSpecDocument parses the given bytes into a document that can be edited.
+// Returns nil if the bytes don't contain a top-level mapping (for example, if
+// the file is empty).
+func parseSpecDocument(b []byte) *specDocument {
+	var root yamlv3.Node
+	if err := yamlv3.Unmarshal(b, &root); err != nil {
+		return nil
+	}
+	if root.Kind != yamlv3.DocumentNode || len(root.Content) != 1 || root.Content[0].Kind != yamlv3.MappingNode {
+		return nil
+	}
+	return &specDocument{
+		raw:  b,
+		root: &root,
+	}
+}
+
+// write applies the values of the spec to the document and writes it.
+// If nothing changed, the original bytes are written unmodified.
+func (d *specDocument) write(s *Spec, writer io.Writer) error {
+	if !d.update(s) {
+		_, err := writer.Write(d.raw)
+		return err
+	}
+	var b bytes.Buffer
+	encoder := yamlv3.NewEncoder(&b)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(d.root); err != nil {
+		return err
+	}
+	if err := encoder.Close(); err != nil {
+		return err
+	}
+	d.raw = b.Bytes()
+	_, err := writer.Write(d.raw)
+	return err
+}
+
+// update applies the values of the spec to the document.
+// Returns whether the document changed.
+func (d *specDocument) update(s *Spec) bool {
+	mapping := d.root.Content[0]
+	changed := setMappingScalar(mapping, "name", s.Name)
+	changed = setMappingScalar(mapping, "description", s.Description) || changed
+	changed = setMappingScalar(mapping, "version", s.Version) || changed
+	changed = setMappingScalar(mapping, "license", s.License) || changed
+
+	if s.Environment.SDK == "" {
+		if env := mappingValue(mapping, "environment"); env != nil && env.Kind == yamlv3.MappingNode {
+			changed = setMappingScalar(env, "sdk", "") || changed
+		}
+	} else {
+		env, created := ensureMapping(mapping, "environment")
+		changed = setMappingScalar(env, "sdk", s.Environment.SDK) || created || changed
+	}
+
+	changed = updateDependencies(mapping, "dependencies", s.Deps) || changed
+	return updateDependencies(mapping, "dev_dependencies", s.DevDeps) || changed
+}
+
+// updateDependencies applies the given dependencies to the entry of the
+// mapping with the given key.
+// Existing entries are updated in place, removed dependencies are deleted, and
+// new dependencies are added at the end.
+func updateDependencies(mapping *yamlv3.Node, key string, deps DependencyMap) bool {
+	if len(deps) == 0 {
+		depsNode := mappingValue(mapping, key)
+		if depsNode == nil || depsNode.Kind != yamlv3.MappingNode || len(depsNode.Content) == 0 {
+			// Either no entry, or already empty. Don't touch it.
+			return false
+		}
+		return removeMappingKey(mapping, key)
+	}
+
+	depsNode, changed := ensureMapping(mapping, key)
+
+	existing := map[string]bool{}
+	content := depsNode.Content[:0:0]
+	for i := 0; i+1 < len(depsNode.Content); i += 2 {
+		prefixNode := depsNode.Content[i]
+		value := depsNode.Content[i+1]
+		dep, ok := deps[prefixNode.Value]
+		if !ok {
+			changed = true
+			continue
+		}
+		existing[prefixNode.Value] = true
+		if value.Kind != yamlv3.MappingNode {
+			value = newMappingNode()
+			changed = true
+		}
+		changed = updateSpecPackage(value, dep) || changed
+		content = append(content, prefixNode, value)
+	}
+
+	prefixes := []string{}
+	for prefix := range deps {
+		if !existing[prefix] {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	sort.Strings(prefixes)
+	for _, prefix := range prefixes {
+		value := newMappingNode()
+		updateSpecPackage(value, deps[prefix])
+		content = append(content, newScalarNode(prefix), value)
+		changed = true
+	}
+	depsNode.Content = content
+	return changed
+}
+
+func updateSpecPackage(mapping *yamlv3.Node, dep SpecPackage) bool {
+	changed := setMappingScalar(mapping, "url", dep.URL)
+	changed = setMappingScalar(mapping, "version", dep.Version) || changed
+	changed = setMappingScalar(mapping, "ref", dep.Ref) || changed
+	return setMappingScalar(mapping, "path", string(dep.Path)) || changed
+}
+
+func newScalarNode(value string) *yamlv3.Node {
+	return &yamlv3.Node{
+		Kind:  yamlv3.ScalarNode,
+		Tag:   strTag,
+		Value: value,
+	}
+}
+
+func newMappingNode() *yamlv3.Node {
+	return &yamlv3.Node{
+		Kind: yamlv3.MappingNode,
+		Tag:  "!!map",
+	}
+}
+
+// line returns the 1-based line of the entry at the given path of keys.
+// For example, line("dependencies", "foo") is the line of the 'foo'
+// dependency. Returns 0 if the entry doesn't exist.
+func (d *specDocument) line(keys ...string) int {
+	if d == nil {
+		return 0
+	}
+	node := d.root.Content[0]
+	line := 0
+	for _, key := range keys {
+		if node == nil || node.Kind != yamlv3.MappingNode {
+			return 0
+		}
+		index := mappingIndex(node, key)
+		if index < 0 {
+			return 0
+		}
+		line = node.Content[index].Line
+		node = node.Content[index+1]
+	}
+	return line
+}
+
+// mappingIndex returns the index of the key node in the mapping's content.
+// Returns -1 if the key doesn't exist.
+func mappingIndex(mapping *yamlv3.Node, key string) int {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// mappingValue returns the value node for the given key, or nil.
+func mappingValue(mapping *yamlv3.Node, key string) *yamlv3.Node {
+	index := mappingIndex(mapping, key)
+	if index < 0 {
+		return nil
+	}
+	return mapping.Content[index+1]
+}
+
+// ensureMapping returns the mapping node for the given key, creating it (or
+// replacing a non-mapping value) if necessary.
+// Also returns whether the document was changed.
+func ensureMapping(mapping *yamlv3.Node, key string) (*yamlv3.Node, bool) {
+	index := mappingIndex(mapping, key)
+	if index < 0 {
+		value := newMappingNode()
+		mapping.Content = append(mapping.Content, newScalarNode(key), value)
+		return value, true
+	}
+	value := mapping.Content[index+1]
+	if value.Kind == yamlv3.MappingNode {
+		return value, false
+	}
+	// For example 'dependencies:' without any value.
+	newValue := newMappingNode()
+	newValue.LineComment = value.LineComment
+	mapping.Content[index+1] = newValue
+	return newValue, true
+}
+
+// removeMappingKey removes the entry with the given key from the mapping.
+// Returns whether the mapping was changed.
+func removeMappingKey(mapping *yamlv3.Node, key string) bool {
+	index := mappingIndex(mapping, key)
+	if index < 0 {
+		return false
+	}
+	mapping.Content = append(mapping.Content[:index], mapping.Content[index+2:]...)
+	return true
+}
+
+// setMappingScalar sets the value of the given key to the given string.
+// An empty value removes the entry.
+// Existing values keep their style (for example their quotes) and comments.
+// Returns whether the mapping was changed.
+func setMappingScalar(mapping *yamlv3.Node, key string, value string) bool {
+	if value == "" {
+		return removeMappingKey(mapping, key)
+	}
+	index := mappingIndex(mapping, key)
+	if index < 0 {
+		mapping.Content = append(mapping.Content, newScalarNode(key), newScalarNode(value))
+		return true
+	}
+	node := mapping.Content[index+1]
+	if node.Kind == yamlv3.ScalarNode && node.Value == value {
+		return false
+	}
+	if node.Kind != yamlv3.ScalarNode {
+		mapping.Content[index+1] = newScalarNode(value)
+		return true
+	}
+	node.Value = value
+	node.Tag = strTag
+	return true
+}
@@ -0,0 +1,138 @@
+// Copyright (C) 2021 Toitware ApS.
+//
+// This library is free software; you can redistribute it and/or
+// modify it under the terms of the GNU Lesser General Public
+// License as published by the Free Software Foundation; version
+// 2.1 only.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Lesser General Public License for more details.
+//
+// The license can be found in the file `LICENSE` in the top level
+// directory of this repository.
+
+package tpkg
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// downloadToStore ensures that the given package is in the package store, and
+// returns its location in the store.
+// If the hash is known and the store already contains the package, no download
+// is necessary.
+func downloadToStore(ctx context.Context, cache Cache, url string, version string, hash string, ui UI) (string, error) {
+	if hash != "" {
+		storePath := cache.StorePkgPath(url, hash)
+		if isDir, err := isDirectory(storePath); err == nil && isDir {
+			return storePath, nil
+		}
+	}
+
+	storeRoot := *cache.options.pkgStorePath
+	if err := os.MkdirAll(storeRoot, 0755); err != nil {
+		return "", ui.ReportError("Failed to create package store '%s': %v", storeRoot, err)
+	}
+	// Download into a temporary directory inside the store, so that the
+	// final rename doesn't cross drives.
+	tmpDir, err := os.MkdirTemp(storeRoot, ".partial-toit-download")
+	if err != nil {
+		return "", ui.ReportError("Failed to create temporary directory to download '%s - %s': %v", url, version, err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	downloadDir := filepath.Join(tmpDir, "pkg")
+	downloadedHash, err := DownloadGit(ctx, DownloadGitOptions{
+		Directory:  downloadDir,
+		URL:        url,
+		Version:    version,
+		Hash:       hash,
+		UI:         ui,
+		NoReadOnly: false,
+	})
+	if err != nil {
+		return "", err
+	}
+	if hash == "" {
+		hash = downloadedHash
+	}
+
+	storePath := cache.StorePkgPath(url, hash)
+	if doesPathExist(storePath) {
+		// Another process (or a package with a different version, but the
+		// same hash) already filled the store.
+		return storePath, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(storePath), 0755); err != nil {
+		return "", ui.ReportError("Failed to create package store directory '%s': %v", filepath.Dir(storePath), err)
+	}
+	if err := os.Rename(downloadDir, storePath); err != nil {
+		if doesPathExist(storePath) {
+			return storePath, nil
+		}
+		return "", ui.ReportError("Failed to move package '%s' into the package store: %v", url, err)
+	}
+	return storePath, nil
+}
+
+// linkTree replicates the directory tree src at dst.
+// Files are hard-linked if possible, and copied otherwise (for example, when src
+// and dst are on different drives).
+// Since the store is read-only, the linked files are read-only as well. Copied
+// files are made read-only, too, so that both ways give the same result.
+// The '.git' directory of the stored package isn't replicated.
+func linkTree(src string, dst string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && info.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		switch {
+		case info.IsDir():
+			return os.MkdirAll(target, 0755)
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		default:
+			if err := os.Link(path, target); err == nil {
+				return nil
+			}
+			return copyFile(path, target, info.Mode())
+		}
+	})
+}
+
+func copyFile(src string, dst string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode.Perm()|0200)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Chmod(dst, mode.Perm()&^0222)
+}
@@ -0,0 +1,82 @@
+// Copyright (C) 2021 Toitware ApS.
+//
+// This library is free software; you can redistribute it and/or
+// modify it under the terms of the GNU Lesser General Public
+// License as published by the Free Software Foundation; version
+// 2.1 only.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Lesser General Public License for more details.
+//
+// The license can be found in the file `LICENSE` in the top level
+// directory of this repository.
+
+package tpkg
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_PkgStore(t *testing.T) {
+	t.Run("StorePkgPath", func(t *testing.T) {
+		dir := t.TempDir()
+		store := filepath.Join(dir, "store")
+		c := NewCache(filepath.Join(dir, "registries"), &testUI{}, WithPkgStorePath(store))
+		require.True(t, c.HasPkgStore())
+
+		root := c.StorePkgPath("github.com/foo/bar", "1234")
+		assert.Equal(t, filepath.Join(store, "1234", "root"), root)
+		nested := c.StorePkgPath("github.com/foo/bar.git/gee/toto", "1234")
+		assert.Equal(t, filepath.Join(store, "1234", "nested", "gee", "toto"), nested)
+		other := c.StorePkgPath("github.com/foo/bar.git/gee", "1234")
+		assert.NotEqual(t, nested, other)
+
+		c = NewCache(filepath.Join(dir, "registries"), &testUI{})
+		assert.False(t, c.HasPkgStore())
+	})
+
+	t.Run("linkTree", func(t *testing.T) {
+		dir := t.TempDir()
+		src := filepath.Join(dir, "src")
+		require.NoError(t, os.MkdirAll(filepath.Join(src, "sub", "dir"), 0755))
+		srcFile := filepath.Join(src, "sub", "dir", "foo.toit")
+		require.NoError(t, os.WriteFile(srcFile, []byte("foo"), 0444))
+		require.NoError(t, os.Symlink("dir/foo.toit", filepath.Join(src, "sub", "link.toit")))
+
+		dst := filepath.Join(dir, "dst")
+		require.NoError(t, linkTree(src, dst))
+
+		dstFile := filepath.Join(dst, "sub", "dir", "foo.toit")
+		srcStat, err := os.Stat(srcFile)
+		require.NoError(t, err)
+		dstStat, err := os.Stat(dstFile)
+		require.NoError(t, err)
+		assert.True(t, os.SameFile(srcStat, dstStat))
+
+		link, err := os.Readlink(filepath.Join(dst, "sub", "link.toit"))
+		require.NoError(t, err)
+		assert.Equal(t, "dir/foo.toit", link)
+	})
+
+	t.Run("copyFile", func(t *testing.T) {
+		dir := t.TempDir()
+		src := filepath.Join(dir, "src.toit")
+		require.NoError(t, os.WriteFile(src, []byte("foo"), 0444))
+		dst := filepath.Join(dir, "dst.toit")
+		require.NoError(t, copyFile(src, dst, 0444))
+
+		content, err := os.ReadFile(dst)
+		require.NoError(t, err)
+		assert.Equal(t, "foo", string(content))
+		stat, err := os.Stat(dst)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0444), stat.Mode().Perm())
+	})
+}
@@ -0,0 +1,113 @@
+// Copyright (C) 2021 Toitware ApS.
+//
+// This library is free software; you can redistribute it and/or
+// modify it under the terms of the GNU Lesser General Public
+// License as published by the Free Software Foundation; version
+// 2.1 only.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Lesser General Public License for more details.
+//
+// The license can be found in the file `LICENSE` in the top level
+// directory of this repository.
+
+package tpkg
+
+import (
+	"path"
+	"sort"
+	"strings"
+)
+
+// Targets are the devices or platforms a package runs on, like 'host', 'esp32'
+// or a specific chip family like 'esp32s3'.
+// A package lists the targets it supports in its environment. A package
+// without targets supports all of them. The targets of a package may be
+// patterns, like 'esp32*'.
+// The concrete targets of the entry spec (the ones that aren't patterns) are
+// the targets of the project. All packages of a project must support all of
+// them. Patterns only describe what the package supports.
+
+// isValidTarget returns whether the given target (or target pattern) is valid.
+func isValidTarget(target string) bool {
+	if target == "" || strings.ContainsAny(target, " \t\n/") {
+		return false
+	}
+	_, err := path.Match(target, "")
+	return err == nil
+}
+
+// isTargetPattern returns whether the given target is a pattern, like 'esp32*'.
+func isTargetPattern(target string) bool {
+	return strings.ContainsAny(target, "*?[\\")
+}
+
+// projectTargets returns the targets of a project with the given entry spec
+// targets.
+// Patterns are skipped. The result is lower-cased and sorted.
+func projectTargets(specTargets []string) []string {
+	seen := map[string]bool{}
+	result := []string{}
+	for _, target := range specTargets {
+		if isTargetPattern(target) {
+			continue
+		}
+		target = strings.ToLower(target)
+		if !seen[target] {
+			seen[target] = true
+			result = append(result, target)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// supportsTarget returns whether a package with the given targets supports
+// the given target.
+func supportsTarget(pkgTargets []string, target string) bool {
+	if len(pkgTargets) == 0 {
+		return true
+	}
+	target = strings.ToLower(target)
+	for _, pkgTarget := range pkgTargets {
+		if matched, _ := path.Match(strings.ToLower(pkgTarget), target); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// supportsTargets returns whether a package with the given targets supports
+// all the given targets.
+func supportsTargets(pkgTargets []string, targets []string) bool {
+	for _, target := range targets {
+		if !supportsTarget(pkgTargets, target) {
+			return false
+		}
+	}
+	return true
+}
+
+// describeTargets returns a description of the targets for messages.
+func describeTargets(targets []string) string {
+	if len(targets) == 1 {
+		return "target '" + targets[0] + "'"
+	}
+	return "targets '" + strings.Join(targets, "', '") + "'"
+}
+
+// sameTargets returns whether the given project targets are the same.
+// Both lists must be sorted, as returned by projectTargets.
+func sameTargets(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
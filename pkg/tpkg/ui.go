@@ -15,7 +15,16 @@
 
 package tpkg
 
-import "fmt"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
 
 // UI allows this package to interact with the user.
 //
@@ -40,23 +49,202 @@ type UI interface {
 	ReportInfo(format string, a ...interface{})
 }
 
+// Location is the position in a file that a message is about.
+type Location struct {
+	// The path of the file.
+	File string
+	// The 1-based line in the file. 0 if unknown.
+	Line int
+}
+
+// LocationUI is implemented by UIs that report the location of a message
+// separately from its text.
+// Messages with a location are reported through reportErrorAt and
+// reportWarningAt, which fall back to the UI functions for other UIs.
+type LocationUI interface {
+	UI
+
+	// ReportErrorAt signals an error in the file at the given location.
+	// Returns ErrAlreadyReported.
+	ReportErrorAt(loc Location, format string, a ...interface{}) error
+
+	// ReportWarningAt signals a warning in the file at the given location.
+	ReportWarningAt(loc Location, format string, a ...interface{})
+}
+
+// reportErrorAt reports the error to the UI, including the location if
+// the UI supports it.
+func reportErrorAt(ui UI, loc Location, format string, a ...interface{}) error {
+	if locUI, ok := ui.(LocationUI); ok && loc.File != "" {
+		return locUI.ReportErrorAt(loc, format, a...)
+	}
+	return ui.ReportError(format, a...)
+}
+
+// reportWarningAt reports the warning to the UI, including the location if
+// the UI supports it.
+func reportWarningAt(ui UI, loc Location, format string, a ...interface{}) {
+	if locUI, ok := ui.(LocationUI); ok && loc.File != "" {
+		locUI.ReportWarningAt(loc, format, a...)
+		return
+	}
+	ui.ReportWarning(format, a...)
+}
+
 // FmtUI implements a simple version of UI that prints messages using `fmt` primitives.
-type fmtUI struct{}
+type fmtUI struct {
+	// The writer the messages are printed to. If nil, prints to stdout.
+	w io.Writer
+}
+
+// NewFmtUI returns a UI that prints messages using `fmt` primitives to the given writer.
+func NewFmtUI(w io.Writer) UI {
+	return fmtUI{w: w}
+}
+
+func (ui fmtUI) writer() io.Writer {
+	if ui.w == nil {
+		return os.Stdout
+	}
+	return ui.w
+}
 
 // ReportError reports errors from the tpkg package.
 // Returns 'ErrAlreadyReported'
 func (ui fmtUI) ReportError(format string, a ...interface{}) error {
-	fmt.Printf("Error: "+format+"\n", a...)
+	fmt.Fprintf(ui.writer(), "Error: "+format+"\n", a...)
 	return ErrAlreadyReported
 }
 
 // ReportWarning reports warnings from the tpkg package.
 func (ui fmtUI) ReportWarning(format string, a ...interface{}) {
-	fmt.Printf("Warning: "+format+"\n", a...)
+	fmt.Fprintf(ui.writer(), "Warning: "+format+"\n", a...)
 }
 
 func (ui fmtUI) ReportInfo(format string, a ...interface{}) {
-	fmt.Printf("Info: "+format+"\n", a...)
+	fmt.Fprintf(ui.writer(), "Info: "+format+"\n", a...)
+}
+
+// JSONMessage is the JSON representation of a message emitted by the JSON UI.
+type JSONMessage struct {
+	// One of "error", "warning", or "info".
+	Severity string `json:"severity"`
+	// A stable identifier for the kind of message. For example "package-not-found".
+	// The code is derived from the message template and doesn't depend on the
+	// arguments.
+	Code string `json:"code"`
+	// The formatted, human readable, message.
+	Message string `json:"message"`
+	// The arguments that were used to format the message.
+	Args []interface{} `json:"args"`
+	// The file the message is about, if any.
+	File string `json:"file,omitempty"`
+	// The 1-based line in the file, if known.
+	Line int `json:"line,omitempty"`
+}
+
+// jsonUI implements a UI that emits one JSON object (a JSONMessage) per line.
+type jsonUI struct {
+	mutex *sync.Mutex
+	w     io.Writer
+}
+
+// NewJSONUI returns a UI that writes each message as a JSON object on its own line
+// to the given writer.
+func NewJSONUI(w io.Writer) UI {
+	return jsonUI{
+		mutex: &sync.Mutex{},
+		w:     w,
+	}
+}
+
+func (ui jsonUI) ReportError(format string, a ...interface{}) error {
+	ui.emit("error", Location{}, format, a)
+	return ErrAlreadyReported
+}
+
+func (ui jsonUI) ReportWarning(format string, a ...interface{}) {
+	ui.emit("warning", Location{}, format, a)
+}
+
+func (ui jsonUI) ReportInfo(format string, a ...interface{}) {
+	ui.emit("info", Location{}, format, a)
+}
+
+func (ui jsonUI) ReportErrorAt(loc Location, format string, a ...interface{}) error {
+	ui.emit("error", loc, format, a)
+	return ErrAlreadyReported
+}
+
+func (ui jsonUI) ReportWarningAt(loc Location, format string, a ...interface{}) {
+	ui.emit("warning", loc, format, a)
+}
+
+func (ui jsonUI) emit(severity string, loc Location, format string, a []interface{}) {
+	args := make([]interface{}, len(a))
+	for i, arg := range a {
+		args[i] = jsonArg(arg)
+	}
+	encoded, err := json.Marshal(JSONMessage{
+		Severity: severity,
+		Code:     MessageCode(format),
+		Message:  fmt.Sprintf(format, a...),
+		Args:     args,
+		File:     loc.File,
+		Line:     loc.Line,
+	})
+	if err != nil {
+		// Should never happen, as all arguments have been converted to
+		// encodable values.
+		encoded = []byte(fmt.Sprintf(`{"severity":%q,"message":%q}`, severity, fmt.Sprintf(format, a...)))
+	}
+	ui.mutex.Lock()
+	defer ui.mutex.Unlock()
+	fmt.Fprintln(ui.w, string(encoded))
+}
+
+// jsonArg converts the given message argument to a value that can be
+// encoded as JSON.
+func jsonArg(arg interface{}) interface{} {
+	switch v := arg.(type) {
+	case nil, bool, string, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return v
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	}
+	if _, err := json.Marshal(arg); err != nil {
+		return fmt.Sprint(arg)
+	}
+	return arg
+}
+
+var (
+	formatVerbRegexp  = regexp.MustCompile(`%[-+# 0-9.]*[a-zA-Z%]`)
+	nonAlphaNumRegexp = regexp.MustCompile(`[^a-z0-9]+`)
+	quotedVerbRegexp  = regexp.MustCompile(`'[^']*%[^']*'`)
+)
+
+// MessageCode computes the stable message code for the given message template.
+// The code consists of the lower-cased words of the template, without the
+// formatting directives. For example, "Package '%s' not found" has the code
+// "package-not-found".
+func MessageCode(format string) string {
+	code := quotedVerbRegexp.ReplaceAllString(format, " ")
+	code = formatVerbRegexp.ReplaceAllString(code, " ")
+	// Only use the part before the first colon, which usually introduces the
+	// details of the message.
+	if colon := strings.Index(code, ":"); colon > 0 {
+		code = code[:colon]
+	}
+	code = nonAlphaNumRegexp.ReplaceAllString(strings.ToLower(code), "-")
+	code = strings.Trim(code, "-")
+	if code == "" {
+		// The template doesn't have any text. For example "%v".
+		return "message"
+	}
+	return code
 }
 
 // nullUI implements a UI that does nothing.
@@ -86,7 +274,8 @@ var (
 	FmtUI UI = fmtUI{}
 )
 
-// IsErrAlreadyReported returns whether 'e' is the ErrAlreadyReported error.
+// IsErrAlreadyReported returns whether 'e' is the ErrAlreadyReported error, or
+// one of the typed errors of this package (which are always reported).
 func IsErrAlreadyReported(e error) bool {
-	return e == ErrAlreadyReported
+	return errors.Is(e, ErrAlreadyReported)
 }
@@ -0,0 +1,123 @@
+// Copyright (C) 2021 Toitware ApS.
+//
+// This library is free software; you can redistribute it and/or
+// modify it under the terms of the GNU Lesser General Public
+// License as published by the Free Software Foundation; version
+// 2.1 only.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Lesser General Public License for more details.
+//
+// The license can be found in the file `LICENSE` in the top level
+// directory of this repository.
+
+package tpkg
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/go-version"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_MessageCode(t *testing.T) {
+	tests := map[string]string{
+		"Package '%s' not found":                                     "package-not-found",
+		"Invalid prefix: '%s'":                                       "invalid-prefix",
+		"Cannot read 'package.yaml' at '%s': %v":                     "cannot-read-package-yaml-at",
+		"More than one matching package '%s' found":                  "more-than-one-matching-package-found",
+		"Couldn't find a valid solution for the package constraints": "couldn-t-find-a-valid-solution-for-the-package-constraints",
+		"Missing '%s' file in '%s'":                                  "missing-file-in",
+		"%v":                                                         "message",
+	}
+	for format, expected := range tests {
+		assert.Equal(t, expected, MessageCode(format), format)
+	}
+}
+
+func Test_JSONUI(t *testing.T) {
+	out := bytes.Buffer{}
+	ui := NewJSONUI(&out)
+
+	err := ui.ReportError("Package '%s' not found", "foo")
+	assert.Equal(t, ErrAlreadyReported, err)
+	ui.ReportWarning("SDK version '%s' does not satisfy the minimal SDK requirement '^%s'", version.Must(version.NewVersion("1.0.0")), "2.0.0")
+	ui.ReportInfo("Error: %v (%d)", fmt.Errorf("some error"), 42)
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 3)
+
+	messages := []JSONMessage{}
+	for _, line := range lines {
+		var msg JSONMessage
+		require.NoError(t, json.Unmarshal([]byte(line), &msg))
+		messages = append(messages, msg)
+	}
+
+	assert.Equal(t, "error", messages[0].Severity)
+	assert.Equal(t, "package-not-found", messages[0].Code)
+	assert.Equal(t, "Package 'foo' not found", messages[0].Message)
+	assert.Equal(t, []interface{}{"foo"}, messages[0].Args)
+
+	assert.Equal(t, "warning", messages[1].Severity)
+	assert.Equal(t, "sdk-version-does-not-satisfy-the-minimal-sdk-requirement", messages[1].Code)
+	assert.Equal(t, []interface{}{"1.0.0", "2.0.0"}, messages[1].Args)
+
+	assert.Equal(t, "info", messages[2].Severity)
+	assert.Equal(t, "Error: some error (42)", messages[2].Message)
+	assert.Equal(t, []interface{}{"some error", float64(42)}, messages[2].Args)
+}
+
+func Test_JSONUILocation(t *testing.T) {
+	out := bytes.Buffer{}
+	ui := NewJSONUI(&out)
+
+	spec := &Spec{path: "/app/package.yaml"}
+	err := spec.ParseString("name: app\ndependencies:\n  foo:\n    url: github.com/foo/foo\n    branch: main\nversion: 1..0\n", ui)
+	require.Error(t, err)
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 2)
+	messages := []JSONMessage{}
+	for _, line := range lines {
+		var msg JSONMessage
+		require.NoError(t, json.Unmarshal([]byte(line), &msg))
+		messages = append(messages, msg)
+	}
+
+	assert.Equal(t, "warning", messages[0].Severity)
+	assert.Equal(t, "unknown-field-for-dependency", messages[0].Code)
+	assert.Equal(t, "/app/package.yaml", messages[0].File)
+	assert.Equal(t, 5, messages[0].Line)
+
+	assert.Equal(t, "error", messages[1].Severity)
+	assert.Equal(t, "invalid-version", messages[1].Code)
+	assert.Equal(t, "/app/package.yaml", messages[1].File)
+	assert.Equal(t, 6, messages[1].Line)
+
+	out.Reset()
+	spec = &Spec{path: "/app/package.yaml"}
+	err = spec.ParseString("name: app\ndependencies: [\n", ui)
+	require.Error(t, err)
+	var msg JSONMessage
+	require.NoError(t, json.Unmarshal(out.Bytes(), &msg))
+	assert.Equal(t, "/app/package.yaml", msg.File)
+	assert.Equal(t, 2, msg.Line)
+
+	out.Reset()
+	spec = &Spec{path: "/app/package.yaml"}
+	err = spec.ParseString("name: app\ndependencies:\n  foo:\n    url: github.com/foo/foo\n    version: ^1..0\n", ui)
+	require.Error(t, err)
+	msg = JSONMessage{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &msg))
+	assert.Equal(t, "error", msg.Severity)
+	assert.Equal(t, "/app/package.yaml", msg.File)
+	assert.Equal(t, 3, msg.Line)
+}
@@ -20,7 +20,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
-	"strings"
+	"sort"
 
 	"github.com/hashicorp/go-version"
 	"github.com/toitlang/tpkg/pkg/compiler"
@@ -62,18 +62,29 @@ func urlToRelPath(url string) string {
 	return compiler.ToURIPath(url).FilePath()
 }
 
+// sdkConstraintToMinSDK returns the lowest SDK version the given SDK
+// constraint accepts. Returns nil if the constraint doesn't have a lower
+// bound.
 func sdkConstraintToMinSDK(sdk string) (*version.Version, error) {
-	if sdk == "" {
-		return nil, nil
+	constraint, err := parseSDKConstraint(sdk)
+	if err != nil {
+		return nil, err
 	}
-	if !strings.HasPrefix(sdk, "^") {
-		return nil, fmt.Errorf("unexpected sdk constraint: '%s'", sdk)
+	return constraint.minVersion(), nil
+}
+
+// isSameVersion returns whether the two versions are equal. The versions may
+// be non-strict, like '1.0' or 'v1.0.0'.
+func isSameVersion(a string, b string) bool {
+	va, err := version.NewVersion(a)
+	if err != nil {
+		return false
 	}
-	minSDK, err := version.NewVersion(sdk[1:])
+	vb, err := version.NewVersion(b)
 	if err != nil {
-		return nil, err
+		return false
 	}
-	return minSDK, nil
+	return va.Equal(vb)
 }
 
 func writeFileIfChanged(path string, content []byte) error {
@@ -100,3 +111,28 @@ func writeFileIfChanged(path string, content []byte) error {
 	_, err = file.Write(content)
 	return err
 }
+
+// sortedKeys returns the keys of the given map in sorted order.
+func sortedKeys(m map[string]interface{}) []string {
+	result := make([]string, 0, len(m))
+	for key := range m {
+		result = append(result, key)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// FormatSize returns a human readable representation of the given size in
+// bytes. For example "2.6 KiB".
+func FormatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,151 @@
+// Copyright (C) 2021 Toitware ApS.
+//
+// This library is free software; you can redistribute it and/or
+// modify it under the terms of the GNU Lesser General Public
+// License as published by the Free Software Foundation; version
+// 2.1 only.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Lesser General Public License for more details.
+//
+// The license can be found in the file `LICENSE` in the top level
+// directory of this repository.
+
+package tpkg
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/toitlang/tpkg/pkg/git"
+)
+
+// VersionBumpOptions configures how the version of a package is bumped.
+type VersionBumpOptions struct {
+	// The path to the package. Must be the root of a git repository.
+	Path string
+	// Either "major", "minor", "patch", or an explicit version.
+	Bump string
+	// The path to an armored OpenPGP private key. If given, the tag is signed.
+	SignKeyPath string
+	// The passphrase of the signing key, if it is encrypted.
+	SignKeyPassphrase string
+}
+
+// VersionBumpResult describes a version bump.
+type VersionBumpResult struct {
+	// The version of the latest 'v*' tag. Empty if there wasn't any.
+	Previous string
+	Version  string
+	Tag      string
+	// The hash of the tagged commit.
+	Commit string
+	// Whether the version in the package file was updated (and committed).
+	UpdatedSpec bool
+}
+
+// BumpVersion computes the next version of the package and tags it.
+// The next version is computed from the highest 'v<version>' tag of the
+// repository. If the package file has a version entry, it is updated and
+// committed first.
+// Refuses to run if the working tree isn't clean.
+func BumpVersion(o VersionBumpOptions, ui UI) (*VersionBumpResult, error) {
+	if !git.IsRepository(o.Path) {
+		return nil, ui.ReportError("'%s' is not the root of a git repository", o.Path)
+	}
+	isClean, err := git.IsClean(o.Path)
+	if err != nil {
+		return nil, err
+	}
+	if !isClean {
+		return nil, ui.ReportError("The working tree of '%s' isn't clean. Commit or stash the changes first", o.Path)
+	}
+
+	tags, err := git.Tags(o.Path)
+	if err != nil {
+		return nil, err
+	}
+	existing := map[string]bool{}
+	var latest *semver.Version
+	for _, tag := range tags {
+		existing[tag] = true
+		if !strings.HasPrefix(tag, "v") {
+			continue
+		}
+		v, err := semver.StrictNewVersion(tag[1:])
+		if err != nil {
+			continue
+		}
+		if latest == nil || v.GreaterThan(latest) {
+			latest = v
+		}
+	}
+
+	result := &VersionBumpResult{}
+	base := semver.MustParse("0.0.0")
+	if latest != nil {
+		result.Previous = latest.String()
+		base = latest
+	}
+	var next semver.Version
+	switch o.Bump {
+	case "major":
+		next = base.IncMajor()
+	case "minor":
+		next = base.IncMinor()
+	case "patch":
+		next = base.IncPatch()
+	default:
+		v, err := semver.StrictNewVersion(strings.TrimPrefix(o.Bump, "v"))
+		if err != nil {
+			return nil, ui.ReportError("Invalid version bump '%s'. Must be 'major', 'minor', 'patch', or a version", o.Bump)
+		}
+		if latest != nil && !v.GreaterThan(latest) {
+			return nil, ui.ReportError("Version %s is not higher than the latest version %s", v, latest)
+		}
+		next = *v
+	}
+	result.Version = next.String()
+	result.Tag = "v" + result.Version
+	if existing[result.Tag] {
+		return nil, ui.ReportError("Tag '%s' already exists", result.Tag)
+	}
+
+	specPath := filepath.Join(o.Path, DefaultSpecName)
+	spec, err := ReadSpec(specPath, ui)
+	if err != nil {
+		return nil, err
+	}
+	// Check the sign key before committing, so a bad key doesn't leave a
+	// version commit without a tag.
+	if o.SignKeyPath != "" {
+		if err := git.CheckSignKey(o.SignKeyPath, o.SignKeyPassphrase); err != nil {
+			return nil, ui.ReportError("Failed to read the sign key '%s': %v", o.SignKeyPath, err)
+		}
+	}
+	if spec.Version != "" && spec.Version != result.Version {
+		spec.Version = result.Version
+		if err := spec.WriteToFile(); err != nil {
+			return nil, err
+		}
+		message := fmt.Sprintf("Bump version to %s", result.Version)
+		if _, err := git.Commit(o.Path, []string{DefaultSpecName}, message); err != nil {
+			return nil, ui.ReportError("Failed to commit '%s': %v", specPath, err)
+		}
+		result.UpdatedSpec = true
+	}
+
+	result.Commit, err = git.CreateTag(o.Path, result.Tag, git.TagOptions{
+		Message:           "Version " + result.Version,
+		SignKeyPath:       o.SignKeyPath,
+		SignKeyPassphrase: o.SignKeyPassphrase,
+	})
+	if err != nil {
+		return nil, ui.ReportError("Failed to create tag '%s': %v", result.Tag, err)
+	}
+	return result, nil
+}
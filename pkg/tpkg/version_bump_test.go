@@ -0,0 +1,201 @@
+// Copyright (C) 2021 Toitware ApS.
+//
+// This library is free software; you can redistribute it and/or
+// modify it under the terms of the GNU Lesser General Public
+// License as published by the Free Software Foundation; version
+// 2.1 only.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Lesser General Public License for more details.
+//
+// The license can be found in the file `LICENSE` in the top level
+// directory of this repository.
+
+package tpkg
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_BumpVersion(t *testing.T) {
+	initRepository := func(t *testing.T, spec string) (string, *git.Repository) {
+		dir := t.TempDir()
+		repository, err := git.PlainInit(dir, false)
+		require.NoError(t, err)
+		cfg, err := repository.Config()
+		require.NoError(t, err)
+		cfg.User.Name = "Test Committer"
+		cfg.User.Email = "not_used@example.com"
+		require.NoError(t, repository.SetConfig(cfg))
+		commitFile(t, repository, dir, "src/morse.toit", "main:\n")
+		commitFile(t, repository, dir, DefaultSpecName, spec)
+		return dir, repository
+	}
+
+	t.Run("Bumps", func(t *testing.T) {
+		dir, repository := initRepository(t, "name: morse\n")
+		tests := []struct {
+			bump     string
+			previous string
+			expected string
+		}{
+			{"patch", "", "0.0.1"},
+			{"minor", "0.0.1", "0.1.0"},
+			{"patch", "0.1.0", "0.1.1"},
+			{"major", "0.1.1", "1.0.0"},
+			{"1.2.3", "1.0.0", "1.2.3"},
+			{"v2.0.0", "1.2.3", "2.0.0"},
+		}
+		for _, test := range tests {
+			// Make sure every tag is on a different commit.
+			head := commitFile(t, repository, dir, "src/morse.toit", "main:\n  print \""+test.expected+"\"\n")
+			ui := testUI{}
+			result, err := BumpVersion(VersionBumpOptions{Path: dir, Bump: test.bump}, &ui)
+			require.NoError(t, err)
+			assert.Empty(t, ui.messages)
+			assert.Equal(t, test.previous, result.Previous)
+			assert.Equal(t, test.expected, result.Version)
+			assert.Equal(t, "v"+test.expected, result.Tag)
+			assert.Equal(t, head, result.Commit)
+			assert.False(t, result.UpdatedSpec)
+
+			ref, err := repository.Tag(result.Tag)
+			require.NoError(t, err)
+			tag, err := repository.TagObject(ref.Hash())
+			require.NoError(t, err)
+			assert.Equal(t, "Version "+test.expected+"\n", tag.Message)
+			assert.Equal(t, head, tag.Target.String())
+		}
+	})
+
+	t.Run("Spec version", func(t *testing.T) {
+		dir, repository := initRepository(t, "name: morse\nversion: 1.0.0\n")
+		ui := testUI{}
+		result, err := BumpVersion(VersionBumpOptions{Path: dir, Bump: "minor"}, &ui)
+		require.NoError(t, err)
+		assert.Equal(t, "0.1.0", result.Version)
+		assert.True(t, result.UpdatedSpec)
+
+		spec, err := ReadSpec(filepath.Join(dir, DefaultSpecName), &ui)
+		require.NoError(t, err)
+		assert.Equal(t, "0.1.0", spec.Version)
+
+		head, err := repository.Head()
+		require.NoError(t, err)
+		assert.Equal(t, head.Hash().String(), result.Commit)
+		commit, err := repository.CommitObject(head.Hash())
+		require.NoError(t, err)
+		assert.Equal(t, "Bump version to 0.1.0", commit.Message)
+		wt, err := repository.Worktree()
+		require.NoError(t, err)
+		status, err := wt.Status()
+		require.NoError(t, err)
+		assert.True(t, status.IsClean())
+	})
+
+	t.Run("Signed", func(t *testing.T) {
+		dir, repository := initRepository(t, "name: morse\n")
+		entity, err := openpgp.NewEntity("Test Committer", "", "not_used@example.com", nil)
+		require.NoError(t, err)
+		keyPath := filepath.Join(t.TempDir(), "key.asc")
+		keyFile, err := os.Create(keyPath)
+		require.NoError(t, err)
+		writer, err := armor.Encode(keyFile, openpgp.PrivateKeyType, nil)
+		require.NoError(t, err)
+		require.NoError(t, entity.SerializePrivate(writer, nil))
+		require.NoError(t, writer.Close())
+		require.NoError(t, keyFile.Close())
+
+		result, err := BumpVersion(VersionBumpOptions{Path: dir, Bump: "1.0.0", SignKeyPath: keyPath}, &testUI{})
+		require.NoError(t, err)
+		ref, err := repository.Tag(result.Tag)
+		require.NoError(t, err)
+		tag, err := repository.TagObject(ref.Hash())
+		require.NoError(t, err)
+		assert.NotEmpty(t, tag.PGPSignature)
+		_, err = tag.Verify(armoredPublicKey(t, entity))
+		assert.NoError(t, err)
+	})
+
+	t.Run("Bad sign key", func(t *testing.T) {
+		dir, repository := initRepository(t, "name: morse\nversion: 1.0.0\n")
+		before, err := repository.Head()
+		require.NoError(t, err)
+
+		ui := testUI{}
+		keyPath := filepath.Join(t.TempDir(), "missing.asc")
+		_, err = BumpVersion(VersionBumpOptions{Path: dir, Bump: "minor", SignKeyPath: keyPath}, &ui)
+		assert.True(t, IsErrAlreadyReported(err))
+		require.Len(t, ui.messages, 1)
+		assert.Contains(t, ui.messages[0], "Error: Failed to read the sign key '"+keyPath+"'")
+
+		// Neither the package file nor the history changed.
+		after, err := repository.Head()
+		require.NoError(t, err)
+		assert.Equal(t, before.Hash(), after.Hash())
+		spec, err := ReadSpec(filepath.Join(dir, DefaultSpecName), &ui)
+		require.NoError(t, err)
+		assert.Equal(t, "1.0.0", spec.Version)
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		dir, repository := initRepository(t, "name: morse\n")
+		head, err := repository.Head()
+		require.NoError(t, err)
+		_, err = repository.CreateTag("v1.0.0", head.Hash(), nil)
+		require.NoError(t, err)
+		_, err = repository.CreateTag("v1.1.0", plumbing.NewHash(commitFile(t, repository, dir, "README.md", "Morse\n")), nil)
+		require.NoError(t, err)
+
+		tests := []struct {
+			bump     string
+			expected string
+		}{
+			{"foo", "Error: Invalid version bump 'foo'. Must be 'major', 'minor', 'patch', or a version"},
+			{"1.0.5", "Error: Version 1.0.5 is not higher than the latest version 1.1.0"},
+		}
+		for _, test := range tests {
+			ui := testUI{}
+			_, err := BumpVersion(VersionBumpOptions{Path: dir, Bump: test.bump}, &ui)
+			assert.True(t, IsErrAlreadyReported(err))
+			assert.Equal(t, []string{test.expected}, ui.messages)
+		}
+
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "README.md"), []byte("Changed\n"), 0644))
+		ui := testUI{}
+		_, err = BumpVersion(VersionBumpOptions{Path: dir, Bump: "patch"}, &ui)
+		assert.True(t, IsErrAlreadyReported(err))
+		assert.Equal(t, []string{
+			"Error: The working tree of '" + dir + "' isn't clean. Commit or stash the changes first",
+		}, ui.messages)
+
+		ui = testUI{}
+		notRepository := t.TempDir()
+		_, err = BumpVersion(VersionBumpOptions{Path: notRepository, Bump: "patch"}, &ui)
+		assert.True(t, IsErrAlreadyReported(err))
+		assert.Equal(t, []string{
+			"Error: '" + notRepository + "' is not the root of a git repository",
+		}, ui.messages)
+	})
+}
+
+func armoredPublicKey(t *testing.T, entity *openpgp.Entity) string {
+	var buffer bytes.Buffer
+	writer, err := armor.Encode(&buffer, openpgp.PublicKeyType, nil)
+	require.NoError(t, err)
+	require.NoError(t, entity.Serialize(writer))
+	require.NoError(t, writer.Close())
+	return buffer.String()
+}
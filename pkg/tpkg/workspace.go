@@ -0,0 +1,235 @@
+// Copyright (C) 2021 Toitware ApS.
+//
+// This library is free software; you can redistribute it and/or
+// modify it under the terms of the GNU Lesser General Public
+// License as published by the Free Software Foundation; version
+// 2.1 only.
+//
+// This library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the GNU
+// Lesser General Public License for more details.
+//
+// The license can be found in the file `LICENSE` in the top level
+// directory of this repository.
+
+package tpkg
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/toitlang/tpkg/pkg/set"
+	"gopkg.in/yaml.v2"
+)
+
+// A workspace groups local packages (the members) that are developed
+// together. The spec file at the root of the workspace lists the members.
+// All members are solved together, and share the lock file of the root, so
+// that they use the same versions of their (third-party) dependencies.
+
+// SpecWorkspace lists the members of a workspace.
+type SpecWorkspace struct {
+	// The directories of the members, relative to the workspace root.
+	// A member may be a glob pattern, like 'packages/*'. Patterns only
+	// match directories that contain a package file.
+	Members []string `yaml:"members,omitempty"`
+}
+
+// validate checks that the members are relative paths or valid patterns.
+func (w *SpecWorkspace) validate(specPath string, ui UI) error {
+	for _, member := range w.Members {
+		if member == "" {
+			return reportSpecError(ui, specPath, "Workspace member without path")
+		}
+		if filepath.IsAbs(member) {
+			return reportSpecError(ui, specPath, "Workspace member '%s' must be a relative path", member)
+		}
+		if _, err := filepath.Match(member, ""); err != nil {
+			return reportSpecError(ui, specPath, "Invalid workspace member pattern '%s'", member)
+		}
+	}
+	return nil
+}
+
+// workspaceMembers returns the paths of the workspace members, relative to
+// the directory of the spec. Patterns are expanded.
+// Returns an empty list if the spec isn't the root of a workspace.
+func (s *Spec) workspaceMembers() ([]string, error) {
+	if s.Workspace == nil {
+		return nil, nil
+	}
+	dir := filepath.Dir(s.path)
+	seen := set.String{}
+	result := []string{}
+	add := func(member string) {
+		member = filepath.Clean(member)
+		if !seen.Contains(member) {
+			seen.Add(member)
+			result = append(result, member)
+		}
+	}
+	for _, member := range s.Workspace.Members {
+		if !strings.ContainsAny(member, "*?[") {
+			add(member)
+			continue
+		}
+		matches, err := filepath.Glob(filepath.Join(dir, member))
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(matches)
+		for _, match := range matches {
+			exists, err := isFile(filepath.Join(match, DefaultSpecName))
+			if err != nil {
+				return nil, err
+			}
+			if !exists {
+				continue
+			}
+			rel, err := filepath.Rel(dir, match)
+			if err != nil {
+				return nil, err
+			}
+			add(rel)
+		}
+	}
+	return result, nil
+}
+
+// workspaceMemberDirs returns the full (cleaned) paths of the workspace members.
+func (s *Spec) workspaceMemberDirs() (set.String, error) {
+	members, err := s.workspaceMembers()
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Dir(s.path)
+	result := set.String{}
+	for _, member := range members {
+		result.Add(filepath.Clean(filepath.Join(dir, member)))
+	}
+	return result, nil
+}
+
+// resolvedDeps returns the dependencies of the given spec that must be
+// resolved when 's' is the entry spec.
+// Dev dependencies are only resolved for the entry spec and the members of its
+// workspace. The 'fullDir' is the directory of the given spec, and the
+// 'memberDirs' are the directories of the workspace members.
+func (s *Spec) resolvedDeps(spec *Spec, fullDir string, memberDirs set.String) DependencyMap {
+	if spec == s || memberDirs.Contains(fullDir) {
+		return spec.allDeps()
+	}
+	return spec.Deps
+}
+
+// findWorkspaceRoot searches the parent directories of the given directory
+// for the root of a workspace that has the directory as member.
+// The given directory must be absolute.
+// Returns "" if the directory isn't part of a workspace.
+func findWorkspaceRoot(dir string) (string, error) {
+	dir = filepath.Clean(dir)
+	current := dir
+	for {
+		parent := filepath.Dir(current)
+		if parent == current {
+			return "", nil
+		}
+		current = parent
+
+		specPath := pkgPathForDir(current)
+		b, err := os.ReadFile(specPath)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return "", err
+		}
+		// We only need the workspace entry. Other errors are reported once the
+		// spec is read for real.
+		workspaceSpec := Spec{
+			path: specPath,
+		}
+		if err := yaml.Unmarshal(b, &workspaceSpec); err != nil || workspaceSpec.Workspace == nil {
+			continue
+		}
+		memberDirs, err := workspaceSpec.workspaceMemberDirs()
+		if err != nil {
+			continue
+		}
+		if memberDirs.Contains(dir) {
+			return current, nil
+		}
+	}
+}
+
+// readDepsSpec returns the spec to which dependencies are added, and from
+// which they are removed.
+// This is the spec of the workspace member in which the project was found, or
+// the given project spec otherwise.
+func (m *ProjectPkgManager) readDepsSpec(spec *Spec) (*Spec, error) {
+	if m.Paths.WorkspaceMemberPath == "" {
+		return spec, nil
+	}
+	return ReadSpec(pkgPathForDir(m.Paths.WorkspaceMemberPath), m.ui)
+}
+
+// updateDeps writes the changed dependencies of the depsSpec, and the lock
+// file that 'solve' computes for the project spec.
+// Outside of workspace members, the depsSpec is the project spec. In a
+// workspace member, it is the spec of the member (see readDepsSpec). Since
+// the workspace is solved with the specs of its members on disk, the member
+// spec is then written before calling 'solve', and restored if 'solve' fails.
+func (m *ProjectPkgManager) updateDeps(spec *Spec, depsSpec *Spec, solve func() (*LockFile, error)) (*LockFile, error) {
+	if depsSpec == spec {
+		lf, err := solve()
+		if err != nil {
+			return nil, err
+		}
+		return lf, m.writeSpecAndLock(spec, lf)
+	}
+
+	old, err := os.ReadFile(depsSpec.path)
+	if err != nil {
+		return nil, err
+	}
+	if err := depsSpec.WriteToFile(); err != nil {
+		return nil, err
+	}
+	lf, err := solve()
+	if err == nil {
+		err = lf.WriteToFile()
+	}
+	if err != nil {
+		if restoreErr := writeFileIfChanged(depsSpec.path, old); restoreErr != nil {
+			m.ui.ReportWarning("Failed to restore '%s': %v", depsSpec.path, restoreErr)
+		}
+		return nil, err
+	}
+	return lf, nil
+}
+
+// reportMemberLockFiles warns about lock files in the directories of the
+// workspace members.
+// Members use the lock file of the workspace root. Their own lock files
+// aren't updated, and would be stale.
+func (m *ProjectPkgManager) reportMemberLockFiles(spec *Spec) error {
+	memberDirs, err := spec.workspaceMemberDirs()
+	if err != nil {
+		return err
+	}
+	dirs := memberDirs.Values()
+	sort.Strings(dirs)
+	for _, dir := range dirs {
+		lockPath := lockPathForDir(dir)
+		exists, err := isFile(lockPath)
+		if err != nil {
+			return err
+		}
+		if exists {
+			m.ui.ReportWarning("Ignoring lock file '%s' of workspace member. Members use the lock file of the workspace root", lockPath)
+		}
+	}
+	return nil
+}
@@ -797,6 +797,33 @@ func test_toitPkg(t *tedi.T) {
 		})
 	})
 
+	t.Run("Search2", func(t *tedi.T, pt PkgTest) {
+		regPath := filepath.Join(pt.dir, "registry")
+		pt.GoldToit("search", [][]string{
+			{"pkg", "registry", "add", "--local", "test-reg", regPath},
+			{"// Exact name matches come first, then prefixes, then descriptions."},
+			{"pkg", "search", "morse"},
+			{"pkg", "search", "--limit", "1", "morse"},
+			{"// All terms must match."},
+			{"pkg", "search", "morse", "prosigns"},
+			{"// Typos are tolerated."},
+			{"pkg", "search", "dispaly"},
+			{"// Searches in specific fields."},
+			{"pkg", "search", "license:MIT"},
+			{"pkg", "search", "license:mit", "code"},
+			{"pkg", "search", "keyword:graphics"},
+			{"pkg", "search", "topic:encoding"},
+			{"pkg", "search", "name:morse"},
+			{"pkg", "search", "url:toitware"},
+			{"pkg", "search", "sdk:2.3.0"},
+			{"pkg", "search", "--output", "json", "--limit", "1", "keyword:screen"},
+			{"// Bad queries."},
+			{"pkg", "search", "sdk:foo"},
+			{"pkg", "search", "name:"},
+			{"pkg", "search", "--limit", "-1", "morse"},
+		})
+	})
+
 	t.Run("GitPackage", func(t *tedi.T, pt PkgTest) {
 		pt.GoldToit("git package search", [][]string{
 			{"// Execution should fail, as the package is not installed yet"},
@@ -1348,6 +1375,65 @@ func test_toitPkg(t *tedi.T) {
 		assert.True(t, stat.IsDir())
 	})
 
+	t.Run("PackageStore", func(t *tedi.T, pt PkgTest) {
+		regPath1 := filepath.Join(pt.dir, "registry_git_pkgs")
+		// The store is opt-in.
+		storePath := filepath.Join(pt.dir, cacheDir, "tpkg-store")
+		pt.env["TOIT_PACKAGE_STORE_PATH"] = storePath
+		pt.GoldToit("test", [][]string{
+			{"pkg", "registry", "add", "test-reg", regPath1},
+			{"pkg", "init"},
+			{"pkg", "install", "pkg1"},
+		})
+
+		findToitFile := func(dir string) string {
+			result := ""
+			err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+				if err != nil {
+					return err
+				}
+				if info.IsDir() && info.Name() == ".git" {
+					return filepath.SkipDir
+				}
+				if !info.IsDir() && info.Name() == "pkg1.toit" {
+					result = path
+				}
+				return nil
+			})
+			require.NoError(t, err)
+			return result
+		}
+		storeFile := findToitFile(storePath)
+		installedFile := findToitFile(filepath.Join(pt.dir, ".packages"))
+		require.NotEmpty(t, storeFile)
+		require.NotEmpty(t, installedFile)
+
+		storeStat, err := os.Stat(storeFile)
+		require.NoError(t, err)
+		installedStat, err := os.Stat(installedFile)
+		require.NoError(t, err)
+		assert.True(t, os.SameFile(storeStat, installedStat))
+		assert.Zero(t, storeStat.Mode()&0222)
+		// The git directory of the stored package isn't linked.
+		err = filepath.Walk(filepath.Join(pt.dir, ".packages"), func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			assert.NotEqual(t, ".git", info.Name(), path)
+			return nil
+		})
+		require.NoError(t, err)
+
+		// Removing the installed packages doesn't affect the store.
+		require.NoError(t, os.RemoveAll(filepath.Join(pt.dir, ".packages")))
+		assert.FileExists(t, storeFile)
+		pt.GoldToit("test2", [][]string{
+			{"pkg", "install"},
+		})
+		assert.FileExists(t, storeFile)
+		assert.FileExists(t, findToitFile(filepath.Join(pt.dir, ".packages")))
+	})
+
 	t.Run("MoreLock", func(t *tedi.T, pt PkgTest) {
 		regPath1 := filepath.Join(pt.dir, "registry_git_pkgs")
 
@@ -1502,6 +1588,33 @@ func test_toitPkg(t *tedi.T) {
 		})
 	})
 
+	t.Run("WorkspaceMember", func(t *tedi.T, pt PkgTest) {
+		pt.GoldToit("pre", [][]string{
+			{"pkg", "registry", "add", "--local", "test-reg", "registry"},
+		})
+		appDir := filepath.Join(pt.dir, "app")
+		pt.overwriteRunDir = appDir
+		pt.GoldToit("test", [][]string{
+			{"pkg", "install", "foo"},
+			{"pkg", "install"},
+			{"pkg", "lockfile"},
+			{"pkg", "packagefile"},
+		})
+		// The dependency is added to the package file of the member.
+		memberSpec, err := os.ReadFile(filepath.Join(appDir, "package.yaml"))
+		require.NoError(t, err)
+		assert.Contains(t, string(memberSpec), "foo:")
+
+		pt.overwriteRunDir = ""
+		pt.GoldToit("project-root", [][]string{
+			{"pkg", "uninstall", "--project-root=app", "foo"},
+			{"pkg", "lockfile"},
+		})
+		memberSpec, err = os.ReadFile(filepath.Join(appDir, "package.yaml"))
+		require.NoError(t, err)
+		assert.NotContains(t, string(memberSpec), "foo:")
+	})
+
 	t.Run("DeepPackage", func(t *tedi.T, pt PkgTest) {
 		registryDir := filepath.Join(pt.dir, "nested_registry")
 		pt.GoldToit("test", [][]string{
@@ -1717,6 +1830,72 @@ environment:
 		wg.Wait()
 	})
 
+	t.Run("CacheList", func(t *tedi.T, pt PkgTest) {
+		regPath := filepath.Join(pt.dir, "registry_git_pkgs")
+		pkg3URL := computeGitDir(filepath.Join(pt.dir, "git_pkgs", "pkg3"))
+		// The listing shows the git hash of the package, which changes with
+		// every run.
+		pkg3Repo, err := git.PlainOpen(filepath.Join(pt.dir, "git_pkgs", "pkg3"))
+		require.NoError(t, err)
+		pkg3Hash, err := pkg3Repo.ResolveRevision("v3.1.2")
+		require.NoError(t, err)
+		pt.goldRepls[pkg3Hash.String()] = "<PKG3_HASH>"
+		pt.GoldToit("test", [][]string{
+			{"pkg", "registry", "add", "--local", "test-reg", regPath},
+			{"pkg", "init"},
+			{"pkg", "cache", "list"},
+			{"pkg", "install", "pkg3"},
+			{"pkg", "cache", "list"},
+			{"pkg", "cache", "path", pkg3URL + "@3.1.2"},
+			{"pkg", "cache", "path", "--all", pkg3URL + "@3.1.2"},
+			{"// Errors"},
+			{"pkg", "cache", "path", pkg3URL + "@3.1.3"},
+			{"pkg", "cache", "path", pkg3URL},
+			{"pkg", "cache", "path", pkg3URL + "@bad"},
+		})
+	})
+
+	t.Run("JSONOutput", func(t *tedi.T, pt PkgTest) {
+		regPath := filepath.Join(pt.dir, "registry_git_pkgs")
+		pkg3URL := computeGitDir(filepath.Join(pt.dir, "git_pkgs", "pkg3"))
+		pt.GoldToit("test", [][]string{
+			{"pkg", "registry", "add", "--local", "test-reg", regPath},
+			{"pkg", "registry", "list", "--output", "json"},
+			{"pkg", "search", "-o", "json", "pkg2"},
+			{"pkg", "search", "-o", "json", "not-there"},
+			{"pkg", "init"},
+			{"pkg", "install", "-o", "json", "pkg1"},
+			{"pkg", "install", "-o", "json"},
+			{"pkg", "update", "-o", "json"},
+			{"pkg", "cache", "path", "-o", "json", pkg3URL + "@3.1.2"},
+			{"pkg", "uninstall", "-o", "json", "pkg1"},
+			{"// Errors"},
+			{"pkg", "install", "-o", "json", "not-there"},
+			{"pkg", "list", "-o", "yaml"},
+		})
+	})
+
+	t.Run("MessageFormat", func(t *tedi.T, pt PkgTest) {
+		regPath := filepath.Join(pt.dir, "registry_git_pkgs")
+		pt.GoldToit("test", [][]string{
+			{"pkg", "registry", "add", "--local", "test-reg", regPath},
+			{"pkg", "init"},
+			{"pkg", "install", "--message-format", "json", "pkg1"},
+			{"pkg", "install", "--message-format", "json", "not-there"},
+			{"pkg", "install", "--message-format", "json", "--prefix", "invalid prefix", "pkg2"},
+			{"pkg", "install", "--message-format", "json", "-o", "json", "not-there"},
+			{"pkg", "list", "--message-format", "yaml"},
+		})
+
+		pt.env["TOIT_MESSAGE_FORMAT"] = "json"
+		pt.GoldToit("env", [][]string{
+			{"pkg", "install", "not-there"},
+			{"// The flag takes precedence over the environment variable."},
+			{"pkg", "install", "--message-format", "text", "not-there"},
+			{"pkg", "install", "--message-format", "text", "-o", "json", "not-there"},
+		})
+	})
+
 	t.Run("InstallNoMTimeChange", func(t *tedi.T, pt PkgTest) {
 		regPath := filepath.Join(pt.dir, "registry_git_pkgs")
 		lockPath := filepath.Join(pt.dir, "package.lock")